@@ -6,13 +6,20 @@
 package dynamo
 
 import (
-	"math"
-	"math/rand"
+	"context"
 	"time"
 )
 
-// FailConfig stores parameters for the exponential backoff algorithm.
+// FailConfig stores parameters for the exponential backoff algorithm, in milliseconds.
 // Attempt, Elapsed, MaxRetiresReached should always be initialized to 0, 0, false.
+//
+// Cap is the total time, in milliseconds, that an operation keeps retrying, not a
+// limit on each wait: as in earlier versions, waits grow from Base with full jitter
+// and are only cut short so they end when the Cap is reached. FailConfig
+// implements RetryPolicy as the equivalent Backoff. The operations of this
+// package keep their retry state in a Retrier and never modify a FailConfig, so
+// one FailConfig, such as DefaultFailConfig, may be shared; Attempt, Elapsed and
+// MaxRetriesReached are only used by ExponentialBackoff.
 type FailConfig struct {
 	Base              float64
 	Cap               float64
@@ -25,26 +32,67 @@ type FailConfig struct {
 // with a base wait time of 50 miliseconds, and max wait time of 1 minute (60000 ms).
 var DefaultFailConfig = &FailConfig{50, 60000, 0, 0, false}
 
+// Retryable reports whether err may be retried, as decided by DefaultRetryable.
+func (fc *FailConfig) Retryable(err error) bool {
+	return DefaultRetryable(err)
+}
+
+// NewRetrier returns the retry state of a new operation, which starts now.
+func (fc *FailConfig) NewRetrier() Retrier {
+	return fc.backoff().NewRetrier()
+}
+
+// backoff returns the Backoff equivalent to fc. Cap bounds the time spent
+// retrying; each wait is bounded by what is left of it.
+func (fc *FailConfig) backoff() *Backoff {
+	return &Backoff{Base: millis(fc.Base), MaxElapsed: millis(fc.Cap)}
+}
+
+// millis converts a number of milliseconds to a Duration.
+func millis(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
 // ExponentialBackoff implements the exponential backoff algorithm for request retries
 // and returns true when the max number of retries has been reached (fc.Elapsed > fc.Cap).
 func (fc *FailConfig) ExponentialBackoff() {
-	if fc.Elapsed == fc.Cap {
+	fc.ExponentialBackoffWithContext(context.Background())
+}
+
+// ExponentialBackoffWithContext is the same as ExponentialBackoff, except that the wait
+// is interrupted when ctx is done, in which case ctx.Err() is returned.
+func (fc *FailConfig) ExponentialBackoffWithContext(ctx context.Context) error {
+	if fc.Elapsed >= fc.Cap {
 		fc.MaxRetriesReached = true // max retries reached
-		return
+		return nil
 	}
 
 	fc.Attempt += 1.0
 	// exponential backoff with full jitter
-	wait := float64(rand.Intn(int(fc.Base * math.Pow(2.0, fc.Attempt))))
+	wait := float64(fc.backoff().delay(int(fc.Attempt), 0)) / float64(time.Millisecond)
 
 	if fc.Elapsed+wait > fc.Cap {
 		// wait until cap is reached
-		time.Sleep(time.Duration(wait - (wait + fc.Elapsed - fc.Cap)))
-		fc.Elapsed = fc.Cap
+		wait = fc.Cap - fc.Elapsed
 	}
 
-	time.Sleep(time.Duration(wait) * time.Millisecond)
+	if err := sleep(ctx, millis(wait)); err != nil {
+		return err
+	}
 	fc.Elapsed += wait
+	return nil
+}
+
+// sleep pauses for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Reset resets Attempt and Elapsed fields.
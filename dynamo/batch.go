@@ -0,0 +1,605 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the batch operations that accept any number of requests across one or more tables.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DefaultBatchConcurrency is the number of BatchWriteItem requests run at once
+// by the batch write operations if no concurrency is given.
+const DefaultBatchConcurrency = 4
+
+// Limits of a single BatchWriteItem and BatchGetItem request.
+const (
+	maxBatchWriteItems = 25
+	maxBatchWriteBytes = 16 << 20
+	maxBatchGetKeys    = 100
+)
+
+// BatchWriteOptions configures BatchPut, BatchDelete and BatchWriteTables.
+type BatchWriteOptions struct {
+	// Concurrency is the maximum number of BatchWriteItem requests in flight.
+	// Values <= 0 use DefaultBatchConcurrency.
+	Concurrency int
+	// Retry decides which failed requests are retried and the backoff between
+	// retries of each request. If nil, FailConfig is used if set, else DefaultRetryPolicy.
+	Retry RetryPolicy
+	// FailConfig configures the backoff between retries of each request if Retry
+	// is nil. It is not modified.
+	FailConfig *FailConfig
+}
+
+// BatchWriteResult summarizes a batch write.
+type BatchWriteResult struct {
+	// Succeeded is the number of write requests that were applied.
+	Succeeded int
+	// Failed holds the write requests that were not applied, keyed by table name.
+	Failed map[string][]*dynamodb.WriteRequest
+}
+
+// tableWrite is a write request for the named table.
+type tableWrite struct {
+	table string
+	id    string // identifies the item written, see writeID
+	req   *dynamodb.WriteRequest
+	size  int
+}
+
+// writeID returns the table name and primary key of the item av of table t,
+// which identify the item written by a request. It fails if av has no value or
+// a value that is not a string, number or binary for a key attribute of t.
+func writeID(t *Table, av map[string]*dynamodb.AttributeValue) (string, error) {
+	key, err := itemKey(t, av)
+	if err != nil {
+		return "", err
+	}
+	return t.TableName + "/" + keyString(t, key), nil
+}
+
+// writeRequests returns the write requests of reqs.
+func writeRequests(reqs []tableWrite) []*dynamodb.WriteRequest {
+	wrs := make([]*dynamodb.WriteRequest, len(reqs))
+	for i, w := range reqs {
+		wrs[i] = w.req
+	}
+	return wrs
+}
+
+// dedupeWrites removes the requests of reqs for the same item as a later request,
+// which replaces them in place: the last request for an item wins.
+// DynamoDB rejects a BatchWriteItem request with two requests for the same item.
+func dedupeWrites(reqs []tableWrite) []tableWrite {
+	index := make(map[string]int, len(reqs))
+	out := reqs[:0]
+	for _, w := range reqs {
+		if i, ok := index[w.id]; ok {
+			out[i] = w
+			continue
+		}
+		index[w.id] = len(out)
+		out = append(out, w)
+	}
+	return out
+}
+
+// BatchPut puts any number of items in table t. The items are split into
+// BatchWriteItem requests of at most 25 items and 16 MB, which are run with
+// bounded concurrency and their UnprocessedItems retried with exponential
+// backoff. Items are written in no particular order; if an item is repeated, by
+// primary key, only its last occurrence is written. Conditions and version checks are not supported by BatchWriteItem,
+// so the items of a Table with a VersionAttributeName are written as is.
+//
+// The result reports how many items were written and which were not. If any
+// were not, the error is an *UnprocessedError holding them.
+func BatchPut(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, items []interface{}, opts *BatchWriteOptions) (*BatchWriteResult, error) {
+	reqs, err := putWrites("BatchPut", t, items, nil)
+	if err != nil {
+		return nil, err
+	}
+	return batchWrite(ctx, svc, "BatchPut", t.TableName, dedupeWrites(reqs), opts)
+}
+
+// BatchDelete deletes the items of table t with the key values in queries,
+// which may be any number. Repeated keys are deleted once. Requests are split,
+// run and retried as by BatchPut.
+func BatchDelete(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, queries []*Query, opts *BatchWriteOptions) (*BatchWriteResult, error) {
+	reqs, err := deleteWrites("BatchDelete", t, queries, nil)
+	if err != nil {
+		return nil, err
+	}
+	return batchWrite(ctx, svc, "BatchDelete", t.TableName, dedupeWrites(reqs), opts)
+}
+
+// TableWrites holds the items to put in and delete from one Table in a
+// multi-table batch write.
+type TableWrites struct {
+	Table   *Table
+	Puts    []interface{}
+	Deletes []*Query
+}
+
+// BatchWriteTables applies the puts and deletes of several Tables, such as those
+// of a DbInfo, in BatchWriteItem requests that may span tables. Of several puts
+// and deletes of the same item, only the last is applied, deletes following the
+// puts of each TableWrites. Requests are split, run and retried as by BatchPut,
+// and the requests that were not applied
+// are reported per table in BatchWriteResult.Failed and the *UnprocessedError.
+func BatchWriteTables(ctx context.Context, svc dynamodbiface.DynamoDBAPI, writes []*TableWrites, opts *BatchWriteOptions) (*BatchWriteResult, error) {
+	var reqs []tableWrite
+	var names []string
+	for _, w := range writes {
+		var err error
+		if reqs, err = putWrites("BatchWriteTables", w.Table, w.Puts, reqs); err != nil {
+			return nil, err
+		}
+		if reqs, err = deleteWrites("BatchWriteTables", w.Table, w.Deletes, reqs); err != nil {
+			return nil, err
+		}
+		names = append(names, w.Table.TableName)
+	}
+	return batchWrite(ctx, svc, "BatchWriteTables", strings.Join(names, ","), dedupeWrites(reqs), opts)
+}
+
+// putWrites appends put requests for items of table t to reqs.
+// It fails if an item cannot be marshaled or lacks a valid primary key.
+func putWrites(op string, t *Table, items []interface{}, reqs []tableWrite) ([]tableWrite, error) {
+	for i, item := range items {
+		if item == nil {
+			logger().Warn("skipping nil item", slog.String("op", op), slog.String("table", t.TableName))
+			continue
+		}
+		av, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			logErr(op, t.TableName, err)
+			return nil, opErr(op, t.TableName, err)
+		}
+		id, err := writeID(t, av)
+		if err != nil {
+			logErr(op, t.TableName, err)
+			return nil, opErr(op, t.TableName, fmt.Errorf("item %d: %w", i, err))
+		}
+		reqs = append(reqs, tableWrite{
+			table: t.TableName,
+			id:    id,
+			req:   &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}},
+			size:  itemSize(av),
+		})
+	}
+	return reqs, nil
+}
+
+// deleteWrites appends delete requests for the keys in queries of table t to reqs.
+// It fails if a query lacks a valid key value.
+func deleteWrites(op string, t *Table, queries []*Query, reqs []tableWrite) ([]tableWrite, error) {
+	for i, q := range queries {
+		if q == nil {
+			continue
+		}
+		key := keyMaker(q, t)
+		id, err := writeID(t, key)
+		if err != nil {
+			logErr(op, t.TableName, err)
+			return nil, opErr(op, t.TableName, fmt.Errorf("query %d: %w", i, err))
+		}
+		reqs = append(reqs, tableWrite{
+			table: t.TableName,
+			id:    id,
+			req:   &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key}},
+			size:  itemSize(key),
+		})
+	}
+	return reqs, nil
+}
+
+// WriteBatch accumulates puts and deletes for one or more Tables, which are
+// applied together by Flush. DynamoDB rejects a BatchWriteItem request with two
+// requests for the same item, so a put or delete replaces any earlier one for
+// the same key: the last operation on an item wins. WriteBatches are created
+// with NewWriteBatch, and each method returns the WriteBatch so calls can be chained:
+//
+//	res, err := NewWriteBatch().
+//		Put(d.Tables["users"], user).
+//		Delete(d.Tables["sessions"], q).
+//		Flush(ctx, d.Svc, nil)
+//
+// As with BatchPut, conditions and version checks are not supported.
+type WriteBatch struct {
+	reqs  []tableWrite
+	index map[string]int // position in reqs by table name and key
+	names []string
+	err   error
+}
+
+// NewWriteBatch returns an empty WriteBatch.
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{index: map[string]int{}}
+}
+
+// Put puts item in table t, replacing any earlier put or delete of the same item.
+func (b *WriteBatch) Put(t *Table, item interface{}) *WriteBatch {
+	if item == nil {
+		return b.fail("Put", t, fmt.Errorf("nil item"))
+	}
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return b.fail("Put", t, err)
+	}
+	id, err := writeID(t, av)
+	if err != nil {
+		return b.fail("Put", t, err)
+	}
+	return b.add(t, tableWrite{
+		table: t.TableName,
+		id:    id,
+		req:   &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}},
+		size:  itemSize(av),
+	})
+}
+
+// Delete deletes the item of table t with the key values in q, replacing any
+// earlier put or delete of the same item.
+func (b *WriteBatch) Delete(t *Table, q *Query) *WriteBatch {
+	if q == nil {
+		return b.fail("Delete", t, fmt.Errorf("nil query"))
+	}
+	key := keyMaker(q, t)
+	id, err := writeID(t, key)
+	if err != nil {
+		return b.fail("Delete", t, err)
+	}
+	return b.add(t, tableWrite{
+		table: t.TableName,
+		id:    id,
+		req:   &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key}},
+		size:  itemSize(key),
+	})
+}
+
+// Len returns the number of requests in b, after deduplication.
+func (b *WriteBatch) Len() int {
+	return len(b.reqs)
+}
+
+func (b *WriteBatch) add(t *Table, w tableWrite) *WriteBatch {
+	if i, ok := b.index[w.id]; ok {
+		b.reqs[i] = w
+		return b
+	}
+	if !slices.Contains(b.names, t.TableName) {
+		b.names = append(b.names, t.TableName)
+	}
+	b.index[w.id] = len(b.reqs)
+	b.reqs = append(b.reqs, w)
+	return b
+}
+
+// fail records the first error building a request, which is returned by Flush.
+func (b *WriteBatch) fail(op string, t *Table, err error) *WriteBatch {
+	if b.err == nil {
+		b.err = opErr("WriteBatch", t.TableName, fmt.Errorf("%s %d: %w", op, len(b.reqs), err))
+	}
+	return b
+}
+
+// Flush applies the requests of b, which are split, run and retried as by
+// BatchPut, and empties b so it can be reused. The result reports how many
+// requests were applied and which were not, per table. If a request could not be
+// built, that error is returned and nothing is written.
+func (b *WriteBatch) Flush(ctx context.Context, svc dynamodbiface.DynamoDBAPI, opts *BatchWriteOptions) (*BatchWriteResult, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	reqs, table := b.reqs, strings.Join(b.names, ",")
+	b.reqs, b.index, b.names = nil, map[string]int{}, nil
+	return batchWrite(ctx, svc, "WriteBatch", table, reqs, opts)
+}
+
+// TableGets holds the keys to read from one Table in a multi-table batch get.
+type TableGets struct {
+	Table   *Table
+	Queries []*Query
+	// Out is a pointer to a slice, such as *[]User, into which the items found
+	// are unmarshaled in the order of Queries. Items that do not exist are
+	// omitted and repeated keys are fetched once.
+	Out interface{}
+}
+
+// BatchGetTables reads the items of several Tables, such as those of a DbInfo,
+// in BatchGetItem requests of up to 100 keys that may span tables, and routes the
+// items found back to each TableGets' Out. Any number of keys may be given.
+// Throttled requests and UnprocessedKeys are retried as decided by p; if nil,
+// DefaultRetryPolicy is used. If keys remain unread, an *UnprocessedError holding
+// them per table is returned and no Out is set.
+func BatchGetTables(ctx context.Context, svc dynamodbiface.DynamoDBAPI, p RetryPolicy, gets []*TableGets) error {
+	p = retryPolicy(p)
+	var names []string
+	var chunks []map[string]*dynamodb.KeysAndAttributes
+	var chunk map[string]*dynamodb.KeysAndAttributes
+	n := 0
+	seen := map[string]bool{}
+	for _, g := range gets {
+		names = append(names, g.Table.TableName)
+		for _, q := range g.Queries {
+			if q == nil {
+				continue
+			}
+			key := keyMaker(q, g.Table)
+			id := g.Table.TableName + "/" + keyString(g.Table, key)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if chunk == nil || n == maxBatchGetKeys {
+				chunk = map[string]*dynamodb.KeysAndAttributes{}
+				chunks = append(chunks, chunk)
+				n = 0
+			}
+			ka := chunk[g.Table.TableName]
+			if ka == nil {
+				ka = &dynamodb.KeysAndAttributes{}
+				chunk[g.Table.TableName] = ka
+			}
+			ka.Keys = append(ka.Keys, key)
+			n++
+		}
+	}
+	table := strings.Join(names, ",")
+
+	found := map[string]map[string]*dynamodb.AttributeValue{}
+	for i, c := range chunks {
+		avs, left, err := getChunk(ctx, svc, p, "BatchGetTables", c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			for _, rest := range chunks[i+1:] {
+				for name, ka := range rest {
+					if left[name] == nil {
+						left[name] = &dynamodb.KeysAndAttributes{}
+					}
+					left[name].Keys = append(left[name].Keys, ka.Keys...)
+				}
+			}
+			return &UnprocessedError{Op: "BatchGetTables", Table: table, Keys: left, Err: err}
+		}
+		for _, g := range gets {
+			for _, av := range avs[g.Table.TableName] {
+				found[g.Table.TableName+"/"+keyString(g.Table, av)] = av
+			}
+		}
+	}
+
+	for _, g := range gets {
+		var avs []map[string]*dynamodb.AttributeValue
+		for _, q := range g.Queries {
+			if q == nil {
+				continue
+			}
+			if av, ok := found[g.Table.TableName+"/"+keyString(g.Table, keyMaker(q, g.Table))]; ok {
+				avs = append(avs, av)
+			}
+		}
+		if err := dynamodbattribute.UnmarshalListOfMaps(avs, g.Out); err != nil {
+			logErr("BatchGetTables", g.Table.TableName, err)
+			return opErr("BatchGetTables", g.Table.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
+		}
+	}
+	logger().Debug("read batch", slog.String("op", "BatchGetTables"), slog.String("table", table), slog.Int("items", len(found)))
+	return nil
+}
+
+// batchWrite applies reqs in chunks of at most 25 requests and 16 MB, running up
+// to opts.Concurrency chunks at once. table names the table for errors and logs.
+func batchWrite(ctx context.Context, svc dynamodbiface.DynamoDBAPI, op, table string, reqs []tableWrite, opts *BatchWriteOptions) (*BatchWriteResult, error) {
+	if opts == nil {
+		opts = &BatchWriteOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	p := opts.Retry
+	if p == nil && opts.FailConfig != nil {
+		p = opts.FailConfig
+	}
+	p = retryPolicy(p)
+
+	res := &BatchWriteResult{Failed: map[string][]*dynamodb.WriteRequest{}}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	fail := func(left map[string][]*dynamodb.WriteRequest, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for name, wrs := range left {
+			res.Failed[name] = append(res.Failed[name], wrs...)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for _, chunk := range chunkWrites(reqs) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(chunk, nil)
+			continue
+		}
+		wg.Add(1)
+		go func(chunk map[string][]*dynamodb.WriteRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if left, err := writeChunk(ctx, svc, p, op, chunk); err != nil {
+				fail(left, err)
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	res.Succeeded = len(reqs) - writeCount(res.Failed)
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if len(res.Failed) > 0 {
+		return res, &UnprocessedError{Op: op, Table: table, Items: res.Failed, Err: errors.Join(errs...)}
+	}
+	logger().Debug("wrote batch", slog.String("op", op), slog.String("table", table), slog.Int("items", res.Succeeded))
+	return res, nil
+}
+
+// chunkWrites splits reqs into RequestItems maps of at most 25 requests and 16 MB.
+func chunkWrites(reqs []tableWrite) []map[string][]*dynamodb.WriteRequest {
+	var chunks []map[string][]*dynamodb.WriteRequest
+	var chunk map[string][]*dynamodb.WriteRequest
+	n, size := 0, 0
+	for _, r := range reqs {
+		if chunk == nil || n == maxBatchWriteItems || size+r.size > maxBatchWriteBytes {
+			chunk = map[string][]*dynamodb.WriteRequest{}
+			chunks = append(chunks, chunk)
+			n, size = 0, 0
+		}
+		chunk[r.table] = append(chunk[r.table], r.req)
+		n++
+		size += r.size
+	}
+	return chunks
+}
+
+// writeChunk writes one chunk of requests, retrying the errors p classifies as
+// retryable and unprocessed items with p's backoff. It returns the requests left
+// unapplied when it gives up.
+func writeChunk(ctx context.Context, svc dynamodbiface.DynamoDBAPI, p RetryPolicy, op string, items map[string][]*dynamodb.WriteRequest) (map[string][]*dynamodb.WriteRequest, error) {
+	input := &dynamodb.BatchWriteItemInput{RequestItems: items}
+	r := p.NewRetrier()
+	table := strings.Join(sortedKeys(items), ",")
+	for {
+		result, err := batchWriteUtil(ctx, svc, input)
+		if err != nil {
+			if ctx.Err() != nil {
+				return input.RequestItems, ctx.Err()
+			}
+			if !p.Retryable(err) {
+				logErr(op, table, err, slog.Int("unprocessed", writeCount(input.RequestItems)))
+				return input.RequestItems, err
+			}
+		} else {
+			if len(result.UnprocessedItems) == 0 {
+				return nil, nil
+			}
+			input.RequestItems = result.UnprocessedItems
+			err = fmt.Errorf("%d items unprocessed", writeCount(input.RequestItems))
+		}
+
+		logRetry(op, table, r.Attempt()+1, err, slog.Int("unprocessed", writeCount(input.RequestItems)))
+		if err := retryWait(ctx, r, err); err != nil { // waits
+			if errors.Is(err, ErrMaxRetries) {
+				logErr(op, table, ErrMaxRetries, slog.Int("unprocessed", writeCount(input.RequestItems)))
+			}
+			return input.RequestItems, err
+		}
+	}
+}
+
+// itemSize approximates the size DynamoDB counts for av: the lengths of its
+// attribute names plus the sizes of their values.
+func itemSize(av map[string]*dynamodb.AttributeValue) int {
+	n := 0
+	for name, v := range av {
+		n += len(name) + avSize(v)
+	}
+	return n
+}
+
+// avSize approximates the size of a single attribute value.
+func avSize(v *dynamodb.AttributeValue) int {
+	if v == nil {
+		return 0
+	}
+	n := 0
+	switch {
+	case v.S != nil:
+		n = len(*v.S)
+	case v.N != nil:
+		n = len(*v.N)
+	case v.B != nil:
+		n = len(v.B)
+	case v.BOOL != nil, v.NULL != nil:
+		n = 1
+	case v.SS != nil:
+		for _, s := range v.SS {
+			n += len(*s)
+		}
+	case v.NS != nil:
+		for _, s := range v.NS {
+			n += len(*s)
+		}
+	case v.BS != nil:
+		for _, b := range v.BS {
+			n += len(b)
+		}
+	case v.L != nil:
+		n = 3
+		for _, e := range v.L {
+			n += 1 + avSize(e)
+		}
+	case v.M != nil:
+		n = 3 + itemSize(v.M) + len(v.M)
+	}
+	return n
+}
+
+// getChunk reads one BatchGetItem request of at most 100 keys, retrying the errors
+// p classifies as retryable and unprocessed keys with p's backoff. It returns the
+// items read keyed by table name, and the keys left unread when it gives up.
+func getChunk(ctx context.Context, svc dynamodbiface.DynamoDBAPI, p RetryPolicy, op string, items map[string]*dynamodb.KeysAndAttributes) (map[string][]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.KeysAndAttributes, error) {
+	input := &dynamodb.BatchGetItemInput{RequestItems: items}
+	r := p.NewRetrier()
+	table := strings.Join(sortedKeys(items), ",")
+	avs := map[string][]map[string]*dynamodb.AttributeValue{}
+	for {
+		result, err := batchGetUtil(ctx, svc, input)
+		if err != nil {
+			if ctx.Err() != nil {
+				return avs, input.RequestItems, ctx.Err()
+			}
+			if !p.Retryable(err) {
+				logErr(op, table, err, slog.Int("unprocessed", keyCount(input.RequestItems)))
+				return avs, input.RequestItems, err
+			}
+		} else {
+			for name, rs := range result.Responses {
+				avs[name] = append(avs[name], rs...)
+			}
+			if len(result.UnprocessedKeys) == 0 {
+				return avs, nil, nil
+			}
+			input.RequestItems = result.UnprocessedKeys
+			err = fmt.Errorf("%d keys unprocessed", keyCount(input.RequestItems))
+		}
+
+		logRetry(op, table, r.Attempt()+1, err, slog.Int("unprocessed", keyCount(input.RequestItems)))
+		if err := retryWait(ctx, r, err); err != nil { // waits
+			if errors.Is(err, ErrMaxRetries) {
+				logErr(op, table, ErrMaxRetries, slog.Int("unprocessed", keyCount(input.RequestItems)))
+			}
+			return avs, input.RequestItems, err
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+func TestBatchWriteDuplicates(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+
+	var items []interface{}
+	for i := 0; i < 30; i++ {
+		items = append(items, thing{ID: "a", Sort: i % 3, Title: fmt.Sprint("v", i)})
+	}
+	res, err := BatchPut(ctx, f, tb, items, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded != 3 {
+		t.Errorf("got %d succeeded, want 3", res.Succeeded)
+	}
+	for i := 0; i < 3; i++ {
+		var got thing
+		if _, err := GetItem(f, CreateNewQueryObj("a", i), tb, &got); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprint("v", 27+i); got.Title != want {
+			t.Errorf("item %d: got Title %q, want the last put %q", i, got.Title, want)
+		}
+	}
+
+	queries := []*Query{CreateNewQueryObj("a", 0), CreateNewQueryObj("a", 1), CreateNewQueryObj("a", 0)}
+	if res, err := BatchDelete(ctx, f, tb, queries, nil); err != nil || res.Succeeded != 2 {
+		t.Fatalf("got %+v, %v, want 2 deletes", res, err)
+	}
+
+	res, err = BatchWriteTables(ctx, f, []*TableWrites{{
+		Table:   tb,
+		Puts:    []interface{}{thing{ID: "b", Sort: 1}, thing{ID: "a", Sort: 2, Title: "new"}},
+		Deletes: []*Query{CreateNewQueryObj("b", 1)},
+	}}, nil)
+	if err != nil || res.Succeeded != 2 {
+		t.Fatalf("got %+v, %v, want 2 writes", res, err)
+	}
+	if n := len(f.Items("things")); n != 1 {
+		t.Errorf("got %d items, want 1", n)
+	}
+}
+
+func TestBatchWriteInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	keyless := map[string]interface{}{"Title": "x"}
+	tests := []struct {
+		name  string
+		write func(f dynamodbiface.DynamoDBAPI, tb *Table) error
+	}{
+		{"put keyless", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			_, err := BatchPut(ctx, f, tb, []interface{}{keyless, keyless, keyless}, nil)
+			return err
+		}},
+		{"put bool key", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			_, err := BatchPut(ctx, f, tb, []interface{}{map[string]interface{}{"ID": true, "Sort": 1}}, nil)
+			return err
+		}},
+		{"delete nil key", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			_, err := BatchDelete(ctx, f, tb, []*Query{CreateNewQueryObj(nil, 1)}, nil)
+			return err
+		}},
+		{"tables", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			_, err := BatchWriteTables(ctx, f, []*TableWrites{{Table: tb, Puts: []interface{}{thing{ID: "a"}}, Deletes: []*Query{CreateNewQueryObj("a", nil)}}}, nil)
+			return err
+		}},
+		{"write batch", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			_, err := NewWriteBatch().Put(tb, thing{ID: "a"}).Put(tb, keyless).Flush(ctx, f, nil)
+			return err
+		}},
+		{"legacy create", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			return BatchWriteCreate(f, tb, nil, []interface{}{thing{ID: "a"}, keyless})
+		}},
+		{"legacy delete", func(f dynamodbiface.DynamoDBAPI, tb *Table) error {
+			return BatchWriteDelete(f, tb, nil, []*Query{CreateNewQueryObj(nil, nil)})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newTestTable(t)
+			if err := tt.write(f, tb); err == nil || !strings.Contains(err.Error(), "key attribute") {
+				t.Errorf("got %v, want a key attribute error", err)
+			}
+			if n := f.Calls("BatchWriteItem"); n != 0 {
+				t.Errorf("got %d BatchWriteItem calls, want 0", n)
+			}
+		})
+	}
+}
+
+func TestBatchWriteCreateDuplicates(t *testing.T) {
+	f, tb := newTestTable(t)
+	items := []interface{}{thing{ID: "a", Sort: 1, Title: "old"}, thing{ID: "b", Sort: 1}, thing{ID: "a", Sort: 1, Title: "new"}}
+	if err := BatchWriteCreate(f, tb, nil, items); err != nil {
+		t.Fatal(err)
+	}
+	var got thing
+	if _, err := GetItem(f, CreateNewQueryObj("a", 1), tb, &got); err != nil || got.Title != "new" {
+		t.Errorf("got %+v (%v), want the last put", got, err)
+	}
+	if err := BatchWriteDelete(f, tb, nil, []*Query{CreateNewQueryObj("a", 1), CreateNewQueryObj("a", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.Items("things")); n != 1 {
+		t.Errorf("got %d items, want 1", n)
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	others, err := NewTable("others", "ID", "string", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTable(f, others); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := CreateItem(f, thing{ID: "old", Sort: i}, tb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewWriteBatch()
+	for i := 0; i < 40; i++ {
+		b.Put(tb, thing{ID: "new", Sort: i, Title: "v1"})
+	}
+	for i := 0; i < 20; i++ {
+		b.Put(others, map[string]interface{}{"ID": fmt.Sprint("o", i)})
+	}
+	for i := 0; i < 5; i++ {
+		b.Delete(tb, CreateNewQueryObj("old", i))
+	}
+	b.Put(tb, thing{ID: "new", Sort: 0, Title: "v2"})   // replaces a put
+	b.Delete(tb, CreateNewQueryObj("new", 1))           // replaces a put
+	b.Put(tb, thing{ID: "old", Sort: 0, Title: "kept"}) // replaces a delete
+	b.Delete(others, CreateNewQueryObj("o19", nil))     // replaces a put
+	if b.Len() != 65 {
+		t.Errorf("got Len %d, want 65", b.Len())
+	}
+
+	res, err := b.Flush(ctx, f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded != 65 {
+		t.Errorf("got %d succeeded, want 65", res.Succeeded)
+	}
+	if n := f.Calls("BatchWriteItem"); n != 3 {
+		t.Errorf("got %d BatchWriteItem calls, want 3 chunks of at most 25", n)
+	}
+	if n := len(f.Items("things")); n != 40 {
+		t.Errorf("got %d things, want 40", n)
+	}
+	if n := len(f.Items("others")); n != 19 {
+		t.Errorf("got %d others, want 19", n)
+	}
+	for _, want := range []thing{{ID: "new", Sort: 0, Title: "v2"}, {ID: "new", Sort: 2, Title: "v1"}, {ID: "old", Sort: 0, Title: "kept"}} {
+		var got thing
+		if _, err := GetItem(f, CreateNewQueryObj(want.ID, want.Sort), tb, &got); err != nil || got != want {
+			t.Errorf("got %+v (%v), want %+v", got, err, want)
+		}
+	}
+	if _, err := GetItem(f, CreateNewQueryObj("new", 1), tb, &thing{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted put: got %v, want ErrNotFound", err)
+	}
+
+	// Flush empties the batch
+	if b.Len() != 0 {
+		t.Errorf("got Len %d after Flush, want 0", b.Len())
+	}
+	if res, err := b.Put(tb, thing{ID: "x", Sort: 1}).Flush(ctx, f, nil); err != nil || res.Succeeded != 1 {
+		t.Errorf("reused batch: got %+v, %v, want 1 write", res, err)
+	}
+}
+
+func TestBatchGetTables(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	others, err := NewTable("others", "ID", "string", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTable(f, others); err != nil {
+		t.Fatal(err)
+	}
+	var things []interface{}
+	var thingQueries, otherQueries []*Query
+	for i := 0; i < 150; i++ {
+		things = append(things, thing{ID: "a", Sort: i})
+		thingQueries = append(thingQueries, CreateNewQueryObj("a", i))
+	}
+	if _, err := BatchPut(ctx, f, tb, things, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := CreateItem(f, map[string]interface{}{"ID": fmt.Sprint("o", i)}, others); err != nil {
+			t.Fatal(err)
+		}
+		otherQueries = append(otherQueries, CreateNewQueryObj(fmt.Sprint("o", i), nil))
+	}
+	// a missing key and a repeated one
+	otherQueries = append(otherQueries, CreateNewQueryObj("missing", nil), CreateNewQueryObj("o0", nil))
+
+	f.InjectFault(dynamotest.Fault{Op: "BatchGetItem", Unprocessed: 10})
+	before := f.Calls("BatchGetItem")
+	var gotThings []thing
+	var gotOthers []struct{ ID string }
+	err = BatchGetTables(ctx, f, nil, []*TableGets{
+		{Table: tb, Queries: thingQueries, Out: &gotThings},
+		{Table: others, Queries: otherQueries, Out: &gotOthers},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.Calls("BatchGetItem") - before; n != 3 {
+		t.Errorf("got %d BatchGetItem calls, want 2 chunks and 1 retry", n)
+	}
+	if len(gotThings) != 150 {
+		t.Fatalf("got %d things, want 150", len(gotThings))
+	}
+	for i, th := range gotThings {
+		if th.Sort != i {
+			t.Fatalf("thing %d: got Sort %d, want items in query order", i, th.Sort)
+		}
+	}
+	if len(gotOthers) != 31 || gotOthers[0].ID != "o0" || gotOthers[29].ID != "o29" || gotOthers[30].ID != "o0" {
+		t.Errorf("got %d others %v, want o0..o29 and o0", len(gotOthers), gotOthers)
+	}
+
+	// keys left unread after retrying are reported per table
+	f.InjectFault(dynamotest.Fault{Op: "BatchGetItem", Unprocessed: 5, Times: -1})
+	gotOthers = nil
+	err = BatchGetTables(ctx, f, nil, []*TableGets{{Table: others, Queries: otherQueries[:20], Out: &gotOthers}})
+	var ue *UnprocessedError
+	if !errors.As(err, &ue) || !errors.Is(err, ErrMaxRetries) || len(ue.Keys["others"].Keys) != 5 {
+		t.Fatalf("got %v, want an *UnprocessedError with 5 keys", err)
+	}
+	if gotOthers != nil {
+		t.Errorf("got %v, want Out unset", gotOthers)
+	}
+}
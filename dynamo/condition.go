@@ -0,0 +1,189 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the Condition object and the conditional single-item writes.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// Condition guards a single-item write, which is only applied if Expr holds for
+// the item as currently stored. Expr is built with the SDK's expression package,
+// which supports attribute_exists, attribute_not_exists, comparisons, begins_with,
+// contains, size and AND/OR/NOT:
+//
+//	c := If(expression.Name("Price").LessThan(expression.Value(10)).And(expression.AttributeExists(expression.Name("Stock"))))
+//
+// Writes whose condition fails return a *ConditionError matching ErrConditionFailed.
+type Condition struct {
+	// Expr is the condition the stored item must meet.
+	Expr expression.ConditionBuilder
+	// ReturnItem requests the stored item's attributes when the condition fails,
+	// which are then set in ConditionError.Item.
+	ReturnItem bool
+}
+
+// If returns a Condition requiring the stored item to meet cond.
+func If(cond expression.ConditionBuilder) *Condition {
+	return &Condition{Expr: cond}
+}
+
+// IfNotExists returns a Condition requiring that no item with the same primary
+// key exists in table t, for create-if-absent writes.
+func IfNotExists(t *Table) *Condition {
+	return If(expression.AttributeNotExists(expression.Name(t.PrimaryKeyName)))
+}
+
+// IfExists returns a Condition requiring that an item with the same primary
+// key exists in table t, so that a write does not create a new item.
+func IfExists(t *Table) *Condition {
+	return If(expression.AttributeExists(expression.Name(t.PrimaryKeyName)))
+}
+
+// WithItem sets ReturnItem and returns c.
+func (c *Condition) WithItem() *Condition {
+	c.ReturnItem = true
+	return c
+}
+
+// returnValues returns the ReturnValuesOnConditionCheckFailure setting of c.
+func (c *Condition) returnValues() *string {
+	if c == nil || !c.ReturnItem {
+		return nil
+	}
+	return aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld)
+}
+
+// ConditionError is returned by a write whose Condition was not met.
+// It matches ErrConditionFailed and wraps an awserr.Error with the AWS error code
+// and message; the stored item, if returned, is only held in Item.
+type ConditionError struct {
+	Op    string
+	Table string
+	// Item holds the stored item's attributes if the Condition set ReturnItem or
+	// the write checked the item's version, and the item exists; else it is nil.
+	Item map[string]*dynamodb.AttributeValue
+	Err  error
+
+	conflict bool // the stored version differs from the expected one
+}
+
+func (e *ConditionError) Error() string {
+	if e.conflict {
+		return fmt.Sprintf("%s failed: %v: %v", e.Op, ErrVersionConflict, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error and ErrConditionFailed, and
+// ErrVersionConflict if the write failed on a stale version.
+func (e *ConditionError) Unwrap() []error {
+	if e.conflict {
+		return append(unwrap(e.Err), ErrVersionConflict)
+	}
+	return unwrap(e.Err)
+}
+
+// UnmarshalItem unmarshals Item into out, which must be a non-nil pointer.
+func (e *ConditionError) UnmarshalItem(out interface{}) error {
+	return dynamodbattribute.UnmarshalMap(e.Item, out)
+}
+
+// writeErr returns the error for a failed single-item write: a *ConditionError
+// if the condition check failed, else the same as ctxOpErr.
+func writeErr(ctx context.Context, op, table string, err error) error {
+	var ccf *dynamodb.ConditionalCheckFailedException
+	if errors.As(err, &ccf) || errCode(err) == dynamodb.ErrCodeConditionalCheckFailedException {
+		ce := &ConditionError{Op: op, Table: table, Err: safeErr(err)}
+		if ccf != nil {
+			ce.Item = ccf.Item
+		}
+		return ce
+	}
+	return ctxOpErr(ctx, op, table, err)
+}
+
+// writeCondition returns the condition of a write: c's condition, and if version
+// is not nil the condition that the stored version equals *version.
+// Reports false if the write has no condition.
+func writeCondition(t *Table, c *Condition, version *int64) (expression.ConditionBuilder, bool) {
+	var cond expression.ConditionBuilder
+	ok := c != nil
+	if ok {
+		cond = c.Expr
+	}
+	if version != nil {
+		vc := versionCondition(t, *version)
+		if ok {
+			cond = cond.And(vc)
+		} else {
+			cond, ok = vc, true
+		}
+	}
+	return cond, ok
+}
+
+// CreateItemIf puts item in table t if the stored item with the same primary key,
+// if any, meets c. Use IfNotExists(t) to only create new items.
+// Returns a *ConditionError matching ErrConditionFailed if c is not met.
+func CreateItemIf(ctx context.Context, svc dynamodbiface.DynamoDBAPI, item interface{}, t *Table, c *Condition) error {
+	return putItem(ctx, svc, DefaultRetryPolicy, item, t, c)
+}
+
+// UpdateItemIf is the same as UpdateItem if the item with the key values in q
+// meets c. Use Update.If to make an UpdateItemWith call conditional.
+// Returns a *ConditionError matching ErrConditionFailed if c is not met.
+func UpdateItemIf(ctx context.Context, svc dynamodbiface.DynamoDBAPI, q *Query, t *Table, c *Condition) error {
+	return updateItem(ctx, svc, q, t, c)
+}
+
+// DeleteItemIf deletes the item of table t with the key values in q if it meets c.
+// Returns a *ConditionError matching ErrConditionFailed if c is not met.
+func DeleteItemIf(ctx context.Context, svc dynamodbiface.DynamoDBAPI, q *Query, t *Table, c *Condition) error {
+	input, err := deleteInput(t, keyMaker(q, t), c)
+	if err != nil {
+		return opErr("DeleteItem", t.TableName, err)
+	}
+
+	err = withRetry(ctx, DefaultRetryPolicy, "DeleteItem", t.TableName, func() error {
+		_, err := svc.DeleteItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("DeleteItem", t.TableName, err)
+		return writeErr(ctx, "DeleteItem", t.TableName, err)
+	}
+
+	logger().Debug("deleted item", slog.String("op", "DeleteItem"), slog.String("table", t.TableName))
+	return nil
+}
+
+// deleteInput builds the DeleteItemInput deleting the item with the given key
+// if it meets c when c is not nil.
+func deleteInput(t *Table, key map[string]*dynamodb.AttributeValue, c *Condition) (*dynamodb.DeleteItemInput, error) {
+	if c == nil {
+		return &dynamodb.DeleteItemInput{Key: key, TableName: aws.String(t.TableName)}, nil
+	}
+	expr, err := expression.NewBuilder().WithCondition(c.Expr).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DeleteItemInput{
+		ConditionExpression:                 expr.Condition(),
+		ExpressionAttributeNames:            expr.Names(),
+		ExpressionAttributeValues:           expr.Values(),
+		Key:                                 key,
+		ReturnValuesOnConditionCheckFailure: c.returnValues(),
+		TableName:                           aws.String(t.TableName),
+	}, nil
+}
@@ -0,0 +1,96 @@
+package dynamo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+// captureLogs sets a package logger writing every record to the returned buffer
+// for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { SetLogger(nil) })
+	return &buf
+}
+
+// checkNoItem fails the test if err's text or the logs hold the attribute value secret.
+func checkNoItem(t *testing.T, err error, logs *bytes.Buffer, secret string) {
+	t.Helper()
+	if strings.Contains(err.Error(), secret) {
+		t.Errorf("error holds item attribute: %v", err)
+	}
+	if strings.Contains(logs.String(), secret) {
+		t.Errorf("logs hold item attribute: %s", logs)
+	}
+}
+
+func TestErrorsHideItem(t *testing.T) {
+	ctx := context.Background()
+	q := CreateNewQueryObj("a", 1)
+	otherTitle := func() *Condition { return If(expression.Name("Title").Equal(expression.Value("other"))).WithItem() }
+	tests := []struct {
+		name    string
+		version bool                                      // the table has the version attribute Ver
+		write   func(f *dynamotest.Fake, tb *Table) error // fails on the stored item a/1
+	}{
+		{"put", false, func(f *dynamotest.Fake, tb *Table) error {
+			return CreateItemIf(ctx, f, thing{ID: "a", Sort: 1}, tb, IfNotExists(tb).WithItem())
+		}},
+		{"update", false, func(f *dynamotest.Fake, tb *Table) error {
+			return UpdateItemWith(ctx, f, tb, q, NewUpdate().Set("Title", "x").If(otherTitle()), nil)
+		}},
+		{"delete", false, func(f *dynamotest.Fake, tb *Table) error {
+			return DeleteItemIf(ctx, f, q, tb, otherTitle())
+		}},
+		{"transaction", false, func(f *dynamotest.Fake, tb *Table) error {
+			return TransactWrite(ctx, f, NewWriteTx().Put(tb, thing{ID: "b", Sort: 1}, nil).Put(tb, thing{ID: "a", Sort: 1}, IfNotExists(tb).WithItem()))
+		}},
+		{"version put", true, func(f *dynamotest.Fake, tb *Table) error {
+			return CreateItem(f, versioned{ID: "a", Sort: 1}, tb)
+		}},
+		{"version update", true, func(f *dynamotest.Fake, tb *Table) error {
+			return UpdateItemWith(ctx, f, tb, q, NewUpdate().Set("Title", "new").IfVersion(5), nil)
+		}},
+		{"version transaction", true, func(f *dynamotest.Fake, tb *Table) error {
+			return TransactWrite(ctx, f, NewWriteTx().Put(tb, versioned{ID: "a", Sort: 1, Ver: 3}, nil))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newTestTable(t)
+			want := ErrConditionFailed
+			if tt.version {
+				tb.VersionAttributeName, want = "Ver", ErrVersionConflict
+			}
+			if err := CreateItem(f, versioned{ID: "a", Sort: 1, Title: "secret-title"}, tb); err != nil {
+				t.Fatal(err)
+			}
+			logs := captureLogs(t)
+
+			err := tt.write(f, tb)
+			if !errors.Is(err, want) {
+				t.Fatalf("got %v, want %v", err, want)
+			}
+			var ce *ConditionError
+			if !errors.As(err, &ce) || ce.Item == nil {
+				t.Fatalf("got %v, want a *ConditionError with the stored item", err)
+			}
+			var got versioned
+			if err := ce.UnmarshalItem(&got); err != nil || got.Title != "secret-title" {
+				t.Errorf("got item %+v (%v), want the stored item", got, err)
+			}
+			checkNoItem(t, err, logs, "secret-title")
+			checkNoItem(t, ce, logs, "secret-title")
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains functions for building Table objects from the live table schema.
+package dynamo
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DescribeTable returns a Table describing the existing table named tableName,
+// including its keys, secondary indexes, billing mode and capacity, table class,
+// encryption key, deletion protection, stream, time to live attribute, point in
+// time recovery, item count and size. Tags are not read.
+// Returns an error matching ErrTableNotFound if the table does not exist.
+func DescribeTable(svc dynamodbiface.DynamoDBAPI, tableName string) (*Table, error) {
+	return DescribeTableWithContext(context.Background(), svc, tableName)
+}
+
+// DescribeTableWithContext is the same as DescribeTable with the addition of the
+// ability to pass a context.
+func DescribeTableWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, tableName string) (*Table, error) {
+	var result *dynamodb.DescribeTableOutput
+	err := withRetry(ctx, DefaultRetryPolicy, "DescribeTable", tableName, func() (err error) {
+		result, err = svc.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+		return err
+	})
+	if err != nil {
+		logErr("DescribeTable", tableName, err)
+		return nil, ctxOpErr(ctx, "DescribeTable", tableName, err)
+	}
+	t := tableFromDescription(result.Table)
+
+	var ttl *dynamodb.DescribeTimeToLiveOutput
+	err = withRetry(ctx, DefaultRetryPolicy, "DescribeTimeToLive", tableName, func() (err error) {
+		ttl, err = svc.DescribeTimeToLiveWithContext(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tableName)})
+		return err
+	})
+	if err != nil {
+		logErr("DescribeTimeToLive", tableName, err)
+		return nil, ctxOpErr(ctx, "DescribeTimeToLive", tableName, err)
+	}
+	if d := ttl.TimeToLiveDescription; d != nil {
+		switch aws.StringValue(d.TimeToLiveStatus) {
+		case dynamodb.TimeToLiveStatusEnabled, dynamodb.TimeToLiveStatusEnabling:
+			t.TTLAttributeName = aws.StringValue(d.AttributeName)
+		}
+	}
+
+	var backups *dynamodb.DescribeContinuousBackupsOutput
+	err = withRetry(ctx, DefaultRetryPolicy, "DescribeContinuousBackups", tableName, func() (err error) {
+		backups, err = svc.DescribeContinuousBackupsWithContext(ctx, &dynamodb.DescribeContinuousBackupsInput{TableName: aws.String(tableName)})
+		return err
+	})
+	if err != nil {
+		logErr("DescribeContinuousBackups", tableName, err)
+		return nil, ctxOpErr(ctx, "DescribeContinuousBackups", tableName, err)
+	}
+	if d := backups.ContinuousBackupsDescription; d != nil && d.PointInTimeRecoveryDescription != nil {
+		status := aws.StringValue(d.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus)
+		t.PointInTimeRecovery = status == dynamodb.PointInTimeRecoveryStatusEnabled
+	}
+
+	logger().Debug("described table", slog.String("op", "DescribeTable"), slog.String("table", tableName))
+	return t, nil
+}
+
+// LoadTables lists the tables of d.Svc and adds a Table describing each of them
+// to d.Tables, replacing any Table with the same name.
+func (d *DbInfo) LoadTables(ctx context.Context) error {
+	names, _, err := ListTablesWithContext(ctx, d.Svc)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		t, err := DescribeTableWithContext(ctx, d.Svc, name)
+		if err != nil {
+			return err
+		}
+		d.AddTable(t)
+	}
+	return nil
+}
+
+// tableFromDescription converts a TableDescription to a Table.
+func tableFromDescription(desc *dynamodb.TableDescription) *Table {
+	types := map[string]string{}
+	for _, def := range desc.AttributeDefinitions {
+		types[aws.StringValue(def.AttributeName)] = aws.StringValue(def.AttributeType)
+	}
+	keys := func(ks []*dynamodb.KeySchemaElement) (pk, pt, sk, st string) {
+		for _, k := range ks {
+			name := aws.StringValue(k.AttributeName)
+			if aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash {
+				pk, pt = name, types[name]
+			} else {
+				sk, st = name, types[name]
+			}
+		}
+		return pk, pt, sk, st
+	}
+
+	t := &Table{
+		TableName:          aws.StringValue(desc.TableName),
+		BillingMode:        dynamodb.BillingModeProvisioned, // tables created before on-demand have no summary
+		DeletionProtection: aws.BoolValue(desc.DeletionProtectionEnabled),
+		ItemCount:          aws.Int64Value(desc.ItemCount),
+		SizeBytes:          aws.Int64Value(desc.TableSizeBytes),
+	}
+	t.PrimaryKeyName, t.PrimaryKeyType, t.SortKeyName, t.SortKeyType = keys(desc.KeySchema)
+	if desc.BillingModeSummary != nil && desc.BillingModeSummary.BillingMode != nil {
+		t.BillingMode = *desc.BillingModeSummary.BillingMode
+	}
+	provisioned := t.BillingMode == dynamodb.BillingModeProvisioned
+	if pt := desc.ProvisionedThroughput; pt != nil && provisioned {
+		t.ReadCapacityUnits, t.WriteCapacityUnits = aws.Int64Value(pt.ReadCapacityUnits), aws.Int64Value(pt.WriteCapacityUnits)
+	}
+	if desc.TableClassSummary != nil {
+		t.TableClass = aws.StringValue(desc.TableClassSummary.TableClass)
+	}
+	if sse := desc.SSEDescription; sse != nil && aws.StringValue(sse.SSEType) == dynamodb.SSETypeKms {
+		t.KMSKeyID = aws.StringValue(sse.KMSMasterKeyArn)
+	}
+	if ss := desc.StreamSpecification; ss != nil && aws.BoolValue(ss.StreamEnabled) {
+		t.StreamViewType = aws.StringValue(ss.StreamViewType)
+	}
+
+	for _, g := range desc.GlobalSecondaryIndexes {
+		idx := &Index{IndexName: aws.StringValue(g.IndexName)}
+		idx.PrimaryKeyName, idx.PrimaryKeyType, idx.SortKeyName, idx.SortKeyType = keys(g.KeySchema)
+		setProjection(idx, g.Projection)
+		if pt := g.ProvisionedThroughput; pt != nil && provisioned {
+			idx.ReadCapacityUnits, idx.WriteCapacityUnits = aws.Int64Value(pt.ReadCapacityUnits), aws.Int64Value(pt.WriteCapacityUnits)
+		}
+		t.GlobalIndexes = append(t.GlobalIndexes, idx)
+	}
+	for _, l := range desc.LocalSecondaryIndexes {
+		idx := &Index{IndexName: aws.StringValue(l.IndexName)}
+		_, _, idx.SortKeyName, idx.SortKeyType = keys(l.KeySchema)
+		setProjection(idx, l.Projection)
+		t.LocalIndexes = append(t.LocalIndexes, idx)
+	}
+	return t
+}
+
+// setProjection sets the projection of idx from p.
+func setProjection(idx *Index, p *dynamodb.Projection) {
+	if p == nil {
+		return
+	}
+	idx.ProjectionType = aws.StringValue(p.ProjectionType)
+	if len(p.NonKeyAttributes) > 0 {
+		idx.NonKeyAttributes = aws.StringValueSlice(p.NonKeyAttributes)
+	}
+}
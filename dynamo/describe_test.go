@@ -0,0 +1,77 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+func TestDescribeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	full := &Table{
+		TableName: "things", PrimaryKeyName: "ID", PrimaryKeyType: "S", SortKeyName: "Sort", SortKeyType: "N",
+		GlobalIndexes: []*Index{
+			{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S", SortKeyName: "Sort", SortKeyType: "N",
+				ProjectionType: "ALL", ReadCapacityUnits: 2, WriteCapacityUnits: 3},
+			{IndexName: "ByOwner", PrimaryKeyName: "Owner", PrimaryKeyType: "B",
+				ProjectionType: "INCLUDE", NonKeyAttributes: []string{"Title", "Body"}, ReadCapacityUnits: 4, WriteCapacityUnits: 5},
+		},
+		LocalIndexes: []*Index{
+			{IndexName: "ByDate", SortKeyName: "Date", SortKeyType: "S", ProjectionType: "KEYS_ONLY"},
+		},
+		TTLAttributeName:    "Expires",
+		PointInTimeRecovery: true,
+		BillingMode:         "PROVISIONED", ReadCapacityUnits: 10, WriteCapacityUnits: 20,
+		TableClass:         "STANDARD_INFREQUENT_ACCESS",
+		DeletionProtection: true,
+		StreamViewType:     "NEW_IMAGE",
+	}
+	minimal := &Table{TableName: "things", PrimaryKeyName: "ID", PrimaryKeyType: "N",
+		GlobalIndexes: []*Index{{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S"}}}
+	minimalWant := *minimal
+	minimalWant.BillingMode, minimalWant.TableClass = "PAY_PER_REQUEST", "STANDARD"
+	minimalWant.GlobalIndexes = []*Index{{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S", ProjectionType: "ALL"}}
+
+	tests := []struct {
+		name          string
+		desired, want *Table
+	}{
+		{"all settings", full, full},
+		{"defaults", minimal, &minimalWant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := dynamotest.New()
+			// Reconcile creates the table and applies the time to live and point in time recovery settings
+			if _, err := Reconcile(ctx, f, tt.desired, &ReconcileOptions{PollInterval: time.Millisecond}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DescribeTableWithContext(ctx, f, "things")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", describeString(got), describeString(tt.want))
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("described table fails Validate: %v", err)
+			}
+			if changes, err := Reconcile(ctx, f, got, &ReconcileOptions{DryRun: true}); err != nil || len(changes) != 0 {
+				t.Errorf("reconciling the described table: got %v, %v, want no changes", changes, err)
+			}
+		})
+	}
+}
+
+// describeString formats t and its indexes for test failures.
+func describeString(t *Table) string {
+	s := fmt.Sprintf("%+v", *t)
+	for _, idx := range append(append([]*Index{}, t.GlobalIndexes...), t.LocalIndexes...) {
+		s += fmt.Sprintf("\n\t%+v", *idx)
+	}
+	return s
+}
@@ -5,18 +5,29 @@
 package dynamo
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 
 	"github.com/aws/aws-sdk-go/aws"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 // InitSesh initializes a new session with default config/credentials.
+// The returned client satisfies dynamodbiface.DynamoDBAPI and can be passed
+// to any of the functions in this package. Its own retries are disabled, as the
+// functions of this package retry failed requests as decided by a RetryPolicy;
+// clients created otherwise should set aws.Config.MaxRetries to 0.
 func InitSesh() *dynamodb.DynamoDB {
 	// Initialize a session that the SDK will use to load
 	// credentials from the shared credentials file ~/.aws/credentials
@@ -24,46 +35,41 @@ func InitSesh() *dynamodb.DynamoDB {
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 
-	fmt.Println("session intialized")
-	fmt.Println("region: ", aws.StringValue(sesh.Config.Region))
+	logger().Info("session initialized", slog.String("region", aws.StringValue(sesh.Config.Region)))
 
-	// Create DynamoDB client
-	svc := dynamodb.New(sesh)
+	// Create DynamoDB client, leaving retries to this package
+	svc := dynamodb.New(sesh, aws.NewConfig().WithMaxRetries(0))
 
-	fmt.Println("DynamoDB client initialized")
-	fmt.Println()
+	logger().Info("DynamoDB client initialized")
 
 	return svc
 }
 
 // ListTables lists the tables in the database.
-func ListTables(svc *dynamodb.DynamoDB) ([]string, int, error) {
+func ListTables(svc dynamodbiface.DynamoDBAPI) ([]string, int, error) {
+	return ListTablesWithContext(context.Background(), svc)
+}
+
+// ListTablesWithContext is the same as ListTables with the addition of the
+// ability to pass a context. Cancelling ctx interrupts pagination and returns ctx.Err().
+func ListTablesWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI) ([]string, int, error) {
 	names := []string{}
 	t := 0
 	input := &dynamodb.ListTablesInput{}
-	fmt.Println("Tables:")
 
 	for {
 		// Get the list of tables
-		result, err := svc.ListTables(input)
+		var result *dynamodb.ListTablesOutput
+		err := withRetry(ctx, DefaultRetryPolicy, "ListTables", "", func() (err error) {
+			result, err = svc.ListTablesWithContext(ctx, input)
+			return err
+		})
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				case dynamodb.ErrCodeInternalServerError:
-					fmt.Println(dynamodb.ErrCodeInternalServerError, aerr.Error())
-				default:
-					fmt.Println(aerr.Error())
-				}
-			} else {
-				// Print the error, cast err to awserr.Error to get the Code
-				// and Message from the error
-				fmt.Println(err.Error())
-			}
-			return nil, 0, fmt.Errorf("ListTables failed: %v", err)
+			logErr("ListTables", "", err)
+			return nil, 0, ctxOpErr(ctx, "ListTables", "", err)
 		}
 
 		for _, n := range result.TableNames {
-			fmt.Println(*n)
 			names = append(names, *n)
 			t++
 		}
@@ -77,291 +83,440 @@ func ListTables(svc *dynamodb.DynamoDB) ([]string, int, error) {
 			break
 		}
 	}
+	logger().Debug("listed tables", slog.String("op", "ListTables"), slog.Int("count", t))
 	return names, t, nil
 }
 
-// CreateTable creates a new table with the parameters passed to the Table struct.
-// NOTE: CreateTable creates Table in * On-Demand * billing mode.
-func CreateTable(svc *dynamodb.DynamoDB, table *Table) error {
+// CreateTable creates a new table with the parameters passed to the Table struct,
+// including its GlobalIndexes and LocalIndexes. A Table with no SortKeyName is
+// created with a partition key only.
+// NOTE: CreateTable creates Table in * On-Demand * billing mode unless
+// BillingMode is "PROVISIONED".
+// Returns an error matching ErrInvalidTable if table fails Validate, or
+// ErrTableExists if the table already exists.
+func CreateTable(svc dynamodbiface.DynamoDBAPI, table *Table) error {
+	return CreateTableWithContext(context.Background(), svc, table)
+}
+
+// CreateTableWithContext is the same as CreateTable with the addition of the
+// ability to pass a context.
+func CreateTableWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, table *Table) error {
+	if err := table.Validate(); err != nil {
+		return opErr("CreateTable", table.TableName, err)
+	}
+
+	defs := &attrDefs{}
+	defs.add(table.PrimaryKeyName, table.PrimaryKeyType)
+	defs.add(table.SortKeyName, table.SortKeyType)
+	for _, idx := range table.GlobalIndexes {
+		defs.add(idx.PrimaryKeyName, idx.PrimaryKeyType)
+		defs.add(idx.SortKeyName, idx.SortKeyType)
+	}
+	for _, idx := range table.LocalIndexes {
+		defs.add(idx.SortKeyName, idx.SortKeyType)
+	}
+
 	input := &dynamodb.CreateTableInput{
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{ // Primary Key
-				AttributeName: aws.String(table.PrimaryKeyName),
-				AttributeType: aws.String(table.PrimaryKeyType),
-			},
-			{
-				AttributeName: aws.String(table.SortKeyName),
-				AttributeType: aws.String(table.SortKeyType),
-			},
-		},
-		BillingMode: aws.String("PAY_PER_REQUEST"),
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String(table.PrimaryKeyName),
-				KeyType:       aws.String("HASH"),
-			},
-			{
-				AttributeName: aws.String(table.SortKeyName),
-				KeyType:       aws.String("RANGE"),
-			},
-		},
-		TableName: aws.String(table.TableName),
-	}
-
-	_, err := svc.CreateTable(input)
+		AttributeDefinitions:      defs.list,
+		BillingMode:               aws.String(table.billingMode()),
+		DeletionProtectionEnabled: aws.Bool(table.DeletionProtection),
+		GlobalSecondaryIndexes:    table.globalIndexes(),
+		KeySchema:                 keySchema(table.PrimaryKeyName, table.SortKeyName),
+		LocalSecondaryIndexes:     table.localIndexes(),
+		ProvisionedThroughput:     throughput(table.ReadCapacityUnits, table.WriteCapacityUnits),
+		TableName:                 aws.String(table.TableName),
+	}
+	if table.TableClass != "" {
+		input.TableClass = aws.String(table.TableClass)
+	}
+	if table.KMSKeyID != "" {
+		input.SSESpecification = &dynamodb.SSESpecification{
+			Enabled:        aws.Bool(true),
+			KMSMasterKeyId: aws.String(table.KMSKeyID),
+			SSEType:        aws.String(dynamodb.SSETypeKms),
+		}
+	}
+	if table.StreamViewType != "" {
+		input.StreamSpecification = &dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(table.StreamViewType),
+		}
+	}
+	for _, k := range sortedKeys(table.Tags) {
+		input.Tags = append(input.Tags, &dynamodb.Tag{Key: aws.String(k), Value: aws.String(table.Tags[k])})
+	}
+
+	// a retried request could fail with ErrTableExists after creating the table
+	err := withRetry(ctx, onceRetryPolicy{DefaultRetryPolicy}, "CreateTable", table.TableName, func() error {
+		_, err := svc.CreateTableWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			if awsErr.Code() == "ResourceInUseException" {
-				return fmt.Errorf(awsErr.Code())
-			}
-			fmt.Println("Got error calling CreateTable:")
-			// Get error details
-			fmt.Println("CreateTable failed:", awsErr.Code(), awsErr.Message())
-		} else {
-			fmt.Println(err.Error())
-			return fmt.Errorf("CreateTable failed: %v", err)
+		logErr("CreateTable", table.TableName, err)
+		if errCode(err) == dynamodb.ErrCodeResourceInUseException {
+			err = fmt.Errorf("%w: %w", ErrTableExists, err)
 		}
+		return ctxOpErr(ctx, "CreateTable", table.TableName, err)
 	}
 
-	fmt.Println("Created the table: ", table.TableName)
+	logger().Info("created table", slog.String("op", "CreateTable"), slog.String("table", table.TableName))
 	return nil
 }
 
-// CreateItem puts a new item in the table.
-func CreateItem(svc *dynamodb.DynamoDB, item interface{}, table *Table) error {
-	av, err := dynamodbattribute.MarshalMap(item)
+// UpdateBillingMode switches the existing table t to billing mode mode,
+// "PAY_PER_REQUEST" or "PROVISIONED", and sets t.BillingMode. When switching to
+// PROVISIONED, the ReadCapacityUnits and WriteCapacityUnits of t and of each of
+// its GlobalIndexes are applied, so they must be set first. When switching to
+// PAY_PER_REQUEST, they are cleared. DynamoDB allows a table to switch to
+// PAY_PER_REQUEST once per 24 hours.
+func UpdateBillingMode(svc dynamodbiface.DynamoDBAPI, t *Table, mode string) error {
+	return UpdateBillingModeWithContext(context.Background(), svc, t, mode)
+}
+
+// UpdateBillingModeWithContext is the same as UpdateBillingMode with the addition of the
+// ability to pass a context.
+func UpdateBillingModeWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, mode string) error {
+	next := *t
+	next.BillingMode = mode
+	if mode != "PROVISIONED" {
+		next.ReadCapacityUnits, next.WriteCapacityUnits = 0, 0
+		next.GlobalIndexes = nil
+		for _, idx := range t.GlobalIndexes {
+			c := *idx
+			c.ReadCapacityUnits, c.WriteCapacityUnits = 0, 0
+			next.GlobalIndexes = append(next.GlobalIndexes, &c)
+		}
+	}
+	if err := next.Validate(); err != nil {
+		return opErr("UpdateTable", t.TableName, err)
+	}
+
+	input := &dynamodb.UpdateTableInput{
+		BillingMode:           aws.String(next.billingMode()),
+		ProvisionedThroughput: throughput(next.ReadCapacityUnits, next.WriteCapacityUnits),
+		TableName:             aws.String(t.TableName),
+	}
+	if mode == "PROVISIONED" {
+		for _, idx := range t.GlobalIndexes {
+			input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, &dynamodb.GlobalSecondaryIndexUpdate{
+				Update: &dynamodb.UpdateGlobalSecondaryIndexAction{
+					IndexName:             aws.String(idx.IndexName),
+					ProvisionedThroughput: throughput(idx.ReadCapacityUnits, idx.WriteCapacityUnits),
+				},
+			})
+		}
+	}
+
+	err := withRetry(ctx, DefaultRetryPolicy, "UpdateTable", t.TableName, func() error {
+		_, err := svc.UpdateTableWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
-		fmt.Println("Got error marshalling new movie item: ")
-		fmt.Println(err.Error())
-		return fmt.Errorf("CreateItem failed: %v", err)
+		logErr("UpdateTable", t.TableName, err)
+		return ctxOpErr(ctx, "UpdateTable", t.TableName, err)
+	}
+	t.BillingMode = mode
+	if mode != "PROVISIONED" {
+		t.ReadCapacityUnits, t.WriteCapacityUnits = 0, 0
+		for _, idx := range t.GlobalIndexes {
+			idx.ReadCapacityUnits, idx.WriteCapacityUnits = 0, 0
+		}
 	}
 
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(table.TableName),
+	logger().Info("updated billing mode", slog.String("op", "UpdateTable"), slog.String("table", t.TableName),
+		slog.String("billing_mode", next.billingMode()))
+	return nil
+}
+
+// billingMode returns the BillingMode of t, which defaults to PAY_PER_REQUEST.
+func (t *Table) billingMode() string {
+	if t.BillingMode == "" {
+		return dynamodb.BillingModePayPerRequest
 	}
+	return t.BillingMode
+}
 
-	_, err = svc.PutItem(input)
+// CreateItem puts a new item in the table.
+// If the table has a VersionAttributeName, the item replaces the stored one only if
+// the stored version equals item's, and is stored with its version incremented; a
+// version of 0 creates a new item. If item is a pointer to a struct, its version
+// field is then set to the stored version. Returns an error matching
+// ErrVersionConflict if the stored version differs.
+func CreateItem(svc dynamodbiface.DynamoDBAPI, item interface{}, table *Table) error {
+	return CreateItemWithContext(context.Background(), svc, item, table)
+}
+
+// CreateItemWithContext is the same as CreateItem with the addition of the
+// ability to pass a context.
+func CreateItemWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, item interface{}, table *Table) error {
+	return putItem(ctx, svc, DefaultRetryPolicy, item, table, nil)
+}
+
+// putItem puts item in table t, if c is met when c is not nil, checking and
+// incrementing its version if t has a version attribute, in which case item's
+// version field is set to the stored version. Failed requests are retried as decided by p.
+func putItem(ctx context.Context, svc dynamodbiface.DynamoDBAPI, p RetryPolicy, item interface{}, t *Table, c *Condition) error {
+	input, version, err := putInput(t, item, c)
 	if err != nil {
-		fmt.Println("Got error calling PutItem:")
-		fmt.Println(err.Error())
-		return fmt.Errorf("CreateItem failed: %v", err)
+		logErr("CreateItem", t.TableName, err)
+		return opErr("CreateItem", t.TableName, err)
 	}
 
-	fmt.Printf("Successfully added item to table %s\n", table.TableName)
+	if version != nil {
+		p = onceRetryPolicy{p} // a retried request could fail on the version it incremented
+	}
+	err = withRetry(ctx, p, "CreateItem", t.TableName, func() error {
+		_, err := svc.PutItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("CreateItem", t.TableName, err)
+		err = writeErr(ctx, "CreateItem", t.TableName, err)
+		if version != nil {
+			return versionErr(t, err, *version)
+		}
+		return err
+	}
+	if version != nil {
+		setItemVersion(t, item, *version+1)
+	}
+
+	logger().Debug("put item", slog.String("op", "CreateItem"), slog.String("table", t.TableName))
 	return nil
 }
 
+// putInput builds the PutItemInput putting item in table t if c is met when c is not nil.
+// If t has a version attribute, it returns the version expected to be stored.
+func putInput(t *Table, item interface{}, c *Condition) (*dynamodb.PutItemInput, *int64, error) {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:                                av,
+		ReturnValuesOnConditionCheckFailure: c.returnValues(),
+		TableName:                           aws.String(t.TableName),
+	}
+	var version *int64
+	if t.VersionAttributeName != "" {
+		v, err := itemVersion(t, av)
+		if err != nil {
+			return nil, nil, err
+		}
+		version = &v
+		av[t.VersionAttributeName] = (&dynamodb.AttributeValue{}).SetN(strconv.FormatInt(v+1, 10))
+		input.ReturnValuesOnConditionCheckFailure = aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld)
+	}
+	if cond, ok := writeCondition(t, c, version); ok {
+		expr, err := expression.NewBuilder().WithCondition(cond).Build()
+		if err != nil {
+			return nil, nil, err
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+	return input, version, nil
+}
+
 // GetItem reads an item from the database.
-// Returns Attribute Value map interface (map[stirng]interface{}) if object found.
-// Returns interface of type item if object not found.
-func GetItem(svc *dynamodb.DynamoDB, q *Query, t *Table, item interface{}) (interface{}, error) {
-	key := keyMaker(q, t)
-	result, err := svc.GetItem(&dynamodb.GetItemInput{
+// If item is a non-nil pointer, the object found is unmarshaled into it and item is
+// returned; if item is another value, a new value of its type is returned; if item
+// is nil, a map[string]interface{} is returned.
+// Returns an error matching ErrNotFound if object not found.
+func GetItem(svc dynamodbiface.DynamoDBAPI, q *Query, t *Table, item interface{}) (interface{}, error) {
+	return GetItemWithContext(context.Background(), svc, q, t, item)
+}
+
+// GetItemWithContext is the same as GetItem with the addition of the
+// ability to pass a context.
+func GetItemWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, q *Query, t *Table, item interface{}) (interface{}, error) {
+	input := &dynamodb.GetItemInput{
 		TableName: aws.String(t.TableName),
-		Key:       key,
+		Key:       keyMaker(q, t),
+	}
+	var result *dynamodb.GetItemOutput
+	err := withRetry(ctx, DefaultRetryPolicy, "GetItem", t.TableName, func() (err error) {
+		result, err = svc.GetItemWithContext(ctx, input)
+		return err
 	})
 	if err != nil {
-		fmt.Println(err.Error())
-		return nil, fmt.Errorf("GetItem failed: %v", err)
+		logErr("GetItem", t.TableName, err)
+		return nil, ctxOpErr(ctx, "GetItem", t.TableName, err)
+	}
+	if result.Item == nil {
+		return nil, opErr("GetItem", t.TableName, ErrNotFound)
 	}
 
-	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	out, err := unmarshalItem(result.Item, item)
 	if err != nil {
-		fmt.Printf("Failed to unmarshal record, %v\n", err)
-		return nil, fmt.Errorf("GetItem failed: Failed to unmarshal record, %v", err)
+		logErr("GetItem", t.TableName, err)
+		return nil, opErr("GetItem", t.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
 	}
 
-	return item, nil
+	return out, nil
 }
 
 // UpdateItem updates the specified item's attribute defined in the
 // Query object with the UpdateValue defined in the Query.
-func UpdateItem(svc *dynamodb.DynamoDB, q *Query, t *Table) error {
-	exprMap := make(map[string]*dynamodb.AttributeValue)
-	exprMap[":u"] = createAV(q.UpdateValue)
-	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeValues: exprMap,
-		TableName:                 aws.String(t.TableName),
-		Key:                       keyMaker(q, t),
-		ReturnValues:              aws.String("UPDATED_NEW"),
-		UpdateExpression:          aws.String(fmt.Sprintf("set %s = :u", q.UpdateFieldName)),
-	}
-
-	_, err := svc.UpdateItem(input)
+// UpdateFieldName may be a document path such as "Info.Rating".
+// Use UpdateItemWith to apply several actions at once.
+func UpdateItem(svc dynamodbiface.DynamoDBAPI, q *Query, t *Table) error {
+	return UpdateItemWithContext(context.Background(), svc, q, t)
+}
+
+// UpdateItemWithContext is the same as UpdateItem with the addition of the
+// ability to pass a context.
+func UpdateItemWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, q *Query, t *Table) error {
+	return updateItem(ctx, svc, q, t, nil)
+}
+
+// updateItem sets q's UpdateFieldName to its UpdateValue, if c is met when c is not nil.
+func updateItem(ctx context.Context, svc dynamodbiface.DynamoDBAPI, q *Query, t *Table, c *Condition) error {
+	// values of the types handled by createAV keep their historical encoding
+	v := q.UpdateValue
+	if av := createAV(q.UpdateValue); av != nil {
+		v = av
+	}
+	u := NewUpdate().Set(q.UpdateFieldName, v).Return("UPDATED_NEW").If(c)
+	input, err := updateInput(t, keyMaker(q, t), u)
+	if err != nil {
+		return opErr("UpdateItem", t.TableName, err)
+	}
+
+	err = withRetry(ctx, updateRetryPolicy(DefaultRetryPolicy, t, u), "UpdateItem", t.TableName, func() error {
+		_, err := svc.UpdateItemWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
-		fmt.Println(err.Error())
-		return fmt.Errorf("UpdateItem failed: %v", err)
+		logErr("UpdateItem", t.TableName, err)
+		err = writeErr(ctx, "UpdateItem", t.TableName, err)
+		if v := u.expectedVersion(t); v != nil {
+			return versionErr(t, err, *v)
+		}
+		return err
 	}
 
-	fmt.Printf("Updated %v: %v: %s = %v\n", q.PrimaryValue, q.SortValue, q.UpdateFieldName, q.UpdateValue)
+	logger().Debug("updated item", slog.String("op", "UpdateItem"), slog.String("table", t.TableName),
+		slog.String("field", q.UpdateFieldName))
 	return nil
 }
 
 // DeleteTable deletes the selected table.
-func DeleteTable(svc *dynamodb.DynamoDB, t *Table) error {
+func DeleteTable(svc dynamodbiface.DynamoDBAPI, t *Table) error {
+	return DeleteTableWithContext(context.Background(), svc, t)
+}
+
+// DeleteTableWithContext is the same as DeleteTable with the addition of the
+// ability to pass a context.
+func DeleteTableWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table) error {
 	input := &dynamodb.DeleteTableInput{
 		TableName: aws.String(t.TableName),
 	}
-	_, err := svc.DeleteTable(input)
+	err := withRetry(ctx, DefaultRetryPolicy, "DeleteTable", t.TableName, func() error {
+		_, err := svc.DeleteTableWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
-		fmt.Println(err.Error())
-		return fmt.Errorf("DeleteTable failed: %v", err)
+		logErr("DeleteTable", t.TableName, err)
+		return ctxOpErr(ctx, "DeleteTable", t.TableName, err)
 	}
-	fmt.Println("Deleted Table: ", t.TableName)
+	logger().Info("deleted table", slog.String("op", "DeleteTable"), slog.String("table", t.TableName))
 	return nil
 }
 
 // DeleteItem deletes the specified item defined in the Query
-func DeleteItem(svc *dynamodb.DynamoDB, q *Query, t *Table) error {
+func DeleteItem(svc dynamodbiface.DynamoDBAPI, q *Query, t *Table) error {
+	return DeleteItemWithContext(context.Background(), svc, q, t)
+}
+
+// DeleteItemWithContext is the same as DeleteItem with the addition of the
+// ability to pass a context.
+func DeleteItemWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, q *Query, t *Table) error {
 	input := &dynamodb.DeleteItemInput{
 		Key:       keyMaker(q, t),
 		TableName: aws.String(t.TableName),
 	}
 
-	_, err := svc.DeleteItem(input)
+	err := withRetry(ctx, DefaultRetryPolicy, "DeleteItem", t.TableName, func() error {
+		_, err := svc.DeleteItemWithContext(ctx, input)
+		return err
+	})
 	if err != nil {
-		fmt.Println("Got error calling DeleteItem")
-		fmt.Println(err.Error())
-		return fmt.Errorf("DeleteItem failed: %v", err)
+		logErr("DeleteItem", t.TableName, err)
+		return ctxOpErr(ctx, "DeleteItem", t.TableName, err)
 	}
 
-	fmt.Printf("Deleted %s: %s from table %s\n", q.PrimaryValue, q.SortValue, t.TableName)
+	logger().Debug("deleted item", slog.String("op", "DeleteItem"), slog.String("table", t.TableName))
 	return nil
 }
 
 // BatchWriteCreate writes a list of items to the database.
-func BatchWriteCreate(svc *dynamodb.DynamoDB, t *Table, fc *FailConfig, items []interface{}) error {
-	if len(items) > 25 {
-		return fmt.Errorf("too many items to process")
-	}
-
-	// create map of RequestItems
-	reqItems := make(map[string][]*dynamodb.WriteRequest)
-	wrs := []*dynamodb.WriteRequest{}
-
-	// create PutRequests for each item
-	for _, item := range items {
-		if item == nil {
-			fmt.Println("nil item")
-			continue
-		}
+// At most 25 items may be given; use BatchPut to write any number of items.
+// If an item is repeated, by primary key, only its last occurrence is written.
+// Failed requests are retried as decided by p, such as a *FailConfig or a *Backoff;
+// if nil, DefaultRetryPolicy is used.
+func BatchWriteCreate(svc dynamodbiface.DynamoDBAPI, t *Table, p RetryPolicy, items []interface{}) error {
+	return BatchWriteCreateWithContext(context.Background(), svc, t, p, items)
+}
 
-		// marshal each item
-		av, err := dynamodbattribute.MarshalMap(item)
-		if err != nil {
-			fmt.Println("*** err item: ", item)
-			return fmt.Errorf("BatchWriteCreate failed: %v", err)
-		}
-		// create put request, reformat as write request, and add to list
-		pr := &dynamodb.PutRequest{Item: av}
-		wr := &dynamodb.WriteRequest{PutRequest: pr}
-		wrs = append(wrs, wr)
+// BatchWriteCreateWithContext is the same as BatchWriteCreate with the addition of the
+// ability to pass a context. Cancelling ctx interrupts both the in-flight request
+// and any backoff wait between retries, and returns ctx.Err().
+func BatchWriteCreateWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, p RetryPolicy, items []interface{}) error {
+	if len(items) > 25 {
+		return opErr("BatchWriteCreate", t.TableName, ErrTooManyItems)
 	}
-	// populate reqItems map
-	reqItems[t.TableName] = wrs
 
-	// generate input from reqItems map
-	input := &dynamodb.BatchWriteItemInput{
-		RequestItems: reqItems,
+	// create PutRequests for each item, dropping repeated items
+	reqs, err := putWrites("BatchWriteCreate", t, items, nil)
+	if err != nil {
+		return err
 	}
+	reqItems := map[string][]*dynamodb.WriteRequest{t.TableName: writeRequests(dedupeWrites(reqs))}
 
-	// batch write and error handling with exponential backoff retries for HTTP 5xx errors
-	var result *dynamodb.BatchWriteItemOutput
-	var err error
-	for {
-		result, err = batchWriteUtil(svc, input)
-		if err != nil {
-			// if not HTTP 5xx error
-			if err.(awserr.Error).Code() != dynamodb.ErrCodeInternalServerError {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedItems)
-				// return fmt.Errorf("BatchWriteCreate failed: %v", err)
-				return err
-			}
-
-			// Retry with exponential backoff algorithm
-			if err.(awserr.Error).Code() == dynamodb.ErrCodeInternalServerError && result.UnprocessedItems != nil {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedItems)
-				input = &dynamodb.BatchWriteItemInput{
-					RequestItems: result.UnprocessedItems,
-				}
-				fmt.Println("retrying...")
-				fc.ExponentialBackoff() // waits
-				if fc.MaxRetriesReached == true {
-					return fmt.Errorf("BatchWriteCreate failed: Max retries exceeded: %v", err)
-				}
-			}
-		}
-
-		if len(result.UnprocessedItems) == 0 {
-			fc.Reset() // reset configuration after loop
-			break
+	// batch write, retrying failed requests and unprocessed items with backoff
+	if left, err := writeChunk(ctx, svc, retryPolicy(p), "BatchWriteCreate", reqItems); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-
+		return &UnprocessedError{Op: "BatchWriteCreate", Table: t.TableName, Items: left, Err: err}
 	}
 
 	return nil
 }
 
 // BatchWriteDelete deletes a list of items from the database.
-func BatchWriteDelete(svc *dynamodb.DynamoDB, t *Table, fc *FailConfig, queries []*Query) error {
-	if len(queries) > 25 {
-		return fmt.Errorf("too many items to process")
-	}
-
-	// create map of RequestItems
-	reqItems := make(map[string][]*dynamodb.WriteRequest)
-	wrs := []*dynamodb.WriteRequest{}
-
-	// create PutRequests for each item
-	for _, q := range queries {
-		if q == nil {
-			continue
-		}
+// At most 25 items may be given; use BatchDelete to delete any number of items.
+// Repeated keys are deleted once.
+// Failed requests are retried as decided by p, such as a *FailConfig or a *Backoff;
+// if nil, DefaultRetryPolicy is used.
+func BatchWriteDelete(svc dynamodbiface.DynamoDBAPI, t *Table, p RetryPolicy, queries []*Query) error {
+	return BatchWriteDeleteWithContext(context.Background(), svc, t, p, queries)
+}
 
-		// create put request, reformat as write request, and add to list
-		dr := &dynamodb.DeleteRequest{Key: keyMaker(q, t)}
-		wr := &dynamodb.WriteRequest{DeleteRequest: dr}
-		wrs = append(wrs, wr)
+// BatchWriteDeleteWithContext is the same as BatchWriteDelete with the addition of the
+// ability to pass a context. Cancelling ctx interrupts both the in-flight request
+// and any backoff wait between retries, and returns ctx.Err().
+func BatchWriteDeleteWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, p RetryPolicy, queries []*Query) error {
+	if len(queries) > 25 {
+		return opErr("BatchWriteDelete", t.TableName, ErrTooManyItems)
 	}
-	// populate reqItems map
-	reqItems[t.TableName] = wrs
 
-	// generate input from reqItems map
-	input := &dynamodb.BatchWriteItemInput{
-		RequestItems: reqItems,
+	// create DeleteRequests for each key, dropping repeated keys
+	reqs, err := deleteWrites("BatchWriteDelete", t, queries, nil)
+	if err != nil {
+		return err
 	}
+	reqItems := map[string][]*dynamodb.WriteRequest{t.TableName: writeRequests(dedupeWrites(reqs))}
 
-	// batch write and error handling with exponential backoff retries for HTTP 5xx errors
-	var result *dynamodb.BatchWriteItemOutput
-	var err error
-	for {
-		result, err = batchWriteUtil(svc, input)
-		if err != nil {
-			// if not HTTP 5xx error
-			if err.(awserr.Error).Code() != dynamodb.ErrCodeInternalServerError {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedItems)
-				return fmt.Errorf("BatchWriteDelete failed: %v", err)
-			}
-
-			// Retry with exponential backoff algorithm
-			if err.(awserr.Error).Code() == dynamodb.ErrCodeInternalServerError && result.UnprocessedItems != nil {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedItems)
-				input = &dynamodb.BatchWriteItemInput{
-					RequestItems: result.UnprocessedItems,
-				}
-				fc.ExponentialBackoff() // waits
-				if fc.MaxRetriesReached == true {
-					return fmt.Errorf("BatchWriteDelete failed: Max retries exceeded: %v", err)
-				}
-			}
+	// batch write, retrying failed requests and unprocessed items with backoff
+	if left, err := writeChunk(ctx, svc, retryPolicy(p), "BatchWriteDelete", reqItems); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-
-		if len(result.UnprocessedItems) == 0 {
-			fc.Reset() // reset configuration after loop
-			break
-		}
-
+		return &UnprocessedError{Op: "BatchWriteDelete", Table: t.TableName, Items: left, Err: err}
 	}
 
 	return nil
@@ -370,143 +525,192 @@ func BatchWriteDelete(svc *dynamodb.DynamoDB, t *Table, fc *FailConfig, queries
 // BatchGet retrieves a list of items from the database
 // refObjs must be non-nil pointers of the same type,
 // 1 for each query/object returned.
+// The returned slice holds one entry per query, in the same order as queries:
+// refObjs[i] with the item unmarshaled into it if it exists, else nil.
+// Repeated keys are fetched once and keys are requested 100 at a time.
+// Failed requests are retried as decided by p, such as a *FailConfig or a *Backoff;
+// if nil, DefaultRetryPolicy is used.
 //   - Returns err if len(queries) != len(refObjs).
-func BatchGet(svc *dynamodb.DynamoDB, t *Table, fc *FailConfig, queries []*Query, refObjs []interface{}) ([]interface{}, error) {
-	if len(queries) > 100 {
-		return nil, fmt.Errorf("too many items to process")
-	}
+func BatchGet(svc dynamodbiface.DynamoDBAPI, t *Table, p RetryPolicy, queries []*Query, refObjs []interface{}) ([]interface{}, error) {
+	return BatchGetWithContext(context.Background(), svc, t, p, queries, refObjs)
+}
 
+// BatchGetWithContext is the same as BatchGet with the addition of the
+// ability to pass a context. Cancelling ctx interrupts both the in-flight request
+// and any backoff wait between retries, and returns ctx.Err().
+func BatchGetWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, p RetryPolicy, queries []*Query, refObjs []interface{}) ([]interface{}, error) {
 	if len(queries) != len(refObjs) {
-		return nil, fmt.Errorf("number of queries does not match number of reference objects")
+		return nil, opErr("BatchGet", t.TableName, fmt.Errorf("number of queries does not match number of reference objects"))
 	}
 
-	items := []interface{}{}
-
-	// create map of RequestItems
-	reqItems := make(map[string]*dynamodb.KeysAndAttributes)
-	keys := []map[string]*dynamodb.AttributeValue{}
-
-	// create Get requests for each query
-	for _, q := range queries {
+	// collect the unique keys, remembering the key of each query
+	order := make([]string, len(queries))
+	unique := []map[string]*dynamodb.AttributeValue{}
+	seen := map[string]bool{}
+	for i, q := range queries {
 		if q == nil {
 			continue
 		}
-
-		item := keyMaker(q, t)
-		keys = append(keys, item)
-	}
-	// populate reqItems map
-	ka := &dynamodb.KeysAndAttributes{Keys: keys}
-	reqItems[t.TableName] = ka
-
-	// generate input from reqItems map
-	input := &dynamodb.BatchGetItemInput{
-		RequestItems: reqItems,
+		key := keyMaker(q, t)
+		ks := keyString(t, key)
+		order[i] = ks
+		if !seen[ks] {
+			seen[ks] = true
+			unique = append(unique, key)
+		}
 	}
 
-	// batch write and error handling with exponential backoff retries for HTTP 5xx errors
-	var result *dynamodb.BatchGetItemOutput
-	var err error
-	for {
-		result, err = batchGetUtil(svc, input)
+	p = retryPolicy(p)
+	found := map[string]map[string]*dynamodb.AttributeValue{}
+	for start := 0; start < len(unique); start += maxBatchGetKeys {
+		end := start + maxBatchGetKeys
+		if end > len(unique) {
+			end = len(unique)
+		}
+		avs, err := batchGetAll(ctx, svc, p, "BatchGet", t, unique[start:end])
 		if err != nil {
-			// if not HTTP 5xx error
-			if err.(awserr.Error).Code() != dynamodb.ErrCodeInternalServerError {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedKeys)
-				return nil, fmt.Errorf("BatchGet failed: %v", err)
-			}
-			if err.(awserr.Error).Code() == "ValidationException" {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedKeys)
-				return nil, err
-			}
-			if err.(awserr.Error).Code() == "RequestError" {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedKeys)
-				return nil, err
-			}
-
-			// Retry with exponential backoff algorithm
-			if err.(awserr.Error).Code() == dynamodb.ErrCodeInternalServerError && result.UnprocessedKeys != nil {
-				fmt.Printf("unprocessed items: \n%v\n", result.UnprocessedKeys)
-				input = &dynamodb.BatchGetItemInput{
-					RequestItems: result.UnprocessedKeys,
-				}
-				fc.ExponentialBackoff() // waits
-				if fc.MaxRetriesReached == true {
-					return nil, fmt.Errorf("BatchGet failed: Max retries exceeded: %v", err)
-				}
-			}
+			return nil, err
 		}
-
-		for i, r := range result.Responses[t.TableName] {
-			ref := refObjs[i]
-			err = dynamodbattribute.UnmarshalMap(r, &ref)
-			if err != nil {
-				fmt.Printf("Failed to unmarshal record, %v\n", err)
-				return nil, fmt.Errorf("BatchGet failed: Failed to unmarshal record, %v", err)
-			}
-			items = append(items, ref)
+		for _, av := range avs {
+			found[keyString(t, av)] = av
 		}
+	}
 
-		if len(result.UnprocessedKeys) == 0 {
-			fc.Reset() // reset configuration after loop
-			break
+	items := make([]interface{}, len(queries))
+	for i, ks := range order {
+		av, ok := found[ks]
+		if queries[i] == nil || !ok {
+			continue // not found
 		}
-
+		if err := dynamodbattribute.UnmarshalMap(av, refObjs[i]); err != nil {
+			logErr("BatchGet", t.TableName, err)
+			return nil, opErr("BatchGet", t.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
+		}
+		items[i] = refObjs[i]
 	}
 
 	return items, nil
 }
 
-func batchWriteUtil(svc *dynamodb.DynamoDB, input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
-	result, err := svc.BatchWriteItem(input)
+func batchWriteUtil(ctx context.Context, svc dynamodbiface.DynamoDBAPI, input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	result, err := svc.BatchWriteItemWithContext(ctx, input)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case dynamodb.ErrCodeProvisionedThroughputExceededException:
-				fmt.Println(dynamodb.ErrCodeProvisionedThroughputExceededException, aerr.Error())
-			case dynamodb.ErrCodeResourceNotFoundException:
-				fmt.Println(dynamodb.ErrCodeResourceNotFoundException, aerr.Error())
-			case dynamodb.ErrCodeItemCollectionSizeLimitExceededException:
-				fmt.Println(dynamodb.ErrCodeItemCollectionSizeLimitExceededException, aerr.Error())
-			case dynamodb.ErrCodeRequestLimitExceeded:
-				fmt.Println(dynamodb.ErrCodeRequestLimitExceeded, aerr.Error())
-			case dynamodb.ErrCodeInternalServerError:
-				fmt.Println(dynamodb.ErrCodeInternalServerError, aerr.Error())
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+		for name, wrs := range input.RequestItems {
+			logCall("BatchWriteItem", name, err, slog.Int("requests", len(wrs)))
 		}
 	}
 	return result, err
 }
 
-func batchGetUtil(svc *dynamodb.DynamoDB, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
-	result, err := svc.BatchGetItem(input)
+func batchGetUtil(ctx context.Context, svc dynamodbiface.DynamoDBAPI, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	result, err := svc.BatchGetItemWithContext(ctx, input)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case dynamodb.ErrCodeProvisionedThroughputExceededException:
-				fmt.Println(dynamodb.ErrCodeProvisionedThroughputExceededException, aerr.Error())
-			case dynamodb.ErrCodeResourceNotFoundException:
-				fmt.Println(dynamodb.ErrCodeResourceNotFoundException, aerr.Error())
-			case dynamodb.ErrCodeItemCollectionSizeLimitExceededException:
-				fmt.Println(dynamodb.ErrCodeItemCollectionSizeLimitExceededException, aerr.Error())
-			case dynamodb.ErrCodeRequestLimitExceeded:
-				fmt.Println(dynamodb.ErrCodeRequestLimitExceeded, aerr.Error())
-			case dynamodb.ErrCodeInternalServerError:
-				fmt.Println(dynamodb.ErrCodeInternalServerError, aerr.Error())
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+		for name, ka := range input.RequestItems {
+			logCall("BatchGetItem", name, err, slog.Int("requests", len(ka.Keys)))
 		}
 	}
 	return result, err
 }
+
+// batchGetAll gets keys from table t, retrying failed requests and unprocessed keys
+// as decided by p until every key has been processed. keys must be unique and hold
+// at most 100 keys. Items that do not exist are absent from the result.
+func batchGetAll(ctx context.Context, svc dynamodbiface.DynamoDBAPI, p RetryPolicy, op string, t *Table, keys []map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, error) {
+	avs, left, err := getChunk(ctx, svc, p, op, map[string]*dynamodb.KeysAndAttributes{t.TableName: {Keys: keys}})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &UnprocessedError{Op: op, Table: t.TableName, Keys: left, Err: err}
+	}
+	return avs[t.TableName], nil
+}
+
+// unmarshalItem unmarshals av into item and returns item if it is a non-nil
+// pointer, else unmarshals av into a new value of item's type, or a
+// map[string]interface{} if item is nil, and returns it.
+func unmarshalItem(av map[string]*dynamodb.AttributeValue, item interface{}) (interface{}, error) {
+	if item == nil {
+		var m map[string]interface{}
+		err := dynamodbattribute.UnmarshalMap(av, &m)
+		return m, err
+	}
+	rv := reflect.ValueOf(item)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		return item, dynamodbattribute.UnmarshalMap(av, item)
+	}
+	out := reflect.New(rv.Type())
+	if err := dynamodbattribute.UnmarshalMap(av, out.Interface()); err != nil {
+		return nil, err
+	}
+	return out.Elem().Interface(), nil
+}
+
+// itemKey extracts the primary key attributes of table t from a marshaled item.
+func itemKey(t *Table, av map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	key := map[string]*dynamodb.AttributeValue{}
+	for _, k := range []string{t.PrimaryKeyName, t.SortKeyName} {
+		if k == "" {
+			continue
+		}
+		v, ok := av[k]
+		if !ok || v == nil || v.NULL != nil {
+			return nil, fmt.Errorf("item has no value for key attribute %q", k)
+		}
+		if v.S == nil && v.N == nil && v.B == nil {
+			return nil, fmt.Errorf("key attribute %q is not a string, number or binary", k)
+		}
+		key[k] = v
+	}
+	return key, nil
+}
+
+// keyString encodes the primary key attributes of av for use as a map key.
+func keyString(t *Table, av map[string]*dynamodb.AttributeValue) string {
+	var b strings.Builder
+	for _, k := range []string{t.PrimaryKeyName, t.SortKeyName} {
+		v := av[k]
+		if k == "" || v == nil {
+			continue
+		}
+		switch {
+		case v.S != nil:
+			fmt.Fprintf(&b, "S%d:%s|", len(*v.S), *v.S)
+		case v.N != nil:
+			fmt.Fprintf(&b, "N%d:%s|", len(*v.N), *v.N)
+		case v.B != nil:
+			fmt.Fprintf(&b, "B%d:%s|", len(v.B), v.B)
+		}
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeCount returns the number of write requests in a RequestItems map.
+func writeCount(m map[string][]*dynamodb.WriteRequest) int {
+	n := 0
+	for _, wrs := range m {
+		n += len(wrs)
+	}
+	return n
+}
+
+// keyCount returns the number of keys in a RequestItems map.
+func keyCount(m map[string]*dynamodb.KeysAndAttributes) int {
+	n := 0
+	for _, ka := range m {
+		if ka != nil {
+			n += len(ka.Keys)
+		}
+	}
+	return n
+}
@@ -0,0 +1,303 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+type thing struct {
+	ID    string
+	Sort  int
+	Title string
+}
+
+// newTestTable returns a Fake holding the empty table "things" keyed by ID and Sort.
+// DefaultRetryPolicy is replaced for the duration of the test so that retries don't wait.
+func newTestTable(t *testing.T) (*dynamotest.Fake, *Table) {
+	t.Helper()
+	saved := DefaultRetryPolicy
+	DefaultRetryPolicy = &Backoff{Base: time.Microsecond, MaxAttempts: 3}
+	t.Cleanup(func() { DefaultRetryPolicy = saved })
+
+	f := dynamotest.New()
+	tb, err := NewTable("things", "ID", "string", "Sort", "int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTable(f, tb); err != nil {
+		t.Fatal(err)
+	}
+	return f, tb
+}
+
+// checkRetry makes the next call of op fail with an error carrying code and runs
+// call. If retried, call must retry that failure and succeed; else it must
+// return an error after calling op once.
+func checkRetry(t *testing.T, f *dynamotest.Fake, op, code string, retried bool, call func() error) {
+	t.Helper()
+	before := f.Calls(op)
+	f.FailNext(op, code, 1)
+	err := call()
+	want := map[bool]int{true: 2, false: 1}[retried]
+	if calls := f.Calls(op) - before; calls != want || (err == nil) != retried {
+		t.Errorf("%s failing with %s: got %d calls and error %v, want %d calls", op, code, calls, err, want)
+	}
+}
+
+func TestCRUD(t *testing.T) {
+	f, tb := newTestTable(t)
+
+	if err := CreateItem(f, thing{ID: "a", Sort: 1, Title: "first"}, tb); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetItem(f, CreateNewQueryObj("a", 1), tb, thing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th := got.(thing); th.Title != "first" {
+		t.Errorf("got %+v, want Title first", th)
+	}
+
+	q := CreateNewQueryObj("a", 1)
+	q.UpdateCurrent("Title", "second")
+	if err := UpdateItem(f, q, tb); err != nil {
+		t.Fatal(err)
+	}
+	var th thing
+	got, err = GetItem(f, CreateNewQueryObj("a", 1), tb, &th)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != &th || th.Title != "second" {
+		t.Errorf("got %v, want &th with Title second", got)
+	}
+	got, err = GetItem(f, CreateNewQueryObj("a", 1), tb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := got.(map[string]interface{}); m["Title"] != "second" {
+		t.Errorf("got %v, want a map with Title second", m)
+	}
+
+	if err := DeleteItem(f, CreateNewQueryObj("a", 1), tb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetItem(f, CreateNewQueryObj("a", 1), tb, thing{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	f, tb := newTestTable(t)
+	ctx := context.Background()
+
+	var items []interface{}
+	var queries []*Query
+	for i := 0; i < 60; i++ {
+		items = append(items, thing{ID: fmt.Sprint("id", i%7), Sort: i})
+		queries = append(queries, CreateNewQueryObj(fmt.Sprint("id", i%7), i))
+	}
+	f.InjectFault(dynamotest.Fault{Op: "BatchWriteItem", Unprocessed: 5})
+	res, err := BatchPut(ctx, f, tb, items, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded != 60 || len(f.Items("things")) != 60 {
+		t.Fatalf("got %d succeeded, %d stored, want 60", res.Succeeded, len(f.Items("things")))
+	}
+
+	// one missing key, and results in query order
+	queries = append(queries[:3], append([]*Query{CreateNewQueryObj("missing", 0)}, queries[3:]...)...)
+	refs := make([]interface{}, len(queries))
+	for i := range refs {
+		refs[i] = &thing{}
+	}
+	got, err := BatchGetWithContext(ctx, f, tb, nil, queries, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, q := range queries {
+		if i == 3 {
+			if got[i] != nil {
+				t.Errorf("got %v for missing key, want nil", got[i])
+			}
+			continue
+		}
+		if th := got[i].(*thing); th.ID != q.PrimaryValue || th.Sort != q.SortValue {
+			t.Errorf("result %d: got %+v, want key %v/%v", i, th, q.PrimaryValue, q.SortValue)
+		}
+	}
+
+	if _, err := BatchDelete(ctx, f, tb, queries, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.Items("things")); n != 0 {
+		t.Errorf("got %d items after delete, want 0", n)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		code  string
+		times int
+		want  error // nil if the call succeeds after retrying
+	}{
+		{code: dynamodb.ErrCodeResourceNotFoundException, times: 1, want: ErrTableNotFound},
+		{code: dynamodb.ErrCodeConditionalCheckFailedException, times: 1, want: ErrConditionFailed},
+		{code: dynamodb.ErrCodeTransactionConflictException, times: 1, want: ErrTransactionConflict},
+		{code: dynamodb.ErrCodeProvisionedThroughputExceededException, times: 2},
+		{code: dynamodb.ErrCodeProvisionedThroughputExceededException, times: 3, want: ErrThrottled},
+		{code: dynamodb.ErrCodeRequestLimitExceeded, times: 3, want: ErrMaxRetries},
+		{code: dynamodb.ErrCodeInternalServerError, times: 2},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.code, "x", tt.times), func(t *testing.T) {
+			f, tb := newTestTable(t)
+			f.FailNext("PutItem", tt.code, tt.times)
+			err := CreateItem(f, thing{ID: "a", Sort: 1}, tb)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if errCode(err) != tt.code {
+				t.Errorf("got code %q, want %q", errCode(err), tt.code)
+			}
+		})
+	}
+
+	f, tb := newTestTable(t)
+	if err := CreateTable(f, tb); !errors.Is(err, ErrTableExists) || !errors.Is(err, ErrResourceInUse) {
+		t.Errorf("CreateTable: got %v, want ErrTableExists", err)
+	}
+	f.FailNext("DeleteTable", dynamodb.ErrCodeResourceInUseException, 1)
+	if err := DeleteTable(f, tb); !errors.Is(err, ErrResourceInUse) || errors.Is(err, ErrTableExists) {
+		t.Errorf("DeleteTable: got %v, want ErrResourceInUse only", err)
+	}
+}
+
+// createRecorder records the last CreateTableInput sent to the Fake.
+type createRecorder struct {
+	*dynamotest.Fake
+	input *dynamodb.CreateTableInput
+}
+
+func (r *createRecorder) CreateTableWithContext(ctx aws.Context, input *dynamodb.CreateTableInput, opts ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	r.input = input
+	return r.Fake.CreateTableWithContext(ctx, input, opts...)
+}
+
+func TestCreateTableOptions(t *testing.T) {
+	r := &createRecorder{Fake: dynamotest.New()}
+	tb, err := NewTable("things", "ID", "string", "Sort", "int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.BillingMode, tb.ReadCapacityUnits, tb.WriteCapacityUnits = "PROVISIONED", 5, 10
+	tb.GlobalIndexes = []*Index{{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S", ReadCapacityUnits: 1, WriteCapacityUnits: 2}}
+	tb.TableClass = "STANDARD_INFREQUENT_ACCESS"
+	tb.KMSKeyID = "alias/things"
+	tb.StreamViewType = "NEW_AND_OLD_IMAGES"
+	tb.DeletionProtection = true
+	tb.Tags = map[string]string{"team": "core", "env": "test"}
+	if err := CreateTable(r, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	var tags []string
+	for _, tag := range r.input.Tags {
+		tags = append(tags, aws.StringValue(tag.Key)+"="+aws.StringValue(tag.Value))
+	}
+	if want := []string{"env=test", "team=core"}; !slices.Equal(tags, want) {
+		t.Errorf("got tags %v, want %v", tags, want)
+	}
+	if sse := r.input.SSESpecification; sse == nil || aws.StringValue(sse.SSEType) != dynamodb.SSETypeKms || aws.StringValue(sse.KMSMasterKeyId) != "alias/things" {
+		t.Errorf("got SSESpecification %v, want KMS with alias/things", sse)
+	}
+
+	got, err := DescribeTable(r, "things")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BillingMode != "PROVISIONED" || got.ReadCapacityUnits != 5 || got.WriteCapacityUnits != 10 {
+		t.Errorf("got billing %s %d/%d, want PROVISIONED 5/10", got.BillingMode, got.ReadCapacityUnits, got.WriteCapacityUnits)
+	}
+	if idx := got.GlobalIndexes[0]; idx.ReadCapacityUnits != 1 || idx.WriteCapacityUnits != 2 {
+		t.Errorf("got index capacity %d/%d, want 1/2", idx.ReadCapacityUnits, idx.WriteCapacityUnits)
+	}
+	if got.TableClass != tb.TableClass || got.StreamViewType != tb.StreamViewType || !got.DeletionProtection {
+		t.Errorf("got class %q, stream %q, deletion protection %v", got.TableClass, got.StreamViewType, got.DeletionProtection)
+	}
+	if !strings.HasSuffix(got.KMSKeyID, ":alias/things") {
+		t.Errorf("got KMS key %q, want the ARN of alias/things", got.KMSKeyID)
+	}
+
+	// defaults: on-demand, DynamoDB owned key, no stream and no tags
+	others, _ := NewTable("others", "ID", "string", "", "")
+	if err := CreateTable(r, others); err != nil {
+		t.Fatal(err)
+	}
+	if in := r.input; aws.StringValue(in.BillingMode) != dynamodb.BillingModePayPerRequest || in.ProvisionedThroughput != nil ||
+		in.SSESpecification != nil || in.StreamSpecification != nil || in.Tags != nil || in.TableClass != nil {
+		t.Errorf("got input %v, want defaults", in)
+	}
+}
+
+func TestUpdateBillingMode(t *testing.T) {
+	f, tb := newTestTable(t)
+	if err := CreateGlobalIndex(f, tb, &Index{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpdateBillingMode(f, tb, "PROVISIONED"); !errors.Is(err, ErrInvalidTable) {
+		t.Fatalf("without capacity: got %v, want ErrInvalidTable", err)
+	}
+	if tb.BillingMode != "" {
+		t.Errorf("got BillingMode %q after a failed update, want unchanged", tb.BillingMode)
+	}
+
+	tb.ReadCapacityUnits, tb.WriteCapacityUnits = 3, 4
+	tb.GlobalIndexes[0].ReadCapacityUnits, tb.GlobalIndexes[0].WriteCapacityUnits = 1, 2
+	if err := UpdateBillingMode(f, tb, "PROVISIONED"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DescribeTable(f, "things")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BillingMode != "PROVISIONED" || got.ReadCapacityUnits != 3 || got.WriteCapacityUnits != 4 ||
+		got.GlobalIndexes[0].ReadCapacityUnits != 1 || got.GlobalIndexes[0].WriteCapacityUnits != 2 {
+		t.Errorf("described %+v, index %+v, want PROVISIONED 3/4 and 1/2", got, got.GlobalIndexes[0])
+	}
+
+	if err := UpdateBillingMode(f, tb, "PAY_PER_REQUEST"); err != nil {
+		t.Fatal(err)
+	}
+	if tb.BillingMode != "PAY_PER_REQUEST" || tb.ReadCapacityUnits != 0 || tb.GlobalIndexes[0].WriteCapacityUnits != 0 {
+		t.Errorf("got %+v, index %+v, want capacity cleared", tb, tb.GlobalIndexes[0])
+	}
+	if got, err = DescribeTable(f, "things"); err != nil {
+		t.Fatal(err)
+	}
+	if got.BillingMode != "PAY_PER_REQUEST" || got.ReadCapacityUnits != 0 || got.GlobalIndexes[0].ReadCapacityUnits != 0 {
+		t.Errorf("described %+v, want PAY_PER_REQUEST without capacity", got)
+	}
+	if err := tb.Validate(); err != nil {
+		t.Errorf("Validate after the update: %v", err)
+	}
+}
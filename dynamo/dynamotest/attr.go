@@ -0,0 +1,262 @@
+// Package dynamotest provides an in-memory implementation of the DynamoDB API
+// for testing code built on the dynamo package without network access.
+// This file contains helpers for copying, comparing and encoding AttributeValues.
+package dynamotest
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// item is a single stored table item.
+type item map[string]*dynamodb.AttributeValue
+
+// cloneAV returns a deep copy of av.
+func cloneAV(av *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if av == nil {
+		return nil
+	}
+	c := &dynamodb.AttributeValue{}
+	if av.B != nil {
+		c.B = append([]byte{}, av.B...)
+	}
+	if av.BOOL != nil {
+		c.BOOL = boolPtr(*av.BOOL)
+	}
+	if av.BS != nil {
+		c.BS = make([][]byte, len(av.BS))
+		for i, b := range av.BS {
+			c.BS[i] = append([]byte{}, b...)
+		}
+	}
+	if av.L != nil {
+		c.L = make([]*dynamodb.AttributeValue, len(av.L))
+		for i, v := range av.L {
+			c.L[i] = cloneAV(v)
+		}
+	}
+	if av.M != nil {
+		c.M = cloneItem(av.M)
+	}
+	if av.N != nil {
+		c.N = strPtr(*av.N)
+	}
+	if av.NS != nil {
+		c.NS = cloneStrings(av.NS)
+	}
+	if av.NULL != nil {
+		c.NULL = boolPtr(*av.NULL)
+	}
+	if av.S != nil {
+		c.S = strPtr(*av.S)
+	}
+	if av.SS != nil {
+		c.SS = cloneStrings(av.SS)
+	}
+	return c
+}
+
+// cloneItem returns a deep copy of m.
+func cloneItem(m map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]*dynamodb.AttributeValue, len(m))
+	for k, v := range m {
+		c[k] = cloneAV(v)
+	}
+	return c
+}
+
+func cloneStrings(ss []*string) []*string {
+	c := make([]*string, len(ss))
+	for i, s := range ss {
+		c[i] = strPtr(*s)
+	}
+	return c
+}
+
+func strPtr(s string) *string { return &s }
+
+func boolPtr(b bool) *bool { return &b }
+
+// avType returns the DynamoDB type descriptor of av ("S", "N", "M"...).
+func avType(av *dynamodb.AttributeValue) string {
+	switch {
+	case av == nil:
+		return ""
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.B != nil:
+		return "B"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.NULL != nil:
+		return "NULL"
+	case av.M != nil:
+		return "M"
+	case av.L != nil:
+		return "L"
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	}
+	return ""
+}
+
+// parseNumber parses a DynamoDB number string.
+func parseNumber(s string) (*big.Float, error) {
+	f, _, err := big.ParseFloat(strings.TrimSpace(s), 10, 128, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+// formatNumber formats f as a canonical DynamoDB number string.
+func formatNumber(f *big.Float) string {
+	if f.IsInt() {
+		i, _ := f.Int(nil)
+		return i.String()
+	}
+	return f.Text('g', -1)
+}
+
+// canonicalNumber normalizes s so that equal numbers encode identically.
+func canonicalNumber(s string) string {
+	f, err := parseNumber(s)
+	if err != nil {
+		return s
+	}
+	return formatNumber(f)
+}
+
+// compareAV orders two scalar values of the same type.
+// ok is false if the values are not comparable.
+func compareAV(a, b *dynamodb.AttributeValue) (c int, ok bool) {
+	ta, tb := avType(a), avType(b)
+	if ta != tb {
+		return 0, false
+	}
+	switch ta {
+	case "S":
+		return strings.Compare(*a.S, *b.S), true
+	case "N":
+		fa, err := parseNumber(*a.N)
+		if err != nil {
+			return 0, false
+		}
+		fb, err := parseNumber(*b.N)
+		if err != nil {
+			return 0, false
+		}
+		return fa.Cmp(fb), true
+	case "B":
+		return bytes.Compare(a.B, b.B), true
+	}
+	return 0, false
+}
+
+// equalAV reports whether a and b hold the same value.
+// Sets are compared regardless of element order.
+func equalAV(a, b *dynamodb.AttributeValue) bool {
+	ta, tb := avType(a), avType(b)
+	if ta != tb {
+		return false
+	}
+	switch ta {
+	case "":
+		return true
+	case "S", "N", "B":
+		c, _ := compareAV(a, b)
+		return c == 0
+	case "BOOL":
+		return *a.BOOL == *b.BOOL
+	case "NULL":
+		return *a.NULL == *b.NULL
+	case "M":
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for k, v := range a.M {
+			w, ok := b.M[k]
+			if !ok || !equalAV(v, w) {
+				return false
+			}
+		}
+		return true
+	case "L":
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equalAV(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	as, bs := setMembers(a), setMembers(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	for k := range as {
+		if _, ok := bs[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// setMembers returns the canonical encodings of the members of a set value.
+func setMembers(av *dynamodb.AttributeValue) map[string]struct{} {
+	m := make(map[string]struct{})
+	switch avType(av) {
+	case "SS":
+		for _, s := range av.SS {
+			m[*s] = struct{}{}
+		}
+	case "NS":
+		for _, n := range av.NS {
+			m[canonicalNumber(*n)] = struct{}{}
+		}
+	case "BS":
+		for _, b := range av.BS {
+			m[string(b)] = struct{}{}
+		}
+	}
+	return m
+}
+
+// encodeKeyValue encodes a scalar key attribute so that equal keys encode identically.
+func encodeKeyValue(av *dynamodb.AttributeValue) string {
+	switch avType(av) {
+	case "S":
+		return "S:" + *av.S
+	case "N":
+		return "N:" + canonicalNumber(*av.N)
+	case "B":
+		return fmt.Sprintf("B:%x", av.B)
+	}
+	return ""
+}
+
+// sortedNames returns the keys of m in sorted order.
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
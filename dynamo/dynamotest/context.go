@@ -0,0 +1,171 @@
+// Package dynamotest provides an in-memory implementation of the DynamoDB API
+// for testing code built on the dynamo package without network access.
+// This file contains the WithContext variants of the Fake client's operations.
+package dynamotest
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// canceled returns the error the SDK reports for a request whose context is done, or nil.
+func canceled(ctx aws.Context) error {
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return nil
+}
+
+// CreateTableWithContext is the same as CreateTable, but fails if ctx is done.
+func (f *Fake) CreateTableWithContext(ctx aws.Context, input *dynamodb.CreateTableInput, _ ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.CreateTableOutput{}, err
+	}
+	return f.CreateTable(input)
+}
+
+// DeleteTableWithContext is the same as DeleteTable, but fails if ctx is done.
+func (f *Fake) DeleteTableWithContext(ctx aws.Context, input *dynamodb.DeleteTableInput, _ ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.DeleteTableOutput{}, err
+	}
+	return f.DeleteTable(input)
+}
+
+// DescribeTableWithContext is the same as DescribeTable, but fails if ctx is done.
+func (f *Fake) DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, _ ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.DescribeTableOutput{}, err
+	}
+	return f.DescribeTable(input)
+}
+
+// DescribeTimeToLiveWithContext is the same as DescribeTimeToLive, but fails if ctx is done.
+func (f *Fake) DescribeTimeToLiveWithContext(ctx aws.Context, input *dynamodb.DescribeTimeToLiveInput, _ ...request.Option) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.DescribeTimeToLiveOutput{}, err
+	}
+	return f.DescribeTimeToLive(input)
+}
+
+// UpdateTableWithContext is the same as UpdateTable, but fails if ctx is done.
+func (f *Fake) UpdateTableWithContext(ctx aws.Context, input *dynamodb.UpdateTableInput, _ ...request.Option) (*dynamodb.UpdateTableOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.UpdateTableOutput{}, err
+	}
+	return f.UpdateTable(input)
+}
+
+// UpdateTimeToLiveWithContext is the same as UpdateTimeToLive, but fails if ctx is done.
+func (f *Fake) UpdateTimeToLiveWithContext(ctx aws.Context, input *dynamodb.UpdateTimeToLiveInput, _ ...request.Option) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.UpdateTimeToLiveOutput{}, err
+	}
+	return f.UpdateTimeToLive(input)
+}
+
+// DescribeContinuousBackupsWithContext is the same as DescribeContinuousBackups, but fails if ctx is done.
+func (f *Fake) DescribeContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.DescribeContinuousBackupsInput, _ ...request.Option) (*dynamodb.DescribeContinuousBackupsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.DescribeContinuousBackupsOutput{}, err
+	}
+	return f.DescribeContinuousBackups(input)
+}
+
+// UpdateContinuousBackupsWithContext is the same as UpdateContinuousBackups, but fails if ctx is done.
+func (f *Fake) UpdateContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.UpdateContinuousBackupsInput, _ ...request.Option) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.UpdateContinuousBackupsOutput{}, err
+	}
+	return f.UpdateContinuousBackups(input)
+}
+
+// ListTablesWithContext is the same as ListTables, but fails if ctx is done.
+func (f *Fake) ListTablesWithContext(ctx aws.Context, input *dynamodb.ListTablesInput, _ ...request.Option) (*dynamodb.ListTablesOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.ListTablesOutput{}, err
+	}
+	return f.ListTables(input)
+}
+
+// PutItemWithContext is the same as PutItem, but fails if ctx is done.
+func (f *Fake) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.PutItemOutput{}, err
+	}
+	return f.PutItem(input)
+}
+
+// GetItemWithContext is the same as GetItem, but fails if ctx is done.
+func (f *Fake) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.GetItemOutput{}, err
+	}
+	return f.GetItem(input)
+}
+
+// UpdateItemWithContext is the same as UpdateItem, but fails if ctx is done.
+func (f *Fake) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.UpdateItemOutput{}, err
+	}
+	return f.UpdateItem(input)
+}
+
+// DeleteItemWithContext is the same as DeleteItem, but fails if ctx is done.
+func (f *Fake) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.DeleteItemOutput{}, err
+	}
+	return f.DeleteItem(input)
+}
+
+// BatchWriteItemWithContext is the same as BatchWriteItem, but fails if ctx is done.
+func (f *Fake) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, _ ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.BatchWriteItemOutput{}, err
+	}
+	return f.BatchWriteItem(input)
+}
+
+// BatchGetItemWithContext is the same as BatchGetItem, but fails if ctx is done.
+func (f *Fake) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.BatchGetItemOutput{}, err
+	}
+	return f.BatchGetItem(input)
+}
+
+// QueryWithContext is the same as Query, but fails if ctx is done.
+func (f *Fake) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.QueryOutput{}, err
+	}
+	return f.Query(input)
+}
+
+// ScanWithContext is the same as Scan, but fails if ctx is done.
+func (f *Fake) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.ScanOutput{}, err
+	}
+	return f.Scan(input)
+}
+
+// TransactWriteItemsWithContext is the same as TransactWriteItems, but fails if ctx is done.
+func (f *Fake) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.TransactWriteItemsOutput{}, err
+	}
+	return f.TransactWriteItems(input)
+}
+
+// TransactGetItemsWithContext is the same as TransactGetItems, but fails if ctx is done.
+func (f *Fake) TransactGetItemsWithContext(ctx aws.Context, input *dynamodb.TransactGetItemsInput, _ ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
+	if err := canceled(ctx); err != nil {
+		return &dynamodb.TransactGetItemsOutput{}, err
+	}
+	return f.TransactGetItems(input)
+}
@@ -0,0 +1,1200 @@
+// Package dynamotest provides an in-memory implementation of the DynamoDB API
+// for testing code built on the dynamo package without network access.
+// This file contains a parser and evaluator for DynamoDB condition, key condition,
+// filter, projection and update expressions.
+package dynamotest
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// token kinds
+const (
+	tokEOF = iota
+	tokIdent
+	tokName   // #name placeholder
+	tokValue  // :value placeholder
+	tokNumber // list index
+	tokSymbol
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	toks := []token{}
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':' || isIdentRune(r) && !unicode.IsDigit(r):
+			j := i + 1
+			for j < len(rs) && isIdentRune(rs[j]) {
+				j++
+			}
+			kind := tokIdent
+			if r == '#' {
+				kind = tokName
+			} else if r == ':' {
+				kind = tokValue
+			}
+			if (kind != tokIdent) && j == i+1 {
+				return nil, fmt.Errorf("invalid token %q in expression", string(r))
+			}
+			toks = append(toks, token{kind, string(rs[i:j])})
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, string(rs[i:j])})
+			i = j
+		case r == '<' || r == '>':
+			if i+1 < len(rs) && (rs[i+1] == '=' || r == '<' && rs[i+1] == '>') {
+				toks = append(toks, token{tokSymbol, string(rs[i : i+2])})
+				i += 2
+				continue
+			}
+			toks = append(toks, token{tokSymbol, string(r)})
+			i++
+		case strings.ContainsRune("=(),.[]+-", r):
+			toks = append(toks, token{tokSymbol, string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid character %q in expression", string(r))
+		}
+	}
+	return append(toks, token{kind: tokEOF}), nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// pathElem is a single map key or list index in a document path.
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type docPath []pathElem
+
+func (p docPath) String() string {
+	sb := strings.Builder{}
+	for i, e := range p {
+		if e.isIndex {
+			fmt.Fprintf(&sb, "[%d]", e.index)
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(e.name)
+	}
+	return sb.String()
+}
+
+// exprContext holds the placeholder maps of a request and tracks their use.
+type exprContext struct {
+	names      map[string]*string
+	values     map[string]*dynamodb.AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newExprContext(names map[string]*string, values map[string]*dynamodb.AttributeValue) *exprContext {
+	return &exprContext{names, values, map[string]bool{}, map[string]bool{}}
+}
+
+// checkUnused returns an error if a placeholder was supplied but never referenced.
+func (c *exprContext) checkUnused() error {
+	for _, n := range sortedNames(c.names) {
+		if !c.usedNames[n] {
+			return fmt.Errorf("Value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", n)
+		}
+	}
+	for _, v := range sortedNames(c.values) {
+		if !c.usedValues[v] {
+			return fmt.Errorf("Value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", v)
+		}
+	}
+	return nil
+}
+
+type parser struct {
+	ctx  *exprContext
+	toks []token
+	pos  int
+}
+
+func newParser(ctx *exprContext, expr string) (*parser, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{ctx: ctx, toks: toks}, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return token{kind: tokEOF}
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isSymbol(s string) bool {
+	t := p.peek()
+	return t.kind == tokSymbol && t.text == s
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.isSymbol(s) {
+		return fmt.Errorf("syntax error; expected %q, got %q", s, p.peek().text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokEOF {
+		return fmt.Errorf("syntax error; unexpected token %q", t.text)
+	}
+	return nil
+}
+
+// pathName resolves a path element name or #placeholder.
+func (p *parser) pathName(t token) (string, error) {
+	switch t.kind {
+	case tokIdent:
+		if isReserved(t.text) {
+			return "", fmt.Errorf("Attribute name is a reserved keyword; reserved keyword: %s", t.text)
+		}
+		return t.text, nil
+	case tokName:
+		n, ok := p.ctx.names[t.text]
+		if !ok || n == nil {
+			return "", fmt.Errorf("An expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		p.ctx.usedNames[t.text] = true
+		return *n, nil
+	}
+	return "", fmt.Errorf("syntax error; expected attribute name, got %q", t.text)
+}
+
+func (p *parser) parsePath() (docPath, error) {
+	name, err := p.pathName(p.next())
+	if err != nil {
+		return nil, err
+	}
+	path := docPath{{name: name}}
+	for {
+		switch {
+		case p.isSymbol("."):
+			p.next()
+			name, err := p.pathName(p.next())
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{name: name})
+		case p.isSymbol("["):
+			p.next()
+			t := p.next()
+			if t.kind != tokNumber {
+				return nil, fmt.Errorf("syntax error; expected list index, got %q", t.text)
+			}
+			i, _ := strconv.Atoi(t.text)
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{index: i, isIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) value(t token) (*dynamodb.AttributeValue, error) {
+	v, ok := p.ctx.values[t.text]
+	if !ok || v == nil {
+		return nil, fmt.Errorf("An expression attribute value used in expression is not defined; attribute value: %s", t.text)
+	}
+	p.ctx.usedValues[t.text] = true
+	return v, nil
+}
+
+// operand is a value-producing node of an expression.
+type operand interface {
+	eval(it item) (*dynamodb.AttributeValue, error)
+}
+
+type pathOperand struct{ path docPath }
+
+func (o pathOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	return getPath(it, o.path), nil
+}
+
+type valueOperand struct{ av *dynamodb.AttributeValue }
+
+func (o valueOperand) eval(item) (*dynamodb.AttributeValue, error) { return o.av, nil }
+
+type sizeOperand struct{ path docPath }
+
+func (o sizeOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	av := getPath(it, o.path)
+	n := -1
+	switch avType(av) {
+	case "S":
+		n = len(*av.S)
+	case "B":
+		n = len(av.B)
+	case "SS":
+		n = len(av.SS)
+	case "NS":
+		n = len(av.NS)
+	case "BS":
+		n = len(av.BS)
+	case "M":
+		n = len(av.M)
+	case "L":
+		n = len(av.L)
+	}
+	if n < 0 {
+		return nil, nil
+	}
+	return &dynamodb.AttributeValue{N: strPtr(strconv.Itoa(n))}, nil
+}
+
+type ifNotExistsOperand struct {
+	path docPath
+	def  operand
+}
+
+func (o ifNotExistsOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	if av := getPath(it, o.path); av != nil {
+		return av, nil
+	}
+	return o.def.eval(it)
+}
+
+type listAppendOperand struct{ a, b operand }
+
+func (o listAppendOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	a, err := o.a.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.b.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	if avType(a) != "L" || avType(b) != "L" {
+		return nil, fmt.Errorf("Incorrect operand type for operator or function; operator or function: list_append")
+	}
+	l := append(append([]*dynamodb.AttributeValue{}, a.L...), b.L...)
+	return &dynamodb.AttributeValue{L: l}, nil
+}
+
+type arithOperand struct {
+	op   string
+	a, b operand
+}
+
+func (o arithOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	a, err := o.a.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.b.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	if avType(a) != "N" || avType(b) != "N" {
+		return nil, fmt.Errorf("An operand in the update expression has an incorrect data type")
+	}
+	fa, err := parseNumber(*a.N)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := parseNumber(*b.N)
+	if err != nil {
+		return nil, err
+	}
+	r := new(big.Float).SetPrec(128)
+	if o.op == "+" {
+		r.Add(fa, fb)
+	} else {
+		r.Sub(fa, fb)
+	}
+	return &dynamodb.AttributeValue{N: strPtr(formatNumber(r))}, nil
+}
+
+// parseOperand parses a path, value placeholder or size() call.
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokValue:
+		p.next()
+		av, err := p.value(t)
+		if err != nil {
+			return nil, err
+		}
+		return valueOperand{av}, nil
+	case t.kind == tokIdent && strings.EqualFold(t.text, "size") && p.peekAt(1).text == "(":
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return sizeOperand{path}, nil
+	case t.kind == tokIdent || t.kind == tokName:
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return pathOperand{path}, nil
+	}
+	return nil, fmt.Errorf("syntax error; unexpected token %q", t.text)
+}
+
+// condition is a boolean node of a condition or filter expression.
+type condition interface {
+	test(it item) (bool, error)
+}
+
+type andCond struct{ l, r condition }
+
+func (c andCond) test(it item) (bool, error) {
+	ok, err := c.l.test(it)
+	if err != nil || !ok {
+		return false, err
+	}
+	return c.r.test(it)
+}
+
+type orCond struct{ l, r condition }
+
+func (c orCond) test(it item) (bool, error) {
+	ok, err := c.l.test(it)
+	if err != nil || ok {
+		return ok, err
+	}
+	return c.r.test(it)
+}
+
+type notCond struct{ c condition }
+
+func (c notCond) test(it item) (bool, error) {
+	ok, err := c.c.test(it)
+	return !ok, err
+}
+
+type compareCond struct {
+	op   string
+	l, r operand
+}
+
+func (c compareCond) test(it item) (bool, error) {
+	l, err := c.l.eval(it)
+	if err != nil {
+		return false, err
+	}
+	r, err := c.r.eval(it)
+	if err != nil {
+		return false, err
+	}
+	if l == nil || r == nil {
+		return c.op == "<>" && (l != nil || r != nil), nil
+	}
+	switch c.op {
+	case "=":
+		return equalAV(l, r), nil
+	case "<>":
+		return !equalAV(l, r), nil
+	}
+	n, ok := compareAV(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return n < 0, nil
+	case "<=":
+		return n <= 0, nil
+	case ">":
+		return n > 0, nil
+	}
+	return n >= 0, nil
+}
+
+type betweenCond struct{ v, lo, hi operand }
+
+func (c betweenCond) test(it item) (bool, error) {
+	v, err := c.v.eval(it)
+	if err != nil {
+		return false, err
+	}
+	lo, err := c.lo.eval(it)
+	if err != nil {
+		return false, err
+	}
+	hi, err := c.hi.eval(it)
+	if err != nil {
+		return false, err
+	}
+	if n, ok := compareAV(lo, hi); ok && n > 0 {
+		return false, fmt.Errorf("Invalid KeyConditionExpression: The BETWEEN operator requires upper bound to be greater than or equal to lower bound")
+	}
+	a, ok := compareAV(v, lo)
+	if !ok {
+		return false, nil
+	}
+	b, ok := compareAV(v, hi)
+	return ok && a >= 0 && b <= 0, nil
+}
+
+type inCond struct {
+	v    operand
+	list []operand
+}
+
+func (c inCond) test(it item) (bool, error) {
+	v, err := c.v.eval(it)
+	if err != nil || v == nil {
+		return false, err
+	}
+	for _, o := range c.list {
+		w, err := o.eval(it)
+		if err != nil {
+			return false, err
+		}
+		if w != nil && equalAV(v, w) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type funcCond struct {
+	name string
+	path docPath
+	arg  operand
+}
+
+func (c funcCond) test(it item) (bool, error) {
+	av := getPath(it, c.path)
+	switch c.name {
+	case "attribute_exists":
+		return av != nil, nil
+	case "attribute_not_exists":
+		return av == nil, nil
+	}
+	arg, err := c.arg.eval(it)
+	if err != nil || av == nil || arg == nil {
+		return false, err
+	}
+	switch c.name {
+	case "attribute_type":
+		if arg.S == nil {
+			return false, fmt.Errorf("Incorrect operand type for operator or function; operator or function: attribute_type")
+		}
+		return avType(av) == *arg.S, nil
+	case "begins_with":
+		switch {
+		case av.S != nil && arg.S != nil:
+			return strings.HasPrefix(*av.S, *arg.S), nil
+		case av.B != nil && arg.B != nil:
+			return strings.HasPrefix(string(av.B), string(arg.B)), nil
+		}
+		return false, nil
+	case "contains":
+		switch avType(av) {
+		case "S":
+			return arg.S != nil && strings.Contains(*av.S, *arg.S), nil
+		case "B":
+			return arg.B != nil && strings.Contains(string(av.B), string(arg.B)), nil
+		case "SS", "NS", "BS":
+			_, ok := setMembers(av)[memberKey(arg)]
+			return ok, nil
+		case "L":
+			for _, e := range av.L {
+				if equalAV(e, arg) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("Invalid function name; function: %s", c.name)
+}
+
+// parseCondition parses a full condition expression.
+func parseCondition(ctx *exprContext, expr string) (condition, error) {
+	p, err := newParser(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *parser) parseOr() (condition, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orCond{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = andCond{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCond{c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.isSymbol("(") {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expectSymbol(")")
+	}
+
+	t := p.peek()
+	if t.kind == tokIdent && p.peekAt(1).text == "(" {
+		switch name := strings.ToLower(t.text); name {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			p.next()
+			p.next()
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			c := funcCond{name: name, path: path}
+			if name != "attribute_exists" && name != "attribute_not_exists" {
+				if err := p.expectSymbol(","); err != nil {
+					return nil, err
+				}
+				if c.arg, err = p.parseOperand(); err != nil {
+					return nil, err
+				}
+			}
+			return c, p.expectSymbol(")")
+		}
+	}
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.isKeyword("BETWEEN"):
+		p.next()
+		lo, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, fmt.Errorf("syntax error; expected AND in BETWEEN")
+		}
+		p.next()
+		hi, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCond{l, lo, hi}, nil
+	case p.isKeyword("IN"):
+		p.next()
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		c := inCond{v: l}
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			c.list = append(c.list, o)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
+		}
+		return c, p.expectSymbol(")")
+	}
+	op := p.next()
+	switch op.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("syntax error; expected comparator, got %q", op.text)
+	}
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareCond{op.text, l, r}, nil
+}
+
+// keyCondition is a parsed KeyConditionExpression.
+type keyCondition struct {
+	hashName  string
+	hashValue *dynamodb.AttributeValue
+	rangeName string
+	rangeCond condition // nil if the sort key is unconstrained
+}
+
+// parseKeyCondition parses a KeyConditionExpression against the given key names.
+func parseKeyCondition(ctx *exprContext, expr, hashName, rangeName string) (*keyCondition, error) {
+	c, err := parseCondition(ctx, expr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid KeyConditionExpression: %v", err)
+	}
+	parts := []condition{c}
+	if a, ok := c.(andCond); ok {
+		parts = []condition{a.l, a.r}
+		if _, nested := a.l.(andCond); nested {
+			return nil, fmt.Errorf("Invalid KeyConditionExpression: too many conditions")
+		}
+	}
+	kc := &keyCondition{hashName: hashName, rangeName: rangeName}
+	for _, part := range parts {
+		switch pc := part.(type) {
+		case compareCond:
+			po, ok := pc.l.(pathOperand)
+			vo, vok := pc.r.(valueOperand)
+			if !ok || !vok || len(po.path) != 1 {
+				return nil, fmt.Errorf("Invalid KeyConditionExpression: unsupported condition")
+			}
+			name := po.path[0].name
+			if name == hashName && pc.op == "=" && kc.hashValue == nil {
+				kc.hashValue = vo.av
+				continue
+			}
+			if name == rangeName && rangeName != "" && pc.op != "<>" && kc.rangeCond == nil {
+				kc.rangeCond = pc
+				continue
+			}
+			return nil, fmt.Errorf("Query key condition not supported")
+		case betweenCond:
+			po, ok := pc.v.(pathOperand)
+			if !ok || len(po.path) != 1 || po.path[0].name != rangeName || rangeName == "" || kc.rangeCond != nil {
+				return nil, fmt.Errorf("Query key condition not supported")
+			}
+			kc.rangeCond = pc
+		case funcCond:
+			if pc.name != "begins_with" || len(pc.path) != 1 || pc.path[0].name != rangeName || rangeName == "" || kc.rangeCond != nil {
+				return nil, fmt.Errorf("Query key condition not supported")
+			}
+			kc.rangeCond = pc
+		default:
+			return nil, fmt.Errorf("Query key condition not supported")
+		}
+	}
+	if kc.hashValue == nil {
+		return nil, fmt.Errorf("Query condition missed key schema element: %s", hashName)
+	}
+	return kc, nil
+}
+
+// parseProjection parses a ProjectionExpression into its document paths.
+func parseProjection(ctx *exprContext, expr string) ([]docPath, error) {
+	p, err := newParser(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	paths := []docPath{}
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.isSymbol(",") {
+			break
+		}
+		p.next()
+	}
+	return paths, p.expectEOF()
+}
+
+// update action kinds
+const (
+	actSet = iota
+	actRemove
+	actAdd
+	actDelete
+)
+
+type updateAction struct {
+	kind  int
+	path  docPath
+	value operand
+}
+
+// parseUpdate parses an UpdateExpression into its actions.
+func parseUpdate(ctx *exprContext, expr string) ([]updateAction, error) {
+	p, err := newParser(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	actions := []updateAction{}
+	seen := map[int]bool{}
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		kind := -1
+		switch strings.ToUpper(t.text) {
+		case "SET":
+			kind = actSet
+		case "REMOVE":
+			kind = actRemove
+		case "ADD":
+			kind = actAdd
+		case "DELETE":
+			kind = actDelete
+		}
+		if t.kind != tokIdent || kind < 0 {
+			return nil, fmt.Errorf("Invalid UpdateExpression: Syntax error; token: %q", t.text)
+		}
+		if seen[kind] {
+			return nil, fmt.Errorf("Invalid UpdateExpression: The %q section can only be used once in an update expression", strings.ToUpper(t.text))
+		}
+		seen[kind] = true
+		for {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, fmt.Errorf("Invalid UpdateExpression: %v", err)
+			}
+			a := updateAction{kind: kind, path: path}
+			switch kind {
+			case actSet:
+				if err := p.expectSymbol("="); err != nil {
+					return nil, fmt.Errorf("Invalid UpdateExpression: %v", err)
+				}
+				if a.value, err = p.parseSetValue(); err != nil {
+					return nil, fmt.Errorf("Invalid UpdateExpression: %v", err)
+				}
+			case actAdd, actDelete:
+				t := p.next()
+				if t.kind != tokValue {
+					return nil, fmt.Errorf("Invalid UpdateExpression: Syntax error; token: %q", t.text)
+				}
+				av, err := p.value(t)
+				if err != nil {
+					return nil, err
+				}
+				a.value = valueOperand{av}
+			}
+			actions = append(actions, a)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("Invalid UpdateExpression: The expression can not be empty")
+	}
+	for i, a := range actions {
+		for _, b := range actions[i+1:] {
+			if pathsOverlap(a.path, b.path) {
+				return nil, fmt.Errorf("Invalid UpdateExpression: Two document paths overlap with each other; path one: %s, path two: %s", a.path, b.path)
+			}
+		}
+	}
+	return actions, nil
+}
+
+func pathsOverlap(a, b docPath) bool {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSetValue parses the right-hand side of a SET action.
+func (p *parser) parseSetValue() (operand, error) {
+	l, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isSymbol("+") || p.isSymbol("-") {
+		op := p.next().text
+		r, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return arithOperand{op, l, r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseSetOperand() (operand, error) {
+	t := p.peek()
+	if t.kind == tokIdent && p.peekAt(1).text == "(" {
+		switch strings.ToLower(t.text) {
+		case "if_not_exists":
+			p.next()
+			p.next()
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			def, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			return ifNotExistsOperand{path, def}, p.expectSymbol(")")
+		case "list_append":
+			p.next()
+			p.next()
+			a, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			b, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			return listAppendOperand{a, b}, p.expectSymbol(")")
+		}
+	}
+	if t.kind == tokValue {
+		p.next()
+		av, err := p.value(t)
+		if err != nil {
+			return nil, err
+		}
+		return valueOperand{av}, nil
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return pathOperand{path}, nil
+}
+
+// applyUpdate applies actions to a copy of it and returns the result.
+func applyUpdate(it item, actions []updateAction) (item, error) {
+	out := item(cloneItem(it))
+	for _, a := range actions {
+		switch a.kind {
+		case actSet:
+			// operands are evaluated against the item as it was before the update
+			v, err := a.value.eval(it)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, fmt.Errorf("The provided expression refers to an attribute that does not exist in the item")
+			}
+			if err := setPath(out, a.path, cloneAV(v)); err != nil {
+				return nil, err
+			}
+		case actRemove:
+			removePath(out, a.path)
+		case actAdd:
+			v, _ := a.value.eval(it)
+			cur := getPath(out, a.path)
+			nv, err := addValues(cur, v)
+			if err != nil {
+				return nil, err
+			}
+			if err := setPath(out, a.path, nv); err != nil {
+				return nil, err
+			}
+		case actDelete:
+			v, _ := a.value.eval(it)
+			cur := getPath(out, a.path)
+			if cur == nil {
+				continue
+			}
+			nv, err := deleteValues(cur, v)
+			if err != nil {
+				return nil, err
+			}
+			if nv == nil {
+				removePath(out, a.path)
+				continue
+			}
+			if err := setPath(out, a.path, nv); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func addValues(cur, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	switch avType(v) {
+	case "N":
+		if cur == nil {
+			return cloneAV(v), nil
+		}
+		return arithOperand{"+", valueOperand{cur}, valueOperand{v}}.eval(nil)
+	case "SS", "NS", "BS":
+		if cur == nil {
+			return cloneAV(v), nil
+		}
+		if avType(cur) != avType(v) {
+			break
+		}
+		out := cloneAV(cur)
+		have := setMembers(cur)
+		for _, s := range v.SS {
+			if _, ok := have[*s]; !ok {
+				have[*s] = struct{}{}
+				out.SS = append(out.SS, strPtr(*s))
+			}
+		}
+		for _, n := range v.NS {
+			if _, ok := have[canonicalNumber(*n)]; !ok {
+				have[canonicalNumber(*n)] = struct{}{}
+				out.NS = append(out.NS, strPtr(*n))
+			}
+		}
+		for _, b := range v.BS {
+			if _, ok := have[string(b)]; !ok {
+				have[string(b)] = struct{}{}
+				out.BS = append(out.BS, append([]byte{}, b...))
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("Invalid UpdateExpression: Incorrect operand type for operator or function; operator: ADD")
+}
+
+func deleteValues(cur, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if avType(cur) != avType(v) || len(setMembers(v)) == 0 {
+		return nil, fmt.Errorf("Invalid UpdateExpression: Incorrect operand type for operator or function; operator: DELETE")
+	}
+	drop := setMembers(v)
+	out := &dynamodb.AttributeValue{}
+	for _, s := range cur.SS {
+		if _, ok := drop[*s]; !ok {
+			out.SS = append(out.SS, strPtr(*s))
+		}
+	}
+	for _, n := range cur.NS {
+		if _, ok := drop[canonicalNumber(*n)]; !ok {
+			out.NS = append(out.NS, strPtr(*n))
+		}
+	}
+	for _, b := range cur.BS {
+		if _, ok := drop[string(b)]; !ok {
+			out.BS = append(out.BS, append([]byte{}, b...))
+		}
+	}
+	if avType(out) == "" {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// memberKey returns the set member encoding of a scalar value.
+func memberKey(av *dynamodb.AttributeValue) string {
+	switch avType(av) {
+	case "S":
+		return *av.S
+	case "N":
+		return canonicalNumber(*av.N)
+	case "B":
+		return string(av.B)
+	}
+	return ""
+}
+
+// getPath returns the value at path in it, or nil if it does not exist.
+func getPath(it item, path docPath) *dynamodb.AttributeValue {
+	av := it[path[0].name]
+	for _, e := range path[1:] {
+		if av == nil {
+			return nil
+		}
+		if e.isIndex {
+			if av.L == nil || e.index >= len(av.L) {
+				return nil
+			}
+			av = av.L[e.index]
+			continue
+		}
+		if av.M == nil {
+			return nil
+		}
+		av = av.M[e.name]
+	}
+	return av
+}
+
+// setPath sets the value at path, which must have an existing parent.
+func setPath(it item, path docPath, v *dynamodb.AttributeValue) error {
+	if len(path) == 1 {
+		it[path[0].name] = v
+		return nil
+	}
+	parent := getPath(it, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch {
+	case parent == nil:
+	case last.isIndex && parent.L != nil:
+		if last.index >= len(parent.L) {
+			parent.L = append(parent.L, v)
+		} else {
+			parent.L[last.index] = v
+		}
+		return nil
+	case !last.isIndex && parent.M != nil:
+		parent.M[last.name] = v
+		return nil
+	}
+	return fmt.Errorf("The document path provided in the update expression is invalid for update")
+}
+
+// removePath deletes the value at path if it exists.
+func removePath(it item, path docPath) {
+	if len(path) == 1 {
+		delete(it, path[0].name)
+		return
+	}
+	parent := getPath(it, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch {
+	case parent == nil:
+	case last.isIndex && parent.L != nil:
+		if last.index < len(parent.L) {
+			parent.L = append(parent.L[:last.index], parent.L[last.index+1:]...)
+		}
+	case !last.isIndex && parent.M != nil:
+		delete(parent.M, last.name)
+	}
+}
+
+// project returns the attributes of it selected by paths.
+func project(it item, paths []docPath) item {
+	out := item{}
+	for _, path := range paths {
+		v := getPath(it, path)
+		if v == nil {
+			continue
+		}
+		cur := out
+		for i, e := range path[:len(path)-1] {
+			if e.isIndex {
+				// projected list elements are returned as a compacted list
+				break
+			}
+			next, ok := cur[e.name]
+			if !ok {
+				if path[i+1].isIndex {
+					cur[e.name] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+				} else {
+					cur[e.name] = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{}}
+				}
+				next = cur[e.name]
+			}
+			if path[i+1].isIndex {
+				next.L = append(next.L, cloneAV(v))
+				cur = nil
+				break
+			}
+			cur = next.M
+		}
+		if cur != nil {
+			cur[path[len(path)-1].name] = cloneAV(v)
+		}
+	}
+	return out
+}
+
+// isReserved reports whether name is one of the most common DynamoDB reserved
+// words that cannot be used as a bare attribute name in an expression.
+func isReserved(name string) bool {
+	switch strings.ToUpper(name) {
+	case "ADD", "AND", "BETWEEN", "BY", "COUNT", "DATA", "DATE", "DELETE", "DESC",
+		"FROM", "GROUP", "IN", "INDEX", "KEY", "LIMIT", "NAME", "NOT", "NULL",
+		"OR", "ORDER", "REMOVE", "SELECT", "SET", "SIZE", "STATUS", "TABLE",
+		"TIME", "TIMESTAMP", "TTL", "TYPE", "UPDATE", "USER", "VALUE", "VALUES",
+		"WHERE", "YEAR":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package dynamotest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func sv(s string) *dynamodb.AttributeValue { return (&dynamodb.AttributeValue{}).SetS(s) }
+
+func nv(n string) *dynamodb.AttributeValue { return (&dynamodb.AttributeValue{}).SetN(n) }
+
+func ssv(ss ...string) *dynamodb.AttributeValue {
+	av := &dynamodb.AttributeValue{}
+	for _, s := range ss {
+		av.SS = append(av.SS, strPtr(s))
+	}
+	return av
+}
+
+// testItem is the item the expression tests evaluate against.
+func testItem() item {
+	return item{
+		"ID":    sv("a1"),
+		"Qty":   nv("5"),
+		"Label": sv("widget"),
+		"Tags":  ssv("red", "blue"),
+		"Info": {M: map[string]*dynamodb.AttributeValue{
+			"Rating": nv("4.5"),
+			"Parts":  {L: []*dynamodb.AttributeValue{sv("bolt"), sv("nut")}},
+		}},
+	}
+}
+
+var testValues = map[string]*dynamodb.AttributeValue{
+	":a1":   sv("a1"),
+	":one":  nv("1"),
+	":five": nv("5"),
+	":ten":  nv("10"),
+	":wid":  sv("wid"),
+	":red":  sv("red"),
+	":nut":  sv("nut"),
+	":S":    sv("S"),
+	":SS":   sv("SS"),
+	":tags": ssv("green", "red"),
+}
+
+// usedValues returns the subset of testValues referenced by expr.
+func usedValues(expr string) map[string]*dynamodb.AttributeValue {
+	vals := map[string]*dynamodb.AttributeValue{}
+	for k, v := range testValues {
+		for _, f := range strings.FieldsFunc(expr, func(r rune) bool { return !isIdentRune(r) && r != ':' }) {
+			if f == k {
+				vals[k] = v
+			}
+		}
+	}
+	return vals
+}
+
+func TestCondition(t *testing.T) {
+	tests := []struct {
+		expr    string
+		names   map[string]*string
+		want    bool
+		wantErr bool
+	}{
+		{expr: "ID = :a1", want: true},
+		{expr: "ID <> :a1", want: false},
+		{expr: "Qty > :one", want: true},
+		{expr: "Qty >= :five", want: true},
+		{expr: "Qty < :five", want: false},
+		{expr: "Qty <= :one", want: false},
+		{expr: "Qty BETWEEN :one AND :ten", want: true},
+		{expr: "Qty BETWEEN :ten AND :one", wantErr: true},
+		{expr: "Qty IN (:one, :five)", want: true},
+		{expr: "Qty IN (:one, :ten)", want: false},
+		{expr: "Missing = :one", want: false},
+		{expr: "Missing <> :one", want: true},
+		{expr: "attribute_exists(Label)", want: true},
+		{expr: "attribute_not_exists(Label)", want: false},
+		{expr: "attribute_not_exists(Missing)", want: true},
+		{expr: "attribute_exists(Info.Rating)", want: true},
+		{expr: "attribute_exists(Info.Parts[2])", want: false},
+		{expr: "Info.Parts[1] = :nut", want: true},
+		{expr: "begins_with(Label, :wid)", want: true},
+		{expr: "begins_with(ID, :wid)", want: false},
+		{expr: "contains(Tags, :red)", want: true},
+		{expr: "contains(Info.Parts, :nut)", want: true},
+		{expr: "contains(Label, :red)", want: false},
+		{expr: "attribute_type(Label, :S)", want: true},
+		{expr: "attribute_type(Tags, :SS)", want: true},
+		{expr: "size(Tags) = :five", want: false},
+		{expr: "size(Label) > :five", want: true},
+		{expr: "ID = :a1 AND Qty > :ten", want: false},
+		{expr: "ID = :a1 OR Qty > :ten", want: true},
+		{expr: "NOT Qty > :ten", want: true},
+		{expr: "NOT (ID = :a1 AND Qty = :five)", want: false},
+		{expr: "(ID = :a1 OR Qty = :one) AND attribute_exists(Tags)", want: true},
+		{expr: "#n = :wid", names: map[string]*string{"#n": strPtr("Label")}, want: false},
+		{expr: "#c = :five", names: map[string]*string{"#c": strPtr("Qty")}, want: true},
+		{expr: "#undefined = :five", wantErr: true},
+		{expr: "ID = :undefined", wantErr: true},
+		{expr: "Size = :five", wantErr: true}, // reserved word
+		{expr: "ID = = :a1", wantErr: true},
+		{expr: "ID = :a1 AND", wantErr: true},
+		{expr: "unknown_fn(ID)", wantErr: true},
+		{expr: "ID ! :a1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			ctx := newExprContext(tt.names, usedValues(tt.expr))
+			c, err := parseCondition(ctx, tt.expr)
+			var got bool
+			if err == nil {
+				got, err = c.test(testItem())
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if err := ctx.checkUnused(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		expr    string
+		check   func(it item) bool
+		wantErr bool
+	}{
+		{expr: "SET Qty = :ten", check: func(it item) bool { return *it["Qty"].N == "10" }},
+		{expr: "SET Qty = Qty + :one", check: func(it item) bool { return *it["Qty"].N == "6" }},
+		{expr: "SET Qty = Qty - :ten", check: func(it item) bool { return *it["Qty"].N == "-5" }},
+		{expr: "SET New = if_not_exists(New, :one)", check: func(it item) bool { return *it["New"].N == "1" }},
+		{expr: "SET Qty = if_not_exists(Qty, :one)", check: func(it item) bool { return *it["Qty"].N == "5" }},
+		{expr: "SET Info.Rating = :five", check: func(it item) bool { return *it["Info"].M["Rating"].N == "5" }},
+		{expr: "SET Info.Parts[0] = :nut", check: func(it item) bool { return *it["Info"].M["Parts"].L[0].S == "nut" }},
+		{expr: "SET Info.Parts = list_append(Info.Parts, Info.Parts)", check: func(it item) bool { return len(it["Info"].M["Parts"].L) == 4 }},
+		{expr: "SET Qty = Missing", wantErr: true},
+		{expr: "SET Missing.Field = :one", wantErr: true},
+		{expr: "REMOVE Label, Info.Rating", check: func(it item) bool {
+			_, name := it["Label"]
+			_, rating := it["Info"].M["Rating"]
+			return !name && !rating
+		}},
+		{expr: "ADD Qty :five", check: func(it item) bool { return *it["Qty"].N == "10" }},
+		{expr: "ADD New :five", check: func(it item) bool { return *it["New"].N == "5" }},
+		{expr: "ADD Tags :tags", check: func(it item) bool { return len(it["Tags"].SS) == 3 }},
+		{expr: "ADD Label :one", wantErr: true},
+		{expr: "DELETE Tags :tags", check: func(it item) bool { return len(it["Tags"].SS) == 1 && *it["Tags"].SS[0] == "blue" }},
+		{expr: "DELETE Qty :one", wantErr: true},
+		{expr: "SET Qty = :one REMOVE Label ADD Tags :tags", check: func(it item) bool {
+			_, name := it["Label"]
+			return *it["Qty"].N == "1" && !name && len(it["Tags"].SS) == 3
+		}},
+		{expr: "SET Qty = :one, Qty = :ten", wantErr: true},
+		{expr: "SET Info = :one, Info.Rating = :ten", wantErr: true},
+		{expr: "SET Qty = :one SET Label = :wid", wantErr: true},
+		{expr: "UPSERT Qty = :one", wantErr: true},
+		{expr: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			before := testItem()
+			actions, err := parseUpdate(newExprContext(nil, usedValues(tt.expr)), tt.expr)
+			var got item
+			if err == nil {
+				got, err = applyUpdate(before, actions)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(got) {
+				t.Errorf("unexpected result %v", got)
+			}
+			if !equalItems(before, testItem()) {
+				t.Errorf("input item modified: %v", before)
+			}
+		})
+	}
+}
+
+func equalItems(a, b item) bool {
+	return equalAV(&dynamodb.AttributeValue{M: a}, &dynamodb.AttributeValue{M: b})
+}
+
+func TestKeyCondition(t *testing.T) {
+	tests := []struct {
+		expr    string
+		rng     bool // whether a sort key condition is expected
+		wantErr bool
+	}{
+		{expr: "ID = :a1"},
+		{expr: "ID = :a1 AND Qty = :five", rng: true},
+		{expr: "Qty > :one AND ID = :a1", rng: true},
+		{expr: "ID = :a1 AND Qty BETWEEN :one AND :ten", rng: true},
+		{expr: "ID = :a1 AND begins_with(Qty, :one)", rng: true},
+		{expr: "Qty = :five", wantErr: true},
+		{expr: "ID > :a1", wantErr: true},
+		{expr: "ID = :a1 AND Qty <> :five", wantErr: true},
+		{expr: "ID = :a1 OR Qty = :five", wantErr: true},
+		{expr: "ID = :a1 AND Qty = :five AND Qty = :one", wantErr: true},
+		{expr: "ID = :a1 AND Label = :wid", wantErr: true},
+		{expr: "ID = :a1 AND contains(Qty, :one)", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			kc, err := parseKeyCondition(newExprContext(nil, usedValues(tt.expr)), tt.expr, "ID", "Qty")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want error", kc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *kc.hashValue.S != "a1" || (kc.rangeCond != nil) != tt.rng {
+				t.Errorf("got %+v", kc)
+			}
+		})
+	}
+}
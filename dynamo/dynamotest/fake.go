@@ -0,0 +1,795 @@
+// Package dynamotest provides an in-memory implementation of the DynamoDB API
+// for testing code built on the dynamo package without network access.
+// This file defines the Fake client, fault injection and table operations.
+package dynamotest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Fake is an in-memory DynamoDB backend that satisfies dynamodbiface.DynamoDBAPI.
+// It implements PutItem, GetItem, UpdateItem, DeleteItem, BatchWriteItem,
+// BatchGetItem, TransactWriteItems, TransactGetItems, Query, Scan, CreateTable,
+// DescribeTable, DescribeTimeToLive, DescribeContinuousBackups, UpdateTable,
+// UpdateTimeToLive, UpdateContinuousBackups, DeleteTable and ListTables, along with
+// their WithContext variants. Calling any other operation of the embedded interface panics.
+// A Fake is safe for concurrent use.
+type Fake struct {
+	dynamodbiface.DynamoDBAPI
+
+	// PageSize caps the number of items evaluated by a single Query or Scan
+	// call in addition to the request's Limit, emulating the 1 MB page limit.
+	// Zero means no cap.
+	PageSize int
+	// StatusPolls is the number of DescribeTable calls for which a table created
+	// afterwards reports CREATING before it is ACTIVE, and a table deleted
+	// afterwards reports DELETING before it no longer exists, emulating the time
+	// DynamoDB takes to apply those changes. Other operations see the change at
+	// once. Zero makes tables ACTIVE and deleted immediately.
+	StatusPolls int
+
+	mu       sync.Mutex
+	tables   map[string]*table
+	deleting map[string]*table // deleted tables still reported as DELETING
+	faults   []*Fault
+	calls    map[string]int
+	tokens   map[string]bool // client request tokens of applied transactions
+}
+
+// Fault describes an error or partial result injected into matching calls.
+type Fault struct {
+	// Op is the name of the operation the fault applies to, e.g. "BatchWriteItem".
+	// An empty Op matches every operation.
+	Op string
+	// Err is returned in place of performing the operation.
+	Err error
+	// Unprocessed is the number of write requests (BatchWriteItem) or keys
+	// (BatchGetItem) returned as unprocessed instead of being applied.
+	Unprocessed int
+	// Times is the number of calls the fault applies to.
+	// Zero applies the fault once; a negative value applies it until ClearFaults is called.
+	Times int
+}
+
+// table holds the schema and items of a single table.
+type table struct {
+	desc    *dynamodb.TableDescription
+	hash    string
+	rng     string
+	indexes map[string]*index
+	items   map[string]item
+	ttl     string // time to live attribute, or "" if disabled
+	pitr    bool   // point in time recovery enabled
+	polls   int    // DescribeTable calls left reporting CREATING or DELETING
+}
+
+// index holds the key schema and projection of a secondary index.
+type index struct {
+	name       string
+	hash       string
+	rng        string
+	projection *dynamodb.Projection
+}
+
+// New returns an empty Fake with no tables.
+func New() *Fake {
+	return &Fake{tables: make(map[string]*table), deleting: make(map[string]*table), calls: make(map[string]int), tokens: make(map[string]bool)}
+}
+
+// InjectFault adds a fault to the queue. Faults are matched in the order they were added.
+func (f *Fake) InjectFault(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+// FailNext makes the next n calls of op fail with an AWS error carrying code,
+// e.g. FailNext("BatchWriteItem", dynamodb.ErrCodeInternalServerError, 2).
+func (f *Fake) FailNext(op, code string, n int) {
+	if n <= 0 {
+		return
+	}
+	f.InjectFault(Fault{Op: op, Err: NewError(code, "injected fault"), Times: n})
+}
+
+// ClearFaults removes all pending faults.
+func (f *Fake) ClearFaults() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+// Calls returns the number of times op has been called, including failed calls.
+func (f *Fake) Calls(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// Items returns a copy of every item stored in the named table, ordered by primary key.
+func (f *Fake) Items(tableName string) []map[string]*dynamodb.AttributeValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tables[tableName]
+	if !ok {
+		return nil
+	}
+	out := []map[string]*dynamodb.AttributeValue{}
+	for _, k := range sortedNames(t.items) {
+		out = append(out, cloneItem(t.items[k]))
+	}
+	return out
+}
+
+// NewError returns an AWS error with the given code and the HTTP status
+// DynamoDB uses for it.
+func NewError(code, msg string) error {
+	status := 400
+	switch code {
+	case dynamodb.ErrCodeInternalServerError:
+		status = 500
+	case "ServiceUnavailable":
+		status = 503
+	}
+	return awserr.NewRequestFailure(awserr.New(code, msg, nil), status, "")
+}
+
+func validationErr(format string, args ...interface{}) error {
+	return NewError("ValidationException", fmt.Sprintf(format, args...))
+}
+
+func notFoundErr(name string) error {
+	return NewError(dynamodb.ErrCodeResourceNotFoundException,
+		fmt.Sprintf("Requested resource not found: Table: %s not found", name))
+}
+
+// begin records a call of op and returns the fault to apply to it, if any.
+// The caller must hold f.mu.
+func (f *Fake) begin(op string) *Fault {
+	f.calls[op]++
+	for i, fault := range f.faults {
+		if fault.Op != "" && fault.Op != op {
+			continue
+		}
+		switch {
+		case fault.Times > 1:
+			fault.Times--
+		case fault.Times >= 0:
+			f.faults = append(f.faults[:i], f.faults[i+1:]...)
+		}
+		return fault
+	}
+	return &Fault{}
+}
+
+// table returns the named table or a ResourceNotFoundException.
+// The caller must hold f.mu.
+func (f *Fake) table(name *string) (*table, error) {
+	t, ok := f.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, notFoundErr(aws.StringValue(name))
+	}
+	return t, nil
+}
+
+// CreateTable creates a table from the key schema, secondary indexes, billing
+// mode, table class, encryption and deletion protection settings in input.
+// Tags are validated but not stored.
+func (f *Fake) CreateTable(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.CreateTableOutput{}
+	if fault := f.begin("CreateTable"); fault.Err != nil {
+		return out, fault.Err
+	}
+
+	name := aws.StringValue(input.TableName)
+	if len(name) < 3 {
+		return out, validationErr("TableName must be at least 3 characters long")
+	}
+	if _, ok := f.tables[name]; ok {
+		return out, NewError(dynamodb.ErrCodeResourceInUseException, fmt.Sprintf("Table already exists: %s", name))
+	}
+	if _, ok := f.deleting[name]; ok {
+		return out, NewError(dynamodb.ErrCodeResourceInUseException, fmt.Sprintf("Table is being deleted: %s", name))
+	}
+
+	defs := map[string]string{}
+	for _, d := range input.AttributeDefinitions {
+		n, typ := aws.StringValue(d.AttributeName), aws.StringValue(d.AttributeType)
+		if n == "" {
+			return out, validationErr("One or more parameter values were invalid: Empty attribute name in AttributeDefinitions")
+		}
+		if typ != "S" && typ != "N" && typ != "B" {
+			return out, validationErr("1 validation error detected: Value '%s' at 'attributeDefinitions.attributeType' failed to satisfy constraint: Member must satisfy enum value set: [B, N, S]", typ)
+		}
+		if _, dup := defs[n]; dup {
+			return out, validationErr("Cannot have two attributes with the same name, attribute name: %s", n)
+		}
+		defs[n] = typ
+	}
+	used := map[string]bool{}
+
+	hash, rng, err := parseKeySchema(input.KeySchema, defs, used)
+	if err != nil {
+		return out, err
+	}
+	t := &table{hash: hash, rng: rng, indexes: map[string]*index{}, items: map[string]item{}, polls: f.StatusPolls}
+
+	billing := aws.StringValue(input.BillingMode)
+	if billing == "" {
+		billing = dynamodb.BillingModeProvisioned
+	}
+	if err := checkThroughput(billing, input.ProvisionedThroughput, "table"); err != nil {
+		return out, err
+	}
+
+	now := time.Now()
+	desc := &dynamodb.TableDescription{
+		AttributeDefinitions:  input.AttributeDefinitions,
+		BillingModeSummary:    &dynamodb.BillingModeSummary{BillingMode: aws.String(billing)},
+		CreationDateTime:      aws.Time(now),
+		ItemCount:             aws.Int64(0),
+		KeySchema:             input.KeySchema,
+		ProvisionedThroughput: throughputDesc(input.ProvisionedThroughput),
+		TableArn:              aws.String(fmt.Sprintf("arn:aws:dynamodb:local:000000000000:table/%s", name)),
+		TableName:             aws.String(name),
+		TableSizeBytes:        aws.Int64(0),
+		TableStatus:           aws.String(dynamodb.TableStatusActive),
+	}
+	if t.polls > 0 {
+		desc.TableStatus = aws.String(dynamodb.TableStatusCreating)
+	}
+
+	class := dynamodb.TableClassStandard
+	if input.TableClass != nil {
+		class = *input.TableClass
+	}
+	if err := checkTableClass(class); err != nil {
+		return out, err
+	}
+	desc.TableClassSummary = &dynamodb.TableClassSummary{TableClass: aws.String(class)}
+	desc.DeletionProtectionEnabled = aws.Bool(aws.BoolValue(input.DeletionProtectionEnabled))
+	if sse := input.SSESpecification; sse != nil && aws.BoolValue(sse.Enabled) {
+		key := aws.StringValue(sse.KMSMasterKeyId)
+		if key == "" {
+			key = "alias/aws/dynamodb"
+		}
+		desc.SSEDescription = &dynamodb.SSEDescription{
+			KMSMasterKeyArn: aws.String(fmt.Sprintf("arn:aws:kms:local:000000000000:%s", key)),
+			SSEType:         aws.String(dynamodb.SSETypeKms),
+			Status:          aws.String(dynamodb.SSEStatusEnabled),
+		}
+	}
+	if ss := input.StreamSpecification; ss != nil && aws.BoolValue(ss.StreamEnabled) {
+		switch aws.StringValue(ss.StreamViewType) {
+		case dynamodb.StreamViewTypeNewImage, dynamodb.StreamViewTypeOldImage,
+			dynamodb.StreamViewTypeNewAndOldImages, dynamodb.StreamViewTypeKeysOnly:
+		default:
+			return out, validationErr("One or more parameter values were invalid: StreamViewType must be specified when StreamEnabled is true")
+		}
+		desc.StreamSpecification = ss
+		desc.LatestStreamLabel = aws.String(now.UTC().Format("2006-01-02T15:04:05.000"))
+		desc.LatestStreamArn = aws.String(aws.StringValue(desc.TableArn) + "/stream/" + *desc.LatestStreamLabel)
+	}
+	for _, tag := range input.Tags {
+		if aws.StringValue(tag.Key) == "" {
+			return out, validationErr("1 validation error detected: Value at 'tags.member.key' failed to satisfy constraint: Member must have length greater than or equal to 1")
+		}
+	}
+
+	for _, g := range input.GlobalSecondaryIndexes {
+		idx, err := newIndex(g.IndexName, g.KeySchema, g.Projection, defs, used, t)
+		if err != nil {
+			return out, err
+		}
+		if err := checkThroughput(billing, g.ProvisionedThroughput, "index "+idx.name); err != nil {
+			return out, err
+		}
+		desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndexDescription{
+			IndexArn:              aws.String(aws.StringValue(desc.TableArn) + "/index/" + idx.name),
+			IndexName:             aws.String(idx.name),
+			IndexSizeBytes:        aws.Int64(0),
+			IndexStatus:           aws.String(dynamodb.IndexStatusActive),
+			ItemCount:             aws.Int64(0),
+			KeySchema:             g.KeySchema,
+			Projection:            g.Projection,
+			ProvisionedThroughput: throughputDesc(g.ProvisionedThroughput),
+		})
+	}
+	for _, l := range input.LocalSecondaryIndexes {
+		idx, err := newIndex(l.IndexName, l.KeySchema, l.Projection, defs, used, t)
+		if err != nil {
+			return out, err
+		}
+		if idx.hash != hash || idx.rng == "" || rng == "" {
+			return out, validationErr("One or more parameter values were invalid: Table KeySchema and LocalSecondaryIndex %s KeySchema must have the same hash key and a range key", idx.name)
+		}
+		desc.LocalSecondaryIndexes = append(desc.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndexDescription{
+			IndexArn:       aws.String(aws.StringValue(desc.TableArn) + "/index/" + idx.name),
+			IndexName:      aws.String(idx.name),
+			IndexSizeBytes: aws.Int64(0),
+			ItemCount:      aws.Int64(0),
+			KeySchema:      l.KeySchema,
+			Projection:     l.Projection,
+		})
+	}
+
+	if len(used) != len(defs) {
+		return out, validationErr("One or more parameter values were invalid: Number of attributes in KeySchema does not exactly match number of attributes defined in AttributeDefinitions")
+	}
+
+	t.desc = desc
+	f.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: describe(t)}, nil
+}
+
+// parseKeySchema validates a key schema and returns its hash and range key names.
+func parseKeySchema(ks []*dynamodb.KeySchemaElement, defs map[string]string, used map[string]bool) (hash, rng string, err error) {
+	if len(ks) == 0 || len(ks) > 2 {
+		return "", "", validationErr("1 validation error detected: Value at 'keySchema' failed to satisfy constraint: Member must have length less than or equal to 2 and greater than or equal to 1")
+	}
+	for i, k := range ks {
+		n := aws.StringValue(k.AttributeName)
+		if _, ok := defs[n]; !ok {
+			return "", "", validationErr("One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions. Keys: [%s]", n)
+		}
+		used[n] = true
+		switch {
+		case i == 0 && aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash:
+			hash = n
+		case i == 1 && aws.StringValue(k.KeyType) == dynamodb.KeyTypeRange:
+			rng = n
+		default:
+			return "", "", validationErr("Invalid KeySchema: The first KeySchemaElement is not a HASH key type")
+		}
+	}
+	return hash, rng, nil
+}
+
+// newIndex validates a secondary index definition and registers it on t.
+func newIndex(name *string, ks []*dynamodb.KeySchemaElement, proj *dynamodb.Projection, defs map[string]string, used map[string]bool, t *table) (*index, error) {
+	n := aws.StringValue(name)
+	if len(n) < 3 {
+		return nil, validationErr("IndexName must be at least 3 characters long")
+	}
+	if _, dup := t.indexes[n]; dup {
+		return nil, validationErr("One or more parameter values were invalid: Duplicate index name: %s", n)
+	}
+	hash, rng, err := parseKeySchema(ks, defs, used)
+	if err != nil {
+		return nil, err
+	}
+	if proj == nil || proj.ProjectionType == nil {
+		return nil, validationErr("One or more parameter values were invalid: Projection is required for index %s", n)
+	}
+	idx := &index{name: n, hash: hash, rng: rng, projection: proj}
+	t.indexes[n] = idx
+	return idx, nil
+}
+
+// checkThroughput validates provisioned throughput settings against the billing mode.
+func checkThroughput(billing string, pt *dynamodb.ProvisionedThroughput, what string) error {
+	switch billing {
+	case dynamodb.BillingModePayPerRequest:
+		if pt != nil {
+			return validationErr("One or more parameter values were invalid: Neither ReadCapacityUnits nor WriteCapacityUnits can be specified when BillingMode is PAY_PER_REQUEST")
+		}
+	case dynamodb.BillingModeProvisioned:
+		if pt == nil || aws.Int64Value(pt.ReadCapacityUnits) < 1 || aws.Int64Value(pt.WriteCapacityUnits) < 1 {
+			return validationErr("One or more parameter values were invalid: ReadCapacityUnits and WriteCapacityUnits must both be specified for %s when BillingMode is PROVISIONED", what)
+		}
+	default:
+		return validationErr("1 validation error detected: Value '%s' at 'billingMode' failed to satisfy constraint: Member must satisfy enum value set: [PROVISIONED, PAY_PER_REQUEST]", billing)
+	}
+	return nil
+}
+
+func throughputDesc(pt *dynamodb.ProvisionedThroughput) *dynamodb.ProvisionedThroughputDescription {
+	d := &dynamodb.ProvisionedThroughputDescription{
+		NumberOfDecreasesToday: aws.Int64(0),
+		ReadCapacityUnits:      aws.Int64(0),
+		WriteCapacityUnits:     aws.Int64(0),
+	}
+	if pt != nil {
+		d.ReadCapacityUnits = aws.Int64(aws.Int64Value(pt.ReadCapacityUnits))
+		d.WriteCapacityUnits = aws.Int64(aws.Int64Value(pt.WriteCapacityUnits))
+	}
+	return d
+}
+
+// describe returns a copy of t's description with current item counts.
+// The caller must hold f.mu.
+func describe(t *table) *dynamodb.TableDescription {
+	d := *t.desc
+	d.ItemCount = aws.Int64(int64(len(t.items)))
+	return &d
+}
+
+// DeleteTable deletes a table and all of its items, unless deletion protection is enabled.
+func (f *Fake) DeleteTable(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.DeleteTableOutput{}
+	if fault := f.begin("DeleteTable"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	if aws.BoolValue(t.desc.DeletionProtectionEnabled) {
+		return out, validationErr("Resource cannot be deleted as it is currently protected against deletion. Disable deletion protection first.")
+	}
+	name := aws.StringValue(input.TableName)
+	delete(f.tables, name)
+	desc := describe(t)
+	desc.TableStatus = aws.String(dynamodb.TableStatusDeleting)
+	if f.StatusPolls > 0 {
+		t.desc, t.polls = desc, f.StatusPolls
+		f.deleting[name] = t
+	}
+	return &dynamodb.DeleteTableOutput{TableDescription: desc}, nil
+}
+
+// DescribeTable returns the description of a table with its current item count.
+// Indexes are always ACTIVE, and tables are too unless StatusPolls is set.
+func (f *Fake) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.DescribeTableOutput{}
+	if fault := f.begin("DescribeTable"); fault.Err != nil {
+		return out, fault.Err
+	}
+	if t, ok := f.deleting[aws.StringValue(input.TableName)]; ok {
+		if t.polls > 0 {
+			t.polls--
+			return &dynamodb.DescribeTableOutput{Table: describe(t)}, nil
+		}
+		delete(f.deleting, aws.StringValue(input.TableName))
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	if t.polls > 0 {
+		t.polls--
+	} else if aws.StringValue(t.desc.TableStatus) == dynamodb.TableStatusCreating {
+		d := *t.desc
+		d.TableStatus = aws.String(dynamodb.TableStatusActive)
+		t.desc = &d
+	}
+	return &dynamodb.DescribeTableOutput{Table: describe(t)}, nil
+}
+
+// DescribeTimeToLive returns the time to live settings of a table.
+func (f *Fake) DescribeTimeToLive(input *dynamodb.DescribeTimeToLiveInput) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.DescribeTimeToLiveOutput{}
+	if fault := f.begin("DescribeTimeToLive"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	out.TimeToLiveDescription = &dynamodb.TimeToLiveDescription{TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusDisabled)}
+	if t.ttl != "" {
+		out.TimeToLiveDescription = &dynamodb.TimeToLiveDescription{
+			AttributeName:    aws.String(t.ttl),
+			TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusEnabled),
+		}
+	}
+	return out, nil
+}
+
+// UpdateTimeToLive enables or disables time to live on a table.
+// Expired items are not deleted.
+func (f *Fake) UpdateTimeToLive(input *dynamodb.UpdateTimeToLiveInput) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.UpdateTimeToLiveOutput{}
+	if fault := f.begin("UpdateTimeToLive"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	spec := input.TimeToLiveSpecification
+	if spec == nil || spec.Enabled == nil || aws.StringValue(spec.AttributeName) == "" {
+		return out, validationErr("One or more parameter values were invalid: TimeToLiveSpecification requires AttributeName and Enabled")
+	}
+	name := aws.StringValue(spec.AttributeName)
+	switch {
+	case *spec.Enabled && t.ttl != "":
+		return out, validationErr("TimeToLive is already enabled")
+	case *spec.Enabled:
+		t.ttl = name
+	case t.ttl == "":
+		return out, validationErr("TimeToLive is already disabled")
+	case t.ttl != name:
+		return out, validationErr("TimeToLive is enabled on attribute %s, not %s", t.ttl, name)
+	default:
+		t.ttl = ""
+	}
+	out.TimeToLiveSpecification = spec
+	return out, nil
+}
+
+// DescribeContinuousBackups returns the point in time recovery status of a table.
+func (f *Fake) DescribeContinuousBackups(input *dynamodb.DescribeContinuousBackupsInput) (*dynamodb.DescribeContinuousBackupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.DescribeContinuousBackupsOutput{}
+	if fault := f.begin("DescribeContinuousBackups"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	out.ContinuousBackupsDescription = continuousBackups(t)
+	return out, nil
+}
+
+// UpdateContinuousBackups enables or disables point in time recovery on a table.
+func (f *Fake) UpdateContinuousBackups(input *dynamodb.UpdateContinuousBackupsInput) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.UpdateContinuousBackupsOutput{}
+	if fault := f.begin("UpdateContinuousBackups"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	spec := input.PointInTimeRecoverySpecification
+	if spec == nil || spec.PointInTimeRecoveryEnabled == nil {
+		return out, validationErr("One or more parameter values were invalid: PointInTimeRecoveryEnabled is required")
+	}
+	t.pitr = *spec.PointInTimeRecoveryEnabled
+	out.ContinuousBackupsDescription = continuousBackups(t)
+	return out, nil
+}
+
+// continuousBackups describes the continuous backup settings of t.
+func continuousBackups(t *table) *dynamodb.ContinuousBackupsDescription {
+	status := dynamodb.PointInTimeRecoveryStatusDisabled
+	if t.pitr {
+		status = dynamodb.PointInTimeRecoveryStatusEnabled
+	}
+	return &dynamodb.ContinuousBackupsDescription{
+		ContinuousBackupsStatus: aws.String(dynamodb.ContinuousBackupsStatusEnabled),
+		PointInTimeRecoveryDescription: &dynamodb.PointInTimeRecoveryDescription{
+			PointInTimeRecoveryStatus: aws.String(status),
+		},
+	}
+}
+
+// UpdateTable changes the billing mode, provisioned throughput, table class,
+// deletion protection or stream of a table, and creates, updates or deletes its global
+// secondary indexes. As in DynamoDB, only one index may be created or deleted
+// per call. Changes take effect immediately and new indexes are ACTIVE at once.
+func (f *Fake) UpdateTable(input *dynamodb.UpdateTableInput) (*dynamodb.UpdateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.UpdateTableOutput{}
+	if fault := f.begin("UpdateTable"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	if input.BillingMode == nil && input.ProvisionedThroughput == nil && input.TableClass == nil &&
+		input.DeletionProtectionEnabled == nil && input.StreamSpecification == nil && len(input.GlobalSecondaryIndexUpdates) == 0 {
+		return out, validationErr("At least one of ProvisionedThroughput, BillingMode, UpdateStreamEnabled, GlobalSecondaryIndexUpdates or SSESpecification or ReplicaUpdates is required")
+	}
+
+	desc := *t.desc
+	billing := aws.StringValue(desc.BillingModeSummary.BillingMode)
+	if input.BillingMode != nil {
+		billing = *input.BillingMode
+		desc.BillingModeSummary = &dynamodb.BillingModeSummary{BillingMode: aws.String(billing)}
+	}
+	switch {
+	case input.ProvisionedThroughput != nil:
+		if err := checkThroughput(billing, input.ProvisionedThroughput, "table"); err != nil {
+			return out, err
+		}
+		desc.ProvisionedThroughput = throughputDesc(input.ProvisionedThroughput)
+	case billing == dynamodb.BillingModePayPerRequest:
+		desc.ProvisionedThroughput = throughputDesc(nil)
+	case aws.Int64Value(desc.ProvisionedThroughput.ReadCapacityUnits) == 0:
+		return out, validationErr("One or more parameter values were invalid: ProvisionedThroughput must be specified for table when BillingMode is PROVISIONED")
+	}
+	if input.TableClass != nil {
+		if err := checkTableClass(*input.TableClass); err != nil {
+			return out, err
+		}
+		desc.TableClassSummary = &dynamodb.TableClassSummary{TableClass: input.TableClass}
+	}
+	if input.DeletionProtectionEnabled != nil {
+		desc.DeletionProtectionEnabled = aws.Bool(*input.DeletionProtectionEnabled)
+	}
+	if ss := input.StreamSpecification; ss != nil {
+		enabled := desc.StreamSpecification != nil && aws.BoolValue(desc.StreamSpecification.StreamEnabled)
+		switch {
+		case aws.BoolValue(ss.StreamEnabled) && enabled:
+			return out, validationErr("Table already has an enabled stream: %s", aws.StringValue(desc.LatestStreamArn))
+		case aws.BoolValue(ss.StreamEnabled):
+			switch aws.StringValue(ss.StreamViewType) {
+			case dynamodb.StreamViewTypeNewImage, dynamodb.StreamViewTypeOldImage,
+				dynamodb.StreamViewTypeNewAndOldImages, dynamodb.StreamViewTypeKeysOnly:
+			default:
+				return out, validationErr("One or more parameter values were invalid: StreamViewType must be specified when StreamEnabled is true")
+			}
+			desc.StreamSpecification = ss
+			desc.LatestStreamLabel = aws.String(time.Now().UTC().Format("2006-01-02T15:04:05.000"))
+			desc.LatestStreamArn = aws.String(aws.StringValue(desc.TableArn) + "/stream/" + *desc.LatestStreamLabel)
+		case !enabled:
+			return out, validationErr("Table already has streams disabled")
+		default:
+			desc.StreamSpecification = nil
+		}
+	}
+
+	changed := 0
+	for _, u := range input.GlobalSecondaryIndexUpdates {
+		if u.Create != nil || u.Delete != nil {
+			changed++
+		}
+	}
+	if changed > 1 {
+		return out, validationErr("Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table")
+	}
+
+	gsis := []*dynamodb.GlobalSecondaryIndexDescription{}
+	for _, g := range desc.GlobalSecondaryIndexes {
+		c := *g
+		gsis = append(gsis, &c)
+	}
+	var created *index
+	dropped := ""
+	defer func() {
+		// newIndex registers the index on t; undo that if the update is rejected
+		if created != nil && t.desc != &desc {
+			delete(t.indexes, created.name)
+		}
+	}()
+	for _, u := range input.GlobalSecondaryIndexUpdates {
+		switch {
+		case u.Create != nil:
+			defs := map[string]string{}
+			for _, d := range append(append([]*dynamodb.AttributeDefinition{}, t.desc.AttributeDefinitions...), input.AttributeDefinitions...) {
+				n, typ := aws.StringValue(d.AttributeName), aws.StringValue(d.AttributeType)
+				if prev, ok := defs[n]; ok && prev != typ {
+					return out, validationErr("One or more parameter values were invalid: Attribute %s is already defined with type %s", n, prev)
+				}
+				defs[n] = typ
+			}
+			if err := checkThroughput(billing, u.Create.ProvisionedThroughput, "index "+aws.StringValue(u.Create.IndexName)); err != nil {
+				return out, err
+			}
+			idx, err := newIndex(u.Create.IndexName, u.Create.KeySchema, u.Create.Projection, defs, map[string]bool{}, t)
+			if err != nil {
+				return out, err
+			}
+			created = idx
+			desc.AttributeDefinitions = append([]*dynamodb.AttributeDefinition{}, desc.AttributeDefinitions...)
+			for _, n := range []string{idx.hash, idx.rng} {
+				if n != "" && t.attrType(n) == "" {
+					desc.AttributeDefinitions = append(desc.AttributeDefinitions, &dynamodb.AttributeDefinition{
+						AttributeName: aws.String(n),
+						AttributeType: aws.String(defs[n]),
+					})
+				}
+			}
+			gsis = append(gsis, &dynamodb.GlobalSecondaryIndexDescription{
+				IndexArn:              aws.String(aws.StringValue(desc.TableArn) + "/index/" + idx.name),
+				IndexName:             aws.String(idx.name),
+				IndexSizeBytes:        aws.Int64(0),
+				IndexStatus:           aws.String(dynamodb.IndexStatusActive),
+				ItemCount:             aws.Int64(0),
+				KeySchema:             u.Create.KeySchema,
+				Projection:            u.Create.Projection,
+				ProvisionedThroughput: throughputDesc(u.Create.ProvisionedThroughput),
+			})
+		case u.Delete != nil:
+			name := aws.StringValue(u.Delete.IndexName)
+			i := findIndex(gsis, name)
+			if i < 0 {
+				return out, NewError(dynamodb.ErrCodeResourceNotFoundException,
+					fmt.Sprintf("Requested resource not found: Index: %s not found", name))
+			}
+			gsis = append(gsis[:i], gsis[i+1:]...)
+			dropped = name
+		case u.Update != nil:
+			name := aws.StringValue(u.Update.IndexName)
+			i := findIndex(gsis, name)
+			if i < 0 {
+				return out, NewError(dynamodb.ErrCodeResourceNotFoundException,
+					fmt.Sprintf("Requested resource not found: Index: %s not found", name))
+			}
+			if err := checkThroughput(billing, u.Update.ProvisionedThroughput, "index "+name); err != nil {
+				return out, err
+			}
+			gsis[i].ProvisionedThroughput = throughputDesc(u.Update.ProvisionedThroughput)
+		default:
+			return out, validationErr("One or more parameter values were invalid: GlobalSecondaryIndexUpdate must contain Create, Update or Delete")
+		}
+	}
+	for _, g := range gsis {
+		switch {
+		case billing == dynamodb.BillingModePayPerRequest:
+			g.ProvisionedThroughput = throughputDesc(nil)
+		case aws.Int64Value(g.ProvisionedThroughput.ReadCapacityUnits) == 0:
+			return out, validationErr("One or more parameter values were invalid: ProvisionedThroughput must be specified for index %s when BillingMode is PROVISIONED", aws.StringValue(g.IndexName))
+		}
+	}
+	if len(gsis) == 0 {
+		gsis = nil
+	}
+	desc.GlobalSecondaryIndexes = gsis
+
+	delete(t.indexes, dropped)
+	t.desc = &desc
+	return &dynamodb.UpdateTableOutput{TableDescription: describe(t)}, nil
+}
+
+// findIndex returns the position of the named index in gsis, or -1.
+func findIndex(gsis []*dynamodb.GlobalSecondaryIndexDescription, name string) int {
+	for i, g := range gsis {
+		if aws.StringValue(g.IndexName) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkTableClass validates a table class.
+func checkTableClass(class string) error {
+	switch class {
+	case dynamodb.TableClassStandard, dynamodb.TableClassStandardInfrequentAccess:
+		return nil
+	}
+	return validationErr("1 validation error detected: Value '%s' at 'tableClass' failed to satisfy constraint: Member must satisfy enum value set: [STANDARD, STANDARD_INFREQUENT_ACCESS]", class)
+}
+
+// ListTables lists table names in alphabetical order, 100 per page by default.
+func (f *Fake) ListTables(input *dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.ListTablesOutput{}
+	if fault := f.begin("ListTables"); fault.Err != nil {
+		return out, fault.Err
+	}
+	limit := int(aws.Int64Value(input.Limit))
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	names := sortedNames(f.tables)
+	start := sort.SearchStrings(names, aws.StringValue(input.ExclusiveStartTableName))
+	if input.ExclusiveStartTableName != nil && start < len(names) && names[start] == *input.ExclusiveStartTableName {
+		start++
+	}
+	for _, n := range names[start:] {
+		if len(out.TableNames) == limit {
+			out.LastEvaluatedTableName = out.TableNames[len(out.TableNames)-1]
+			break
+		}
+		out.TableNames = append(out.TableNames, aws.String(n))
+	}
+	return out, nil
+}
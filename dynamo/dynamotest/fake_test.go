@@ -0,0 +1,304 @@
+package dynamotest
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// newTestFake returns a Fake with an empty table "things" keyed by the string ID.
+func newTestFake(t *testing.T) *Fake {
+	t.Helper()
+	f := New()
+	_, err := f.CreateTable(&dynamodb.CreateTableInput{
+		TableName:            aws.String("things"),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String("ID"), AttributeType: aws.String("S")}},
+		KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String("ID"), KeyType: aws.String("HASH")}},
+		BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func putRequests(ids ...string) []*dynamodb.WriteRequest {
+	var reqs []*dynamodb.WriteRequest
+	for _, id := range ids {
+		reqs = append(reqs, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item{"ID": sv(id)}}})
+	}
+	return reqs
+}
+
+func errCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func TestFailNext(t *testing.T) {
+	f := newTestFake(t)
+	f.FailNext("PutItem", dynamodb.ErrCodeInternalServerError, 2)
+	put := &dynamodb.PutItemInput{TableName: aws.String("things"), Item: item{"ID": sv("a")}}
+
+	for i := 0; i < 2; i++ {
+		_, err := f.PutItem(put)
+		if code := errCode(err); code != dynamodb.ErrCodeInternalServerError {
+			t.Fatalf("call %d: got code %q, want %q", i, code, dynamodb.ErrCodeInternalServerError)
+		}
+		var rf awserr.RequestFailure
+		if !errors.As(err, &rf) || rf.StatusCode() != 500 {
+			t.Errorf("call %d: got %v, want status 500", i, err)
+		}
+	}
+	if _, err := f.PutItem(put); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f.Items("things")); got != 1 {
+		t.Errorf("got %d items, want 1", got)
+	}
+	if got := f.Calls("PutItem"); got != 3 {
+		t.Errorf("got %d calls, want 3", got)
+	}
+}
+
+func TestFaultMatching(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault Fault
+		calls []string // ops called in order
+		fails []bool   // whether each call is expected to fail
+	}{
+		{
+			name:  "once",
+			fault: Fault{Op: "GetItem"},
+			calls: []string{"GetItem", "GetItem"},
+			fails: []bool{true, false},
+		},
+		{
+			name:  "other op",
+			fault: Fault{Op: "GetItem"},
+			calls: []string{"PutItem", "GetItem", "GetItem"},
+			fails: []bool{false, true, false},
+		},
+		{
+			name:  "any op",
+			fault: Fault{Times: 2},
+			calls: []string{"PutItem", "GetItem", "GetItem"},
+			fails: []bool{true, true, false},
+		},
+		{
+			name:  "until cleared",
+			fault: Fault{Op: "GetItem", Times: -1},
+			calls: []string{"GetItem", "GetItem", "GetItem", "PutItem"},
+			fails: []bool{true, true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFake(t)
+			tt.fault.Err = NewError(dynamodb.ErrCodeProvisionedThroughputExceededException, "injected fault")
+			f.InjectFault(tt.fault)
+			for i, op := range tt.calls {
+				var err error
+				switch op {
+				case "GetItem":
+					_, err = f.GetItem(&dynamodb.GetItemInput{TableName: aws.String("things"), Key: item{"ID": sv("a")}})
+				case "PutItem":
+					_, err = f.PutItem(&dynamodb.PutItemInput{TableName: aws.String("things"), Item: item{"ID": sv("a")}})
+				}
+				if (err != nil) != tt.fails[i] {
+					t.Errorf("call %d (%s): got error %v, want failure %v", i, op, err, tt.fails[i])
+				}
+			}
+			f.ClearFaults()
+			if _, err := f.GetItem(&dynamodb.GetItemInput{TableName: aws.String("things"), Key: item{"ID": sv("a")}}); err != nil {
+				t.Errorf("after ClearFaults: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnprocessedBatchWrite(t *testing.T) {
+	f := newTestFake(t)
+	f.InjectFault(Fault{Op: "BatchWriteItem", Unprocessed: 2})
+
+	out, err := f.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"things": putRequests("a", "b", "c")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(out.UnprocessedItems["things"]); got != 2 {
+		t.Fatalf("got %d unprocessed, want 2", got)
+	}
+	if got := len(f.Items("things")); got != 1 {
+		t.Errorf("got %d items stored, want 1", got)
+	}
+
+	out, err = f.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: out.UnprocessedItems})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.UnprocessedItems) != 0 {
+		t.Errorf("got unprocessed %v on retry", out.UnprocessedItems)
+	}
+	if got := len(f.Items("things")); got != 3 {
+		t.Errorf("got %d items stored, want 3", got)
+	}
+}
+
+func TestUnprocessedBatchGet(t *testing.T) {
+	f := newTestFake(t)
+	if _, err := f.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"things": putRequests("a", "b", "c")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f.InjectFault(Fault{Op: "BatchGetItem", Unprocessed: 1})
+
+	keys := []map[string]*dynamodb.AttributeValue{{"ID": sv("a")}, {"ID": sv("b")}, {"ID": sv("c")}}
+	out, err := f.BatchGetItem(&dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{"things": {Keys: keys}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(out.Responses["things"]); got != 2 {
+		t.Errorf("got %d items, want 2", got)
+	}
+	if got := len(out.UnprocessedKeys["things"].Keys); got != 1 {
+		t.Errorf("got %d unprocessed keys, want 1", got)
+	}
+}
+
+func TestStatusPolls(t *testing.T) {
+	f := newTestFake(t)
+	f.StatusPolls = 2
+	input := &dynamodb.CreateTableInput{
+		TableName:            aws.String("others"),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String("ID"), AttributeType: aws.String("S")}},
+		KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String("ID"), KeyType: aws.String("HASH")}},
+		BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+	}
+	out, err := f.CreateTable(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(out.TableDescription.TableStatus); got != dynamodb.TableStatusCreating {
+		t.Errorf("CreateTable: got status %s, want CREATING", got)
+	}
+	status := func(name string) string {
+		out, err := f.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(name)})
+		if errCode(err) == dynamodb.ErrCodeResourceNotFoundException {
+			return "NOT_FOUND"
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aws.StringValue(out.Table.TableStatus)
+	}
+	for i, want := range []string{"CREATING", "CREATING", "ACTIVE", "ACTIVE"} {
+		if got := status("others"); got != want {
+			t.Errorf("poll %d: got %s, want %s", i, got, want)
+		}
+	}
+	if got := status("things"); got != "ACTIVE" {
+		t.Errorf("table created before StatusPolls was set: got %s, want ACTIVE", got)
+	}
+
+	if _, err := f.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String("others")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.CreateTable(input); errCode(err) != dynamodb.ErrCodeResourceInUseException {
+		t.Errorf("CreateTable while deleting: got %v, want ResourceInUseException", err)
+	}
+	for i, want := range []string{"DELETING", "DELETING", "NOT_FOUND", "NOT_FOUND"} {
+		if got := status("others"); got != want {
+			t.Errorf("poll %d: got %s, want %s", i, got, want)
+		}
+	}
+	if _, err := f.CreateTable(input); err != nil {
+		t.Errorf("CreateTable after deletion: %v", err)
+	}
+}
+
+func TestKeySchema(t *testing.T) {
+	f := newTestFake(t)
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"put without key", func() error {
+			_, err := f.PutItem(&dynamodb.PutItemInput{TableName: aws.String("things"), Item: item{"Title": sv("x")}})
+			return err
+		}},
+		{"put number key", func() error {
+			_, err := f.PutItem(&dynamodb.PutItemInput{TableName: aws.String("things"), Item: item{"ID": nv("1")}})
+			return err
+		}},
+		{"get extra key attribute", func() error {
+			_, err := f.GetItem(&dynamodb.GetItemInput{TableName: aws.String("things"), Key: item{"ID": sv("a"), "Sort": nv("1")}})
+			return err
+		}},
+		{"delete without key", func() error {
+			_, err := f.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String("things"), Key: item{}})
+			return err
+		}},
+		{"batch write without key", func() error {
+			_, err := f.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{
+				"things": {{PutRequest: &dynamodb.PutRequest{Item: item{"Title": sv("x")}}}},
+			}})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		if code := errCode(tt.call()); code != "ValidationException" {
+			t.Errorf("%s: got code %q, want ValidationException", tt.name, code)
+		}
+	}
+	if n := len(f.Items("things")); n != 0 {
+		t.Errorf("got %d items, want 0", n)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	f := newTestFake(t)
+	if _, err := f.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"things": putRequests("a", "b", "c", "d", "e")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	f.PageSize = 2
+
+	var pages []int
+	input := &dynamodb.ScanInput{TableName: aws.String("things")}
+	for {
+		out, err := f.Scan(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, len(out.Items))
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	if want := []int{2, 2, 1}; !slices.Equal(pages, want) {
+		t.Errorf("got pages of %v items, want %v", pages, want)
+	}
+
+	out, err := f.Scan(&dynamodb.ScanInput{TableName: aws.String("things"), Limit: aws.Int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != 1 || out.LastEvaluatedKey == nil {
+		t.Errorf("Limit below PageSize: got %d items and LastEvaluatedKey %v, want 1 and a key", len(out.Items), out.LastEvaluatedKey)
+	}
+}
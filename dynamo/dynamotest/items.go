@@ -0,0 +1,814 @@
+// Package dynamotest provides an in-memory implementation of the DynamoDB API
+// for testing code built on the dynamo package without network access.
+// This file contains the item, batch, query and scan operations of the Fake client.
+package dynamotest
+
+import (
+	"hash/fnv"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// attrType returns the type declared for a key attribute in the table's AttributeDefinitions.
+func (t *table) attrType(name string) string {
+	for _, d := range t.desc.AttributeDefinitions {
+		if aws.StringValue(d.AttributeName) == name {
+			return aws.StringValue(d.AttributeType)
+		}
+	}
+	return ""
+}
+
+// checkKeyAttr validates that it holds a non-empty value of the declared type for name.
+func (t *table) checkKeyAttr(it map[string]*dynamodb.AttributeValue, name string) error {
+	av, ok := it[name]
+	if !ok || av == nil {
+		return validationErr("One or more parameter values were invalid: Missing the key %s in the item", name)
+	}
+	typ := t.attrType(name)
+	if avType(av) != typ {
+		return validationErr("One or more parameter values were invalid: Type mismatch for key %s expected: %s actual: %s", name, typ, avType(av))
+	}
+	if (typ == "S" && *av.S == "") || (typ == "B" && len(av.B) == 0) {
+		return validationErr("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %s", name)
+	}
+	return nil
+}
+
+// checkItem validates the primary key of a full item and returns its encoding.
+func (t *table) checkItem(it map[string]*dynamodb.AttributeValue) (string, error) {
+	if err := t.checkKeyAttr(it, t.hash); err != nil {
+		return "", err
+	}
+	if t.rng != "" {
+		if err := t.checkKeyAttr(it, t.rng); err != nil {
+			return "", err
+		}
+	}
+	for _, idx := range t.indexes {
+		for _, n := range []string{idx.hash, idx.rng} {
+			if av, ok := it[n]; n != "" && ok && avType(av) != t.attrType(n) {
+				return "", validationErr("One or more parameter values were invalid: Type mismatch for Index Key %s Expected: %s Actual: %s IndexName: %s", n, t.attrType(n), avType(av), idx.name)
+			}
+		}
+	}
+	return t.encodeKey(it), nil
+}
+
+// checkKey validates a key map, which must contain exactly the primary key attributes.
+func (t *table) checkKey(key map[string]*dynamodb.AttributeValue) (string, error) {
+	want := 1
+	if t.rng != "" {
+		want = 2
+	}
+	if len(key) != want {
+		return "", validationErr("The provided key element does not match the schema")
+	}
+	if err := t.checkKeyAttr(key, t.hash); err != nil {
+		return "", validationErr("The provided key element does not match the schema")
+	}
+	if t.rng != "" {
+		if err := t.checkKeyAttr(key, t.rng); err != nil {
+			return "", validationErr("The provided key element does not match the schema")
+		}
+	}
+	return t.encodeKey(key), nil
+}
+
+func (t *table) encodeKey(it map[string]*dynamodb.AttributeValue) string {
+	k := encodeKeyValue(it[t.hash])
+	if t.rng != "" {
+		k += "|" + encodeKeyValue(it[t.rng])
+	}
+	return k
+}
+
+// keyAttrs returns the primary key attributes of it.
+func (t *table) keyAttrs(it item) item {
+	k := item{t.hash: cloneAV(it[t.hash])}
+	if t.rng != "" {
+		k[t.rng] = cloneAV(it[t.rng])
+	}
+	return k
+}
+
+// conditionFailed returns a ConditionalCheckFailedException, carrying old
+// when the request asked for ALL_OLD values on condition check failure.
+func conditionFailed(old item, returnValues *string) error {
+	err := &dynamodb.ConditionalCheckFailedException{Message_: aws.String("The conditional request failed")}
+	err.RespMetadata.StatusCode = 400
+	if aws.StringValue(returnValues) == dynamodb.ReturnValuesOnConditionCheckFailureAllOld && old != nil {
+		err.Item = cloneItem(old)
+	}
+	return err
+}
+
+// checkCondition evaluates an optional condition expression against old,
+// which is nil if the item does not exist.
+func checkCondition(ctx *exprContext, expr *string, old item, returnValues *string) error {
+	if expr == nil {
+		return nil
+	}
+	c, err := parseCondition(ctx, *expr)
+	if err != nil {
+		return validationErr("Invalid ConditionExpression: %v", err)
+	}
+	if err := ctx.checkUnused(); err != nil {
+		return validationErr("%v", err)
+	}
+	target := old
+	if target == nil {
+		target = item{}
+	}
+	ok, err := c.test(target)
+	if err != nil {
+		return validationErr("Invalid ConditionExpression: %v", err)
+	}
+	if !ok {
+		return conditionFailed(old, returnValues)
+	}
+	return nil
+}
+
+// PutItem creates or replaces an item.
+func (f *Fake) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.PutItemOutput{}
+	if fault := f.begin("PutItem"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	k, out, err := t.put(input)
+	if err != nil {
+		return out, err
+	}
+	t.items[k] = cloneItem(input.Item)
+	return out, nil
+}
+
+// put evaluates a PutItem request against t without storing the item.
+// It returns the encoded key of the item.
+func (t *table) put(input *dynamodb.PutItemInput) (string, *dynamodb.PutItemOutput, error) {
+	out := &dynamodb.PutItemOutput{}
+	k, err := t.checkItem(input.Item)
+	if err != nil {
+		return k, out, err
+	}
+	old := t.items[k]
+	ctx := newExprContext(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err := checkCondition(ctx, input.ConditionExpression, old, input.ReturnValuesOnConditionCheckFailure); err != nil {
+		return k, out, err
+	}
+	if input.ConditionExpression == nil {
+		if err := ctx.checkUnused(); err != nil {
+			return k, out, validationErr("%v", err)
+		}
+	}
+	switch rv := aws.StringValue(input.ReturnValues); rv {
+	case "", dynamodb.ReturnValueNone:
+	case dynamodb.ReturnValueAllOld:
+		out.Attributes = cloneItem(old)
+	default:
+		return k, out, validationErr("ReturnValues can only be ALL_OLD or NONE")
+	}
+	return k, out, nil
+}
+
+// GetItem returns a single item by primary key.
+func (f *Fake) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.GetItemOutput{}
+	if fault := f.begin("GetItem"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	return t.get(input)
+}
+
+// get returns the item of t requested by a GetItem request.
+func (t *table) get(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	out := &dynamodb.GetItemOutput{}
+	k, err := t.checkKey(input.Key)
+	if err != nil {
+		return out, err
+	}
+	ctx := newExprContext(input.ExpressionAttributeNames, nil)
+	var paths []docPath
+	if input.ProjectionExpression != nil {
+		if paths, err = parseProjection(ctx, *input.ProjectionExpression); err != nil {
+			return out, validationErr("Invalid ProjectionExpression: %v", err)
+		}
+	}
+	if err := ctx.checkUnused(); err != nil {
+		return out, validationErr("%v", err)
+	}
+	if it, ok := t.items[k]; ok {
+		if paths != nil {
+			out.Item = project(it, paths)
+		} else {
+			out.Item = cloneItem(it)
+		}
+	}
+	return out, nil
+}
+
+// UpdateItem edits an existing item or creates it from the key and update expression.
+func (f *Fake) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.UpdateItemOutput{}
+	if fault := f.begin("UpdateItem"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	k, updated, out, err := t.update(input)
+	if err != nil {
+		return out, err
+	}
+	t.items[k] = updated
+	return out, nil
+}
+
+// update evaluates an UpdateItem request against t without storing the result.
+// It returns the encoded key of the item and its updated value.
+func (t *table) update(input *dynamodb.UpdateItemInput) (string, item, *dynamodb.UpdateItemOutput, error) {
+	out := &dynamodb.UpdateItemOutput{}
+	k, err := t.checkKey(input.Key)
+	if err != nil {
+		return k, nil, out, err
+	}
+	old := t.items[k]
+
+	ctx := newExprContext(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	var actions []updateAction
+	if input.UpdateExpression != nil {
+		if actions, err = parseUpdate(ctx, *input.UpdateExpression); err != nil {
+			return k, nil, out, validationErr("%v", err)
+		}
+	}
+	for _, a := range actions {
+		if a.path[0].name == t.hash || a.path[0].name == t.rng {
+			return k, nil, out, validationErr("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", a.path[0].name)
+		}
+	}
+	if err := checkCondition(ctx, input.ConditionExpression, old, input.ReturnValuesOnConditionCheckFailure); err != nil {
+		return k, nil, out, err
+	}
+	if err := ctx.checkUnused(); err != nil {
+		return k, nil, out, validationErr("%v", err)
+	}
+
+	base := old
+	if base == nil {
+		base = item(cloneItem(input.Key))
+	}
+	updated, err := applyUpdate(base, actions)
+	if err != nil {
+		return k, nil, out, validationErr("%v", err)
+	}
+	if _, err := t.checkItem(updated); err != nil {
+		return k, nil, out, err
+	}
+
+	touched := func(src item) map[string]*dynamodb.AttributeValue {
+		m := map[string]*dynamodb.AttributeValue{}
+		for _, a := range actions {
+			if v, ok := src[a.path[0].name]; ok {
+				m[a.path[0].name] = cloneAV(v)
+			}
+		}
+		return m
+	}
+	switch rv := aws.StringValue(input.ReturnValues); rv {
+	case "", dynamodb.ReturnValueNone:
+	case dynamodb.ReturnValueAllOld:
+		out.Attributes = cloneItem(old)
+	case dynamodb.ReturnValueUpdatedOld:
+		out.Attributes = touched(old)
+	case dynamodb.ReturnValueAllNew:
+		out.Attributes = cloneItem(updated)
+	case dynamodb.ReturnValueUpdatedNew:
+		out.Attributes = touched(updated)
+	default:
+		return k, nil, out, validationErr("Invalid ReturnValues: %s", rv)
+	}
+	return k, updated, out, nil
+}
+
+// DeleteItem deletes a single item by primary key.
+func (f *Fake) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.DeleteItemOutput{}
+	if fault := f.begin("DeleteItem"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	k, out, err := t.del(input)
+	if err != nil {
+		return out, err
+	}
+	delete(t.items, k)
+	return out, nil
+}
+
+// del evaluates a DeleteItem request against t without deleting the item.
+// It returns the encoded key of the item.
+func (t *table) del(input *dynamodb.DeleteItemInput) (string, *dynamodb.DeleteItemOutput, error) {
+	out := &dynamodb.DeleteItemOutput{}
+	k, err := t.checkKey(input.Key)
+	if err != nil {
+		return k, out, err
+	}
+	old := t.items[k]
+	ctx := newExprContext(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err := checkCondition(ctx, input.ConditionExpression, old, input.ReturnValuesOnConditionCheckFailure); err != nil {
+		return k, out, err
+	}
+	if input.ConditionExpression == nil {
+		if err := ctx.checkUnused(); err != nil {
+			return k, out, validationErr("%v", err)
+		}
+	}
+	switch rv := aws.StringValue(input.ReturnValues); rv {
+	case "", dynamodb.ReturnValueNone:
+	case dynamodb.ReturnValueAllOld:
+		out.Attributes = cloneItem(old)
+	default:
+		return k, out, validationErr("ReturnValues can only be ALL_OLD or NONE")
+	}
+	return k, out, nil
+}
+
+// BatchWriteItem applies up to 25 put and delete requests across one or more tables.
+// A Fault with Unprocessed > 0 leaves that many requests unapplied and returns them
+// in UnprocessedItems.
+func (f *Fake) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.BatchWriteItemOutput{}
+	fault := f.begin("BatchWriteItem")
+	if fault.Err != nil {
+		return out, fault.Err
+	}
+
+	type write struct {
+		table string
+		t     *table
+		key   string
+		wr    *dynamodb.WriteRequest
+	}
+	writes := []write{}
+	for _, name := range sortedNames(input.RequestItems) {
+		t, err := f.table(aws.String(name))
+		if err != nil {
+			return out, err
+		}
+		seen := map[string]bool{}
+		for _, wr := range input.RequestItems[name] {
+			var k string
+			switch {
+			case wr == nil || (wr.PutRequest == nil) == (wr.DeleteRequest == nil):
+				return out, validationErr("Supplied AttributeValue has more than one datatypes set, must contain exactly one of the supported datatypes")
+			case wr.PutRequest != nil:
+				k, err = t.checkItem(wr.PutRequest.Item)
+			default:
+				k, err = t.checkKey(wr.DeleteRequest.Key)
+			}
+			if err != nil {
+				return out, err
+			}
+			if seen[k] {
+				return out, validationErr("Provided list of item keys contains duplicates")
+			}
+			seen[k] = true
+			writes = append(writes, write{name, t, k, wr})
+		}
+	}
+	if len(writes) == 0 || len(writes) > 25 {
+		return out, validationErr("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Map value must satisfy constraint: [Member must have length less than or equal to 25, Member must have length greater than or equal to 1]")
+	}
+
+	n := len(writes) - fault.Unprocessed
+	if n < 0 {
+		n = 0
+	}
+	for _, w := range writes[:n] {
+		if w.wr.PutRequest != nil {
+			w.t.items[w.key] = cloneItem(w.wr.PutRequest.Item)
+		} else {
+			delete(w.t.items, w.key)
+		}
+	}
+	out.UnprocessedItems = map[string][]*dynamodb.WriteRequest{}
+	for _, w := range writes[n:] {
+		out.UnprocessedItems[w.table] = append(out.UnprocessedItems[w.table], w.wr)
+	}
+	return out, nil
+}
+
+// BatchGetItem returns up to 100 items by primary key across one or more tables.
+// As with DynamoDB, Responses are not returned in request order.
+// A Fault with Unprocessed > 0 returns that many keys in UnprocessedKeys.
+func (f *Fake) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.BatchGetItemOutput{}
+	fault := f.begin("BatchGetItem")
+	if fault.Err != nil {
+		return out, fault.Err
+	}
+
+	type get struct {
+		table string
+		t     *table
+		key   string
+		raw   map[string]*dynamodb.AttributeValue
+		ka    *dynamodb.KeysAndAttributes
+		paths []docPath
+	}
+	gets := []get{}
+	for _, name := range sortedNames(input.RequestItems) {
+		t, err := f.table(aws.String(name))
+		if err != nil {
+			return out, err
+		}
+		ka := input.RequestItems[name]
+		if ka == nil || len(ka.Keys) == 0 {
+			return out, validationErr("1 validation error detected: Value at 'requestItems.%s.member.keys' failed to satisfy constraint: Member must have length greater than or equal to 1", name)
+		}
+		ctx := newExprContext(ka.ExpressionAttributeNames, nil)
+		var paths []docPath
+		if ka.ProjectionExpression != nil {
+			if paths, err = parseProjection(ctx, *ka.ProjectionExpression); err != nil {
+				return out, validationErr("Invalid ProjectionExpression: %v", err)
+			}
+		}
+		if err := ctx.checkUnused(); err != nil {
+			return out, validationErr("%v", err)
+		}
+		seen := map[string]bool{}
+		for _, key := range ka.Keys {
+			k, err := t.checkKey(key)
+			if err != nil {
+				return out, err
+			}
+			if seen[k] {
+				return out, validationErr("Provided list of item keys contains duplicates")
+			}
+			seen[k] = true
+			gets = append(gets, get{name, t, k, key, ka, paths})
+		}
+	}
+	if len(gets) > 100 {
+		return out, validationErr("Too many items requested for the BatchGetItem call")
+	}
+
+	n := len(gets) - fault.Unprocessed
+	if n < 0 {
+		n = 0
+	}
+	out.Responses = map[string][]map[string]*dynamodb.AttributeValue{}
+	found := map[string][]get{}
+	for _, g := range gets[:n] {
+		out.Responses[g.table] = []map[string]*dynamodb.AttributeValue{}
+		if _, ok := g.t.items[g.key]; ok {
+			found[g.table] = append(found[g.table], g)
+		}
+	}
+	for name, gs := range found {
+		// responses are ordered by stored key rather than request order
+		sort.Slice(gs, func(i, j int) bool { return gs[i].key < gs[j].key })
+		for _, g := range gs {
+			it := g.t.items[g.key]
+			if g.paths != nil {
+				out.Responses[name] = append(out.Responses[name], project(it, g.paths))
+			} else {
+				out.Responses[name] = append(out.Responses[name], cloneItem(it))
+			}
+		}
+	}
+	out.UnprocessedKeys = map[string]*dynamodb.KeysAndAttributes{}
+	for _, g := range gets[n:] {
+		ka, ok := out.UnprocessedKeys[g.table]
+		if !ok {
+			ka = &dynamodb.KeysAndAttributes{
+				ConsistentRead:           g.ka.ConsistentRead,
+				ExpressionAttributeNames: g.ka.ExpressionAttributeNames,
+				ProjectionExpression:     g.ka.ProjectionExpression,
+			}
+			out.UnprocessedKeys[g.table] = ka
+		}
+		ka.Keys = append(ka.Keys, cloneItem(g.raw))
+	}
+	return out, nil
+}
+
+// view describes the key schema of a table or one of its indexes.
+type view struct {
+	t    *table
+	idx  *index
+	hash string
+	rng  string
+}
+
+// view returns the key schema to read from, which is the named index if set.
+func (t *table) view(indexName *string) (*view, error) {
+	if indexName == nil {
+		return &view{t: t, hash: t.hash, rng: t.rng}, nil
+	}
+	idx, ok := t.indexes[*indexName]
+	if !ok {
+		return nil, validationErr("The table does not have the specified index: %s", *indexName)
+	}
+	return &view{t: t, idx: idx, hash: idx.hash, rng: idx.rng}, nil
+}
+
+// keyAttrs returns the attributes that make up a LastEvaluatedKey for the view.
+func (v *view) keyAttrs(it item) item {
+	k := v.t.keyAttrs(it)
+	k[v.hash] = cloneAV(it[v.hash])
+	if v.rng != "" {
+		k[v.rng] = cloneAV(it[v.rng])
+	}
+	return k
+}
+
+// rows returns the items visible through the view with the view's projection applied.
+func (v *view) rows() []item {
+	rows := []item{}
+	for _, it := range v.t.items {
+		if v.idx == nil {
+			rows = append(rows, it)
+			continue
+		}
+		if it[v.hash] == nil || (v.rng != "" && it[v.rng] == nil) {
+			continue // sparse index
+		}
+		switch aws.StringValue(v.idx.projection.ProjectionType) {
+		case dynamodb.ProjectionTypeAll:
+			rows = append(rows, it)
+		default:
+			r := v.keyAttrs(it)
+			for _, n := range v.idx.projection.NonKeyAttributes {
+				if av, ok := it[aws.StringValue(n)]; ok {
+					r[aws.StringValue(n)] = av
+				}
+			}
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// order returns the position of it in a scan of the view.
+func (v *view) order(it item) string {
+	if v.idx == nil {
+		return v.t.encodeKey(it)
+	}
+	return encodeKeyValue(it[v.hash]) + "\x00" + encodeKeyValue(it[v.rng]) + "\x00" + v.t.encodeKey(it)
+}
+
+// compareRange orders two items of the same partition by sort key, then primary key.
+func (v *view) compareRange(a, b item) int {
+	if v.rng != "" {
+		if c, ok := compareAV(a[v.rng], b[v.rng]); ok && c != 0 {
+			return c
+		}
+	}
+	ka, kb := v.t.encodeKey(a), v.t.encodeKey(b)
+	switch {
+	case ka < kb:
+		return -1
+	case ka > kb:
+		return 1
+	}
+	return 0
+}
+
+// readParams holds the parsed expressions shared by Query and Scan.
+type readParams struct {
+	filter     condition
+	projection []docPath
+	count      bool
+}
+
+func parseReadParams(ctx *exprContext, filter, projection, sel *string) (*readParams, error) {
+	p := &readParams{}
+	var err error
+	if filter != nil {
+		if p.filter, err = parseCondition(ctx, *filter); err != nil {
+			return nil, validationErr("Invalid FilterExpression: %v", err)
+		}
+	}
+	if projection != nil {
+		if p.projection, err = parseProjection(ctx, *projection); err != nil {
+			return nil, validationErr("Invalid ProjectionExpression: %v", err)
+		}
+	}
+	switch s := aws.StringValue(sel); s {
+	case "", dynamodb.SelectAllAttributes, dynamodb.SelectAllProjectedAttributes, dynamodb.SelectSpecificAttributes:
+	case dynamodb.SelectCount:
+		p.count = true
+	default:
+		return nil, validationErr("Invalid Select: %s", s)
+	}
+	if err := ctx.checkUnused(); err != nil {
+		return nil, validationErr("%v", err)
+	}
+	return p, nil
+}
+
+// page evaluates up to limit of the ordered rows, applying the filter and projection.
+// It returns the matched items, the number evaluated and the last evaluated row
+// if rows remain.
+func (f *Fake) page(rows []item, limit int64, p *readParams) ([]map[string]*dynamodb.AttributeValue, int64, item, error) {
+	max := len(rows)
+	if limit > 0 && int(limit) < max {
+		max = int(limit)
+	}
+	if f.PageSize > 0 && f.PageSize < max {
+		max = f.PageSize
+	}
+	items := []map[string]*dynamodb.AttributeValue{}
+	for _, it := range rows[:max] {
+		if p.filter != nil {
+			ok, err := p.filter.test(it)
+			if err != nil {
+				return nil, 0, nil, validationErr("Invalid FilterExpression: %v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		if p.projection != nil {
+			items = append(items, project(it, p.projection))
+		} else {
+			items = append(items, cloneItem(it))
+		}
+	}
+	var last item
+	if max < len(rows) {
+		last = rows[max-1]
+	}
+	return items, int64(max), last, nil
+}
+
+// Query returns the items of one partition of a table or index, ordered by sort key.
+func (f *Fake) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.QueryOutput{}
+	if fault := f.begin("Query"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	v, err := t.view(input.IndexName)
+	if err != nil {
+		return out, err
+	}
+	if input.KeyConditionExpression == nil {
+		return out, validationErr("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+	ctx := newExprContext(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	kc, err := parseKeyCondition(ctx, *input.KeyConditionExpression, v.hash, v.rng)
+	if err != nil {
+		return out, validationErr("%v", err)
+	}
+	p, err := parseReadParams(ctx, input.FilterExpression, input.ProjectionExpression, input.Select)
+	if err != nil {
+		return out, err
+	}
+
+	rows := []item{}
+	for _, it := range v.rows() {
+		if !equalAV(it[v.hash], kc.hashValue) {
+			continue
+		}
+		if kc.rangeCond != nil {
+			ok, err := kc.rangeCond.test(it)
+			if err != nil {
+				return out, validationErr("%v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		rows = append(rows, it)
+	}
+	forward := input.ScanIndexForward == nil || *input.ScanIndexForward
+	sort.Slice(rows, func(i, j int) bool {
+		c := v.compareRange(rows[i], rows[j])
+		if !forward {
+			c = -c
+		}
+		return c < 0
+	})
+	if input.ExclusiveStartKey != nil {
+		start := item(input.ExclusiveStartKey)
+		i := sort.Search(len(rows), func(i int) bool {
+			c := v.compareRange(rows[i], start)
+			if !forward {
+				c = -c
+			}
+			return c > 0
+		})
+		rows = rows[i:]
+	}
+
+	items, scanned, last, err := f.page(rows, aws.Int64Value(input.Limit), p)
+	if err != nil {
+		return out, err
+	}
+	out.Count = aws.Int64(int64(len(items)))
+	out.ScannedCount = aws.Int64(scanned)
+	if !p.count {
+		out.Items = items
+	}
+	if last != nil {
+		out.LastEvaluatedKey = v.keyAttrs(last)
+	}
+	return out, nil
+}
+
+// Scan returns every item of a table or index, optionally restricted to one
+// of TotalSegments segments.
+func (f *Fake) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.ScanOutput{}
+	if fault := f.begin("Scan"); fault.Err != nil {
+		return out, fault.Err
+	}
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return out, err
+	}
+	v, err := t.view(input.IndexName)
+	if err != nil {
+		return out, err
+	}
+	if (input.Segment == nil) != (input.TotalSegments == nil) {
+		return out, validationErr("The TotalSegments parameter is required but was not present in the request when Segment parameter is present")
+	}
+	segments := aws.Int64Value(input.TotalSegments)
+	if input.TotalSegments != nil && (segments < 1 || segments > 1000000 || *input.Segment < 0 || *input.Segment >= segments) {
+		return out, validationErr("The Segment parameter must be less than TotalSegments")
+	}
+	ctx := newExprContext(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	p, err := parseReadParams(ctx, input.FilterExpression, input.ProjectionExpression, input.Select)
+	if err != nil {
+		return out, err
+	}
+
+	rows := []item{}
+	for _, it := range v.rows() {
+		if segments > 0 {
+			h := fnv.New32a()
+			h.Write([]byte(encodeKeyValue(it[v.hash])))
+			if int64(h.Sum32())%segments != *input.Segment {
+				continue
+			}
+		}
+		rows = append(rows, it)
+	}
+	sort.Slice(rows, func(i, j int) bool { return v.order(rows[i]) < v.order(rows[j]) })
+	if input.ExclusiveStartKey != nil {
+		start := v.order(item(input.ExclusiveStartKey))
+		i := sort.Search(len(rows), func(i int) bool { return v.order(rows[i]) > start })
+		rows = rows[i:]
+	}
+
+	items, scanned, last, err := f.page(rows, aws.Int64Value(input.Limit), p)
+	if err != nil {
+		return out, err
+	}
+	out.Count = aws.Int64(int64(len(items)))
+	out.ScannedCount = aws.Int64(scanned)
+	if !p.count {
+		out.Items = items
+	}
+	if last != nil {
+		out.LastEvaluatedKey = v.keyAttrs(last)
+	}
+	return out, nil
+}
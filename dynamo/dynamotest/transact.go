@@ -0,0 +1,226 @@
+// Package dynamotest provides an in-memory implementation of the DynamoDB API
+// for testing code built on the dynamo package without network access.
+// This file contains the transactional operations of the Fake client.
+package dynamotest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// maxTransactItems is the maximum number of operations in a transaction.
+const maxTransactItems = 100
+
+// transactWrite is a write evaluated by TransactWriteItems, applied once every
+// operation of the transaction has succeeded.
+type transactWrite struct {
+	t   *table
+	k   string
+	it  item // nil for a delete
+	del bool
+}
+
+// TransactWriteItems applies up to 100 Put, Update, Delete and ConditionCheck
+// operations across one or more tables, all together or not at all. If the
+// condition of any operation is not met, a TransactionCanceledException is
+// returned with one cancellation reason per operation. A call repeating the
+// ClientRequestToken of an earlier successful call is not applied again.
+func (f *Fake) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.TransactWriteItemsOutput{}
+	if fault := f.begin("TransactWriteItems"); fault.Err != nil {
+		return out, fault.Err
+	}
+	if n := len(input.TransactItems); n == 0 || n > maxTransactItems {
+		return out, validationErr("Member must have length less than or equal to %d and greater than or equal to 1", maxTransactItems)
+	}
+	token := aws.StringValue(input.ClientRequestToken)
+	if token != "" && f.tokens[token] {
+		return out, nil
+	}
+
+	var writes []transactWrite
+	reasons := make([]*dynamodb.CancellationReason, len(input.TransactItems))
+	canceled := false
+	seen := map[string]bool{}
+	for i, ti := range input.TransactItems {
+		w, err := f.transactWrite(ti)
+		if w.t != nil && w.k != "" {
+			id := aws.StringValue(w.t.desc.TableName) + "/" + w.k
+			if seen[id] {
+				return out, validationErr("Transaction request cannot include multiple operations on one item")
+			}
+			seen[id] = true
+		}
+		var ccf *dynamodb.ConditionalCheckFailedException
+		switch {
+		case errors.As(err, &ccf):
+			reasons[i] = &dynamodb.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Item:    ccf.Item,
+				Message: ccf.Message_,
+			}
+			canceled = true
+		case err != nil:
+			return out, err
+		default:
+			reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+			if w.it != nil || w.del {
+				writes = append(writes, w)
+			}
+		}
+	}
+	if canceled {
+		return out, cancellation(reasons)
+	}
+
+	for _, w := range writes {
+		if w.del {
+			delete(w.t.items, w.k)
+		} else {
+			w.t.items[w.k] = w.it
+		}
+	}
+	if token != "" {
+		f.tokens[token] = true
+	}
+	return out, nil
+}
+
+// transactWrite evaluates one operation of a transaction without applying it.
+// The caller must hold f.mu.
+func (f *Fake) transactWrite(ti *dynamodb.TransactWriteItem) (transactWrite, error) {
+	set := 0
+	for _, ok := range []bool{ti.Put != nil, ti.Update != nil, ti.Delete != nil, ti.ConditionCheck != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return transactWrite{}, validationErr("TransactItems can only contain one of Check, Put, Update or Delete")
+	}
+
+	var w transactWrite
+	var err error
+	switch {
+	case ti.Put != nil:
+		p := ti.Put
+		if w.t, err = f.table(p.TableName); err != nil {
+			return w, err
+		}
+		w.k, _, err = w.t.put(&dynamodb.PutItemInput{
+			ConditionExpression:                 p.ConditionExpression,
+			ExpressionAttributeNames:            p.ExpressionAttributeNames,
+			ExpressionAttributeValues:           p.ExpressionAttributeValues,
+			Item:                                p.Item,
+			ReturnValuesOnConditionCheckFailure: p.ReturnValuesOnConditionCheckFailure,
+			TableName:                           p.TableName,
+		})
+		w.it = cloneItem(p.Item)
+	case ti.Update != nil:
+		u := ti.Update
+		if w.t, err = f.table(u.TableName); err != nil {
+			return w, err
+		}
+		w.k, w.it, _, err = w.t.update(&dynamodb.UpdateItemInput{
+			ConditionExpression:                 u.ConditionExpression,
+			ExpressionAttributeNames:            u.ExpressionAttributeNames,
+			ExpressionAttributeValues:           u.ExpressionAttributeValues,
+			Key:                                 u.Key,
+			ReturnValuesOnConditionCheckFailure: u.ReturnValuesOnConditionCheckFailure,
+			TableName:                           u.TableName,
+			UpdateExpression:                    u.UpdateExpression,
+		})
+	case ti.Delete != nil:
+		d := ti.Delete
+		if w.t, err = f.table(d.TableName); err != nil {
+			return w, err
+		}
+		w.k, _, err = w.t.del(&dynamodb.DeleteItemInput{
+			ConditionExpression:                 d.ConditionExpression,
+			ExpressionAttributeNames:            d.ExpressionAttributeNames,
+			ExpressionAttributeValues:           d.ExpressionAttributeValues,
+			Key:                                 d.Key,
+			ReturnValuesOnConditionCheckFailure: d.ReturnValuesOnConditionCheckFailure,
+			TableName:                           d.TableName,
+		})
+		w.del = true
+	default:
+		c := ti.ConditionCheck
+		if c.ConditionExpression == nil {
+			return w, validationErr("ConditionCheck requires a ConditionExpression")
+		}
+		if w.t, err = f.table(c.TableName); err != nil {
+			return w, err
+		}
+		// a condition check is evaluated as a delete that is never applied
+		w.k, _, err = w.t.del(&dynamodb.DeleteItemInput{
+			ConditionExpression:                 c.ConditionExpression,
+			ExpressionAttributeNames:            c.ExpressionAttributeNames,
+			ExpressionAttributeValues:           c.ExpressionAttributeValues,
+			Key:                                 c.Key,
+			ReturnValuesOnConditionCheckFailure: c.ReturnValuesOnConditionCheckFailure,
+			TableName:                           c.TableName,
+		})
+	}
+	return w, err
+}
+
+// cancellation returns a TransactionCanceledException with the given reasons.
+func cancellation(reasons []*dynamodb.CancellationReason) error {
+	codes := make([]string, len(reasons))
+	for i, r := range reasons {
+		codes[i] = aws.StringValue(r.Code)
+	}
+	err := &dynamodb.TransactionCanceledException{
+		CancellationReasons: reasons,
+		Message_: aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]",
+			strings.Join(codes, ", "))),
+	}
+	err.RespMetadata.StatusCode = 400
+	return err
+}
+
+// TransactGetItems returns up to 100 items by primary key across one or more
+// tables, in the order they were requested. Items that do not exist have an
+// ItemResponse with no Item.
+func (f *Fake) TransactGetItems(input *dynamodb.TransactGetItemsInput) (*dynamodb.TransactGetItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.TransactGetItemsOutput{}
+	if fault := f.begin("TransactGetItems"); fault.Err != nil {
+		return out, fault.Err
+	}
+	if n := len(input.TransactItems); n == 0 || n > maxTransactItems {
+		return out, validationErr("Member must have length less than or equal to %d and greater than or equal to 1", maxTransactItems)
+	}
+
+	responses := make([]*dynamodb.ItemResponse, 0, len(input.TransactItems))
+	for _, ti := range input.TransactItems {
+		g := ti.Get
+		if g == nil {
+			return out, validationErr("TransactItems must contain a Get")
+		}
+		t, err := f.table(g.TableName)
+		if err != nil {
+			return out, err
+		}
+		got, err := t.get(&dynamodb.GetItemInput{
+			ExpressionAttributeNames: g.ExpressionAttributeNames,
+			Key:                      g.Key,
+			ProjectionExpression:     g.ProjectionExpression,
+			TableName:                g.TableName,
+		})
+		if err != nil {
+			return out, err
+		}
+		responses = append(responses, &dynamodb.ItemResponse{Item: got.Item})
+	}
+	out.Responses = responses
+	return out, nil
+}
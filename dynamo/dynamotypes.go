@@ -1,14 +1,17 @@
 // Package dynamo contains controls and objects for DynamoDB CRUD operations.
 // Operations in this package are abstracted from all other application logic
 // and are designed to be used with any DynamoDB table and any object schema.
-// This file defines the Table and Query objects, and functions for creating them.
+// This file defines the Table, Index and Query objects, and functions for creating them.
 // It also defines functions for creating DynamoDB AttributeValue objects and database keys in map format.
 package dynamo
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 // Table represents a table and holds basic information about it.
@@ -19,18 +22,221 @@ type Table struct {
 	PrimaryKeyType string
 	SortKeyName    string
 	SortKeyType    string
+
+	// GlobalIndexes and LocalIndexes describe the table's secondary indexes.
+	// A local index shares the table's partition key, so only its sort key is set.
+	GlobalIndexes []*Index
+	LocalIndexes  []*Index
+
+	// TTLAttributeName is the Number attribute holding each item's expiry time
+	// in epoch seconds, or "" if the table has no time to live.
+	// It is applied by Reconcile; CreateTable ignores it.
+	TTLAttributeName string
+	// VersionAttributeName is the Number attribute holding each item's version for
+	// optimistic locking, or "" to disable it. When set, CreateItem only replaces the
+	// item whose stored version equals the one being written and increments it, and
+	// every UpdateItem increments it. Writes of a stale version return an error
+	// matching ErrVersionConflict.
+	VersionAttributeName string
+
+	// BillingMode is "PAY_PER_REQUEST" (on-demand) or "PROVISIONED".
+	// "" is the same as "PAY_PER_REQUEST".
+	BillingMode string
+	// ReadCapacityUnits and WriteCapacityUnits are the throughput of a
+	// PROVISIONED table and must both be at least 1 in that mode.
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+	// TableClass is "STANDARD" or "STANDARD_INFREQUENT_ACCESS". "" is the same as "STANDARD".
+	TableClass string
+	// KMSKeyID enables server-side encryption with an AWS KMS key: the ID, ARN or
+	// alias of a customer managed key, or "alias/aws/dynamodb" for the AWS managed key.
+	// "" encrypts the table with a key owned by DynamoDB.
+	KMSKeyID string
+	// DeletionProtection prevents the table from being deleted while set.
+	DeletionProtection bool
+	// Tags are added to the table when it is created.
+	Tags map[string]string
+	// StreamViewType enables DynamoDB Streams with the given view of each modified
+	// item: "KEYS_ONLY", "NEW_IMAGE", "OLD_IMAGE" or "NEW_AND_OLD_IMAGES".
+	// "" disables the stream.
+	StreamViewType string
+	// PointInTimeRecovery enables continuous backups of the table.
+	// It is applied by Reconcile; CreateTable ignores it.
+	PointInTimeRecovery bool
+
+	// ItemCount and SizeBytes are the approximate number of items in the table and
+	// their total size, which DynamoDB updates about every six hours.
+	// They are set by DescribeTable and ignored when creating a table.
+	ItemCount int64
+	SizeBytes int64
+}
+
+// Index represents a secondary index of a Table.
+type Index struct {
+	IndexName      string
+	PrimaryKeyName string
+	PrimaryKeyType string
+	SortKeyName    string
+	SortKeyType    string
+
+	// ProjectionType is the set of attributes copied into the index:
+	// "ALL", "KEYS_ONLY" or "INCLUDE". "" is the same as "ALL".
+	ProjectionType string
+	// NonKeyAttributes names the attributes copied into an INCLUDE index
+	// in addition to the table and index keys.
+	NonKeyAttributes []string
+
+	// ReadCapacityUnits and WriteCapacityUnits are the throughput of a global
+	// index of a PROVISIONED table. Local indexes share the table's throughput.
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+}
+
+// validName matches the table and index names accepted by DynamoDB.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+
+// Validate reports whether t can be created in DynamoDB. Only the TableName and
+// PrimaryKeyName/PrimaryKeyType are required; SortKeyName and SortKeyType must be
+// set together. Key types must be "S", "N" or "B", as DynamoDB rejects other
+// types such as "BOOL" or "L" for keys. Capacity units must be set on the table
+// and its global indexes in PROVISIONED billing mode, and only in that mode.
+// The returned error matches ErrInvalidTable and describes the first problem found.
+func (t *Table) Validate() error {
+	if !validName.MatchString(t.TableName) {
+		return fmt.Errorf("%w: table name %q must be 3-255 characters of a-z, A-Z, 0-9, '_', '-' and '.'", ErrInvalidTable, t.TableName)
+	}
+	types := map[string]string{}
+	key := func(desc, name, typ string, required bool) error {
+		if name == "" && typ == "" && !required {
+			return nil
+		}
+		if name == "" {
+			return fmt.Errorf("%w: %s name is empty", ErrInvalidTable, desc)
+		}
+		if typ != "S" && typ != "N" && typ != "B" {
+			return fmt.Errorf("%w: %s %q has type %q; key types must be S, N or B", ErrInvalidTable, desc, name, typ)
+		}
+		if prev, ok := types[name]; ok && prev != typ {
+			return fmt.Errorf("%w: attribute %q is used as a key with both types %s and %s", ErrInvalidTable, name, prev, typ)
+		}
+		types[name] = typ
+		return nil
+	}
+
+	if err := key("partition key", t.PrimaryKeyName, t.PrimaryKeyType, true); err != nil {
+		return err
+	}
+	if err := key("sort key", t.SortKeyName, t.SortKeyType, false); err != nil {
+		return err
+	}
+	if t.SortKeyName != "" && t.SortKeyName == t.PrimaryKeyName {
+		return fmt.Errorf("%w: %q is both partition and sort key", ErrInvalidTable, t.PrimaryKeyName)
+	}
+	if v := t.VersionAttributeName; v != "" && (v == t.PrimaryKeyName || v == t.SortKeyName) {
+		return fmt.Errorf("%w: key attribute %q cannot be the version attribute", ErrInvalidTable, v)
+	}
+
+	provisioned := false
+	switch t.BillingMode {
+	case "", "PAY_PER_REQUEST":
+		if t.ReadCapacityUnits != 0 || t.WriteCapacityUnits != 0 {
+			return fmt.Errorf("%w: capacity units cannot be set in PAY_PER_REQUEST billing mode", ErrInvalidTable)
+		}
+	case "PROVISIONED":
+		provisioned = true
+		if t.ReadCapacityUnits < 1 || t.WriteCapacityUnits < 1 {
+			return fmt.Errorf("%w: read and write capacity units must be at least 1 in PROVISIONED billing mode", ErrInvalidTable)
+		}
+	default:
+		return fmt.Errorf("%w: invalid billing mode %q", ErrInvalidTable, t.BillingMode)
+	}
+	switch t.TableClass {
+	case "", "STANDARD", "STANDARD_INFREQUENT_ACCESS":
+	default:
+		return fmt.Errorf("%w: invalid table class %q", ErrInvalidTable, t.TableClass)
+	}
+	switch t.StreamViewType {
+	case "", "KEYS_ONLY", "NEW_IMAGE", "OLD_IMAGE", "NEW_AND_OLD_IMAGES":
+	default:
+		return fmt.Errorf("%w: invalid stream view type %q", ErrInvalidTable, t.StreamViewType)
+	}
+	for k := range t.Tags {
+		if k == "" {
+			return fmt.Errorf("%w: tag keys cannot be empty", ErrInvalidTable)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, idx := range t.GlobalIndexes {
+		if err := idx.validate(names); err != nil {
+			return err
+		}
+		if provisioned && (idx.ReadCapacityUnits < 1 || idx.WriteCapacityUnits < 1) {
+			return fmt.Errorf("%w: read and write capacity units of global index %s must be at least 1 in PROVISIONED billing mode", ErrInvalidTable, idx.IndexName)
+		}
+		if !provisioned && (idx.ReadCapacityUnits != 0 || idx.WriteCapacityUnits != 0) {
+			return fmt.Errorf("%w: capacity units of global index %s cannot be set in PAY_PER_REQUEST billing mode", ErrInvalidTable, idx.IndexName)
+		}
+		if err := key("partition key of "+idx.IndexName, idx.PrimaryKeyName, idx.PrimaryKeyType, true); err != nil {
+			return err
+		}
+		if err := key("sort key of "+idx.IndexName, idx.SortKeyName, idx.SortKeyType, false); err != nil {
+			return err
+		}
+	}
+	for _, idx := range t.LocalIndexes {
+		if err := idx.validate(names); err != nil {
+			return err
+		}
+		if t.SortKeyName == "" {
+			return fmt.Errorf("%w: local index %s requires the table to have a sort key", ErrInvalidTable, idx.IndexName)
+		}
+		if idx.PrimaryKeyName != "" && idx.PrimaryKeyName != t.PrimaryKeyName {
+			return fmt.Errorf("%w: local index %s must use the table partition key %q", ErrInvalidTable, idx.IndexName, t.PrimaryKeyName)
+		}
+		if err := key("sort key of "+idx.IndexName, idx.SortKeyName, idx.SortKeyType, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the name and projection of idx, recording its name in names
+// to detect duplicates.
+func (idx *Index) validate(names map[string]bool) error {
+	if !validName.MatchString(idx.IndexName) {
+		return fmt.Errorf("%w: index name %q must be 3-255 characters of a-z, A-Z, 0-9, '_', '-' and '.'", ErrInvalidTable, idx.IndexName)
+	}
+	if names[idx.IndexName] {
+		return fmt.Errorf("%w: duplicate index name %s", ErrInvalidTable, idx.IndexName)
+	}
+	names[idx.IndexName] = true
+	switch idx.ProjectionType {
+	case "", "ALL", "KEYS_ONLY":
+		if len(idx.NonKeyAttributes) > 0 {
+			return fmt.Errorf("%w: index %s has NonKeyAttributes but its projection is not INCLUDE", ErrInvalidTable, idx.IndexName)
+		}
+	case "INCLUDE":
+	default:
+		return fmt.Errorf("%w: index %s has invalid projection type %q", ErrInvalidTable, idx.IndexName, idx.ProjectionType)
+	}
+	return nil
 }
 
 // DbInfo holds different variables to be passed to db operation functions
 // Contains the Db Svc, map of tables, and FailConfig.
+// Svc accepts any dynamodbiface.DynamoDBAPI implementation, so a
+// *dynamodb.DynamoDB client, a wrapper or a test fake may be used.
 type DbInfo struct {
-	Svc        *dynamodb.DynamoDB
+	Svc        dynamodbiface.DynamoDBAPI
 	Tables     map[string]*Table
 	FailConfig *FailConfig
+	// Retry, if set, is returned by RetryPolicy in place of FailConfig.
+	Retry RetryPolicy
 }
 
 // SetSvc sets the Svc field of the DbInfo obj.
-func (d *DbInfo) SetSvc(svc *dynamodb.DynamoDB) {
+func (d *DbInfo) SetSvc(svc dynamodbiface.DynamoDBAPI) {
 	d.Svc = svc
 }
 
@@ -39,6 +245,25 @@ func (d *DbInfo) SetFailConfig(fc *FailConfig) {
 	d.FailConfig = fc
 }
 
+// SetRetryPolicy sets the Retry field of the DbInfo obj.
+func (d *DbInfo) SetRetryPolicy(p RetryPolicy) {
+	d.Retry = p
+}
+
+// RetryPolicy returns the RetryPolicy to pass to db operation functions:
+// Retry if set, else FailConfig if set, else nil, which selects DefaultRetryPolicy.
+//
+// ex: items, err := BatchGet(d.Svc, d.Tables["users"], d.RetryPolicy(), queries, refs)
+func (d *DbInfo) RetryPolicy() RetryPolicy {
+	if d.Retry != nil {
+		return d.Retry
+	}
+	if d.FailConfig != nil {
+		return d.FailConfig
+	}
+	return nil
+}
+
 // AddTable adds a new Table obj to the Tables field of the DbInfo obj.
 // TableName field is used for map key.
 func (d *DbInfo) AddTable(t *Table) {
@@ -77,27 +302,55 @@ func (q *Query) Reset() {
 	q.PrimaryValue, q.SortValue, q.UpdateValue, q.UpdateFieldName = nil, nil, nil, ""
 }
 
+// goTypes maps the Go type names accepted by NewTable to DynamoDB attribute types.
+var goTypes = map[string]string{
+	"[]byte":   "B",
+	"[][]byte": "BS",
+	"bool":     "BOOL",
+	"list":     "L",
+	"map":      "M",
+	"int":      "N",
+	"[]int":    "NS",
+	"null":     "NULL",
+	"string":   "S",
+	"[]string": "SS",
+}
+
+// NewTable returns a new Table after checking it with Validate.
+// The Table's key's Go types must be declared as strings, and only "string",
+// "int" and "[]byte" are valid key types.
+// Pass "" for sKeyName and sType to create a Table with a partition key only.
+// Returns an error matching ErrInvalidTable for an unknown type or an invalid Table.
+//
+// ex: t, err := NewTable("my_table", "Year", "int", "MovieName", "string")
+func NewTable(tableName, pKeyName, pType, sKeyName, sType string) (*Table, error) {
+	for _, typ := range []string{pType, sType} {
+		if _, ok := goTypes[typ]; !ok && typ != "" {
+			return nil, fmt.Errorf("%w: unknown key type %q", ErrInvalidTable, typ)
+		}
+	}
+	t := CreateNewTableObj(tableName, pKeyName, pType, sKeyName, sType)
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 // CreateNewTableObj creates a new Table struct.
 // The Table's key's Go types must be declared as strings.
+// Pass "" for sKeyName and sType to create a Table with a partition key only.
 // ex: t := CreateNewTableObj("my_table", "Year", "int", "MovieName", "string")
+//
+// Deprecated: Unknown types are mapped to "", which DynamoDB rejects only once the
+// Table is used. Use NewTable, which returns an error instead.
 func CreateNewTableObj(tableName, pKeyName, pType, sKeyName, sType string) *Table {
-	typeMap := map[string]string{
-		"[]byte":   "B",
-		"[][]byte": "BS",
-		"bool":     "BOOL",
-		"list":     "L",
-		"map":      "M",
-		"int":      "N",
-		"[]int":    "NS",
-		"null":     "NULL",
-		"string":   "S",
-		"[]string": "SS",
-	}
-
-	pt := typeMap[pType]
-	st := typeMap[sType]
-
-	return &Table{tableName, pKeyName, pt, sKeyName, st}
+	return &Table{
+		TableName:      tableName,
+		PrimaryKeyName: pKeyName,
+		PrimaryKeyType: goTypes[pType],
+		SortKeyName:    sKeyName,
+		SortKeyType:    goTypes[sType],
+	}
 }
 
 // CreateNewQueryObj creates a new Query struct.
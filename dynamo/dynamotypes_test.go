@@ -0,0 +1,138 @@
+package dynamo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewTable(t *testing.T) {
+	tests := []struct {
+		pType, sKey, sType string
+		wantP, wantS       string
+		wantErr            bool
+	}{
+		{pType: "string", wantP: "S"},
+		{pType: "int", sKey: "Sort", sType: "[]byte", wantP: "N", wantS: "B"},
+		{pType: "float", wantErr: true},
+		{pType: "string", sKey: "Sort", sType: "String", wantErr: true},
+		{pType: "bool", wantErr: true}, // not a key type
+		{pType: "", wantErr: true},
+		{pType: "string", sKey: "Sort", wantErr: true},
+	}
+	for _, tt := range tests {
+		tb, err := NewTable("things", "ID", tt.pType, tt.sKey, tt.sType)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidTable) {
+				t.Errorf("%q/%q: got %v, want ErrInvalidTable", tt.pType, tt.sType, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tb.PrimaryKeyType != tt.wantP || tb.SortKeyType != tt.wantS {
+			t.Errorf("%q/%q: got key types %q/%q, want %q/%q", tt.pType, tt.sType, tb.PrimaryKeyType, tb.SortKeyType, tt.wantP, tt.wantS)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	gsi := func() *Index {
+		return &Index{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S"}
+	}
+	lsi := func() *Index {
+		return &Index{IndexName: "ByDate", SortKeyName: "Date", SortKeyType: "S"}
+	}
+	tests := []struct {
+		name   string
+		change func(tb *Table)
+		err    string // substring of the error, or "" if tb is valid
+	}{
+		{"valid", func(tb *Table) {}, ""},
+		{"short name", func(tb *Table) { tb.TableName = "ab" }, "table name"},
+		{"name characters", func(tb *Table) { tb.TableName = "my table" }, "table name"},
+		{"no partition key", func(tb *Table) { tb.PrimaryKeyName = "" }, "partition key name is empty"},
+		{"bool partition key", func(tb *Table) { tb.PrimaryKeyType = "BOOL" }, `has type "BOOL"`},
+		{"no sort key", func(tb *Table) { tb.SortKeyName, tb.SortKeyType = "", "" }, ""},
+		{"sort key without type", func(tb *Table) { tb.SortKeyType = "" }, `sort key "Sort" has type ""`},
+		{"sort type without key", func(tb *Table) { tb.SortKeyName = "" }, "sort key name is empty"},
+		{"same keys", func(tb *Table) { tb.SortKeyName, tb.SortKeyType = "ID", "S" }, "both partition and sort key"},
+		{"version key", func(tb *Table) { tb.VersionAttributeName = "Sort" }, "cannot be the version attribute"},
+		{"provisioned", func(tb *Table) { tb.BillingMode, tb.ReadCapacityUnits, tb.WriteCapacityUnits = "PROVISIONED", 5, 5 }, ""},
+		{"provisioned without capacity", func(tb *Table) { tb.BillingMode, tb.ReadCapacityUnits = "PROVISIONED", 5 }, "at least 1 in PROVISIONED"},
+		{"on-demand with capacity", func(tb *Table) { tb.ReadCapacityUnits = 5 }, "cannot be set in PAY_PER_REQUEST"},
+		{"billing mode", func(tb *Table) { tb.BillingMode = "FREE" }, "invalid billing mode"},
+		{"table class", func(tb *Table) { tb.TableClass = "GLACIER" }, "invalid table class"},
+		{"stream view", func(tb *Table) { tb.StreamViewType = "ALL" }, "invalid stream view type"},
+		{"empty tag key", func(tb *Table) { tb.Tags = map[string]string{"": "x"} }, "tag keys cannot be empty"},
+		{"indexes", func(tb *Table) { tb.GlobalIndexes, tb.LocalIndexes = []*Index{gsi()}, []*Index{lsi()} }, ""},
+		{"index name", func(tb *Table) {
+			tb.GlobalIndexes = []*Index{{IndexName: "x", PrimaryKeyName: "Title", PrimaryKeyType: "S"}}
+		}, "index name"},
+		{"duplicate index", func(tb *Table) {
+			l := lsi()
+			l.IndexName = "ByTitle"
+			tb.GlobalIndexes, tb.LocalIndexes = []*Index{gsi()}, []*Index{l}
+		}, "duplicate index name ByTitle"},
+		{"include without attributes", func(tb *Table) {
+			idx := gsi()
+			idx.ProjectionType = "INCLUDE"
+			tb.GlobalIndexes = []*Index{idx}
+		}, ""},
+		{"attributes without include", func(tb *Table) {
+			idx := gsi()
+			idx.NonKeyAttributes = []string{"Body"}
+			tb.GlobalIndexes = []*Index{idx}
+		}, "projection is not INCLUDE"},
+		{"projection type", func(tb *Table) {
+			idx := gsi()
+			idx.ProjectionType = "SOME"
+			tb.GlobalIndexes = []*Index{idx}
+		}, "invalid projection type"},
+		{"index without partition key", func(tb *Table) { tb.GlobalIndexes = []*Index{{IndexName: "ByTitle"}} }, "partition key of ByTitle name is empty"},
+		{"index key type conflict", func(tb *Table) {
+			idx := gsi()
+			idx.PrimaryKeyName, idx.PrimaryKeyType = "Sort", "S"
+			tb.GlobalIndexes = []*Index{idx}
+		}, `attribute "Sort" is used as a key with both types N and S`},
+		{"provisioned index without capacity", func(tb *Table) {
+			tb.BillingMode, tb.ReadCapacityUnits, tb.WriteCapacityUnits = "PROVISIONED", 5, 5
+			tb.GlobalIndexes = []*Index{gsi()}
+		}, "global index ByTitle must be at least 1"},
+		{"on-demand index with capacity", func(tb *Table) {
+			idx := gsi()
+			idx.WriteCapacityUnits = 1
+			tb.GlobalIndexes = []*Index{idx}
+		}, "global index ByTitle cannot be set"},
+		{"local index without table sort key", func(tb *Table) {
+			tb.SortKeyName, tb.SortKeyType = "", ""
+			tb.LocalIndexes = []*Index{lsi()}
+		}, "requires the table to have a sort key"},
+		{"local index partition key", func(tb *Table) {
+			idx := lsi()
+			idx.PrimaryKeyName = "Other"
+			tb.LocalIndexes = []*Index{idx}
+		}, `must use the table partition key "ID"`},
+		{"local index without sort key", func(tb *Table) { tb.LocalIndexes = []*Index{{IndexName: "ByDate"}} }, "sort key of ByDate name is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb, err := NewTable("things", "ID", "string", "Sort", "int")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(tb)
+			err = tb.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("got %v, want valid", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidTable) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want ErrInvalidTable containing %q", err, tt.err)
+			}
+		})
+	}
+}
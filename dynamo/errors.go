@@ -0,0 +1,177 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file defines the errors returned by operations in this package.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Sentinel errors for use with errors.Is.
+// Errors returned by this package wrap both the sentinel matching the failure
+// and the underlying awserr.Error, which remains reachable with errors.As.
+var (
+	// ErrNotFound is returned when the requested item does not exist.
+	ErrNotFound = errors.New("item not found")
+	// ErrTableNotFound is returned when the table does not exist (ResourceNotFoundException).
+	ErrTableNotFound = errors.New("table not found")
+	// ErrTableExists is returned by CreateTable when the table already exists.
+	// It also matches ErrResourceInUse.
+	ErrTableExists = errors.New("table already exists")
+	// ErrResourceInUse is returned when a table or index is being created, updated or
+	// deleted, or already exists (ResourceInUseException).
+	ErrResourceInUse = errors.New("resource in use")
+	// ErrConditionFailed is returned when a condition expression evaluates to false.
+	ErrConditionFailed = errors.New("conditional check failed")
+	// ErrVersionConflict is returned when an optimistic locking write finds that the
+	// stored item's version differs from the expected one. It also matches
+	// ErrConditionFailed. Callers should read the item again and retry.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrThrottled is returned when DynamoDB rejects a request for exceeding throughput or request limits.
+	ErrThrottled = errors.New("request throttled")
+	// ErrMaxRetries is returned when an operation gives up after exhausting its retries.
+	ErrMaxRetries = errors.New("max retries exceeded")
+	// ErrTooManyItems is returned when a batch exceeds the DynamoDB request size limit.
+	ErrTooManyItems = errors.New("too many items to process")
+	// ErrInvalidTable is returned when a Table definition cannot be created in DynamoDB.
+	ErrInvalidTable = errors.New("invalid table definition")
+	// ErrTransactionCanceled is returned when DynamoDB cancels a transaction, in which
+	// case none of its operations were applied. See TxError.
+	ErrTransactionCanceled = errors.New("transaction canceled")
+	// ErrTransactionConflict is returned when a transaction or write conflicts with
+	// another transaction in progress on the same item. It can be retried.
+	ErrTransactionConflict = errors.New("transaction conflict")
+	// ErrImmutableChange is returned by Reconcile when the desired Table differs from the
+	// existing table in a way DynamoDB cannot change in place, such as its key schema.
+	ErrImmutableChange = errors.New("change requires recreating the table")
+)
+
+// Error codes returned by DynamoDB for which the SDK defines no constant.
+const (
+	// errCodeThrottling is returned by the DynamoDB control plane.
+	errCodeThrottling = "ThrottlingException"
+	// errCodeServiceUnavailable is returned when DynamoDB is temporarily unavailable (HTTP 503).
+	errCodeServiceUnavailable = "ServiceUnavailable"
+)
+
+// Codes of the cancellation reasons of a TransactionCanceledException.
+const (
+	txReasonNone                   = "None"
+	txReasonConditionalCheckFailed = "ConditionalCheckFailed"
+	txReasonTransactionConflict    = "TransactionConflict"
+	txReasonThroughputExceeded     = "ProvisionedThroughputExceeded"
+	txReasonThrottling             = "ThrottlingError"
+)
+
+// OpError records a failed operation, the table it targeted and the error that caused it.
+type OpError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error and the sentinel error that classifies it, if any.
+func (e *OpError) Unwrap() []error {
+	return unwrap(e.Err)
+}
+
+// UnprocessedError is returned by batch operations that stopped before every
+// request was processed. Items holds the leftover write requests of a batch write
+// and Keys the leftover keys of a batch get, both keyed by table name.
+type UnprocessedError struct {
+	Op    string
+	Table string
+	Items map[string][]*dynamodb.WriteRequest
+	Keys  map[string]*dynamodb.KeysAndAttributes
+	Err   error
+}
+
+func (e *UnprocessedError) Error() string {
+	return fmt.Sprintf("%s failed: %d unprocessed: %v", e.Op, writeCount(e.Items)+keyCount(e.Keys), e.Err)
+}
+
+// Unwrap returns the underlying error and the sentinel error that classifies it, if any.
+func (e *UnprocessedError) Unwrap() []error {
+	return unwrap(e.Err)
+}
+
+func unwrap(err error) []error {
+	if kind := errKind(err); kind != nil {
+		return []error{kind, err}
+	}
+	return []error{err}
+}
+
+// errKind returns the sentinel error matching the AWS error code in err's chain, or nil.
+func errKind(err error) error {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return nil
+	}
+	switch aerr.Code() {
+	case dynamodb.ErrCodeConditionalCheckFailedException, txReasonConditionalCheckFailed:
+		return ErrConditionFailed
+	case dynamodb.ErrCodeTransactionCanceledException:
+		return ErrTransactionCanceled
+	case dynamodb.ErrCodeTransactionConflictException, txReasonTransactionConflict:
+		return ErrTransactionConflict
+	case dynamodb.ErrCodeResourceInUseException:
+		return ErrResourceInUse
+	case dynamodb.ErrCodeResourceNotFoundException:
+		return ErrTableNotFound
+	case dynamodb.ErrCodeProvisionedThroughputExceededException,
+		dynamodb.ErrCodeRequestLimitExceeded,
+		errCodeThrottling,
+		txReasonThroughputExceeded,
+		txReasonThrottling:
+		return ErrThrottled
+	}
+	return nil
+}
+
+// errCode returns the AWS error code in err's chain, or "" if there is none.
+func errCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
+
+// safeErr returns err, or if err is an SDK exception that carries item attributes,
+// such as the item returned by a failed condition check, an awserr.Error with only
+// its code and message. The exceptions print every field in their Error text, so
+// they must not reach error strings or logs as they are.
+func safeErr(err error) error {
+	switch err.(type) {
+	case *dynamodb.ConditionalCheckFailedException, *dynamodb.TransactionCanceledException:
+		aerr := err.(awserr.Error)
+		return awserr.New(aerr.Code(), aerr.Message(), nil)
+	}
+	return err
+}
+
+// opErr wraps err in an *OpError for op on table.
+func opErr(op, table string, err error) error {
+	return &OpError{Op: op, Table: table, Err: err}
+}
+
+// ctxOpErr returns ctx.Err() if ctx is done, so that cancellation is reported as
+// context.Canceled or context.DeadlineExceeded rather than an AWS RequestCanceled
+// error. Otherwise it returns opErr(op, table, err).
+func ctxOpErr(ctx context.Context, op, table string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return opErr(op, table, err)
+}
@@ -0,0 +1,212 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains operations for managing the secondary indexes of a table.
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// CreateGlobalIndex adds the global secondary index idx to the existing table t
+// and appends it to t.GlobalIndexes. Returns an error matching ErrInvalidTable if
+// t would fail Validate with idx added. DynamoDB backfills the index in the
+// background; it cannot be queried until its status is ACTIVE.
+func CreateGlobalIndex(svc dynamodbiface.DynamoDBAPI, t *Table, idx *Index) error {
+	return CreateGlobalIndexWithContext(context.Background(), svc, t, idx)
+}
+
+// CreateGlobalIndexWithContext is the same as CreateGlobalIndex with the addition of the
+// ability to pass a context.
+func CreateGlobalIndexWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, idx *Index) error {
+	next := *t
+	next.GlobalIndexes = append(t.GlobalIndexes[:len(t.GlobalIndexes):len(t.GlobalIndexes)], idx)
+	if err := next.Validate(); err != nil {
+		return opErr("UpdateTable", t.TableName, err)
+	}
+	input := createIndexInput(t.TableName, idx)
+	err := withRetry(ctx, DefaultRetryPolicy, "UpdateTable", t.TableName, func() error {
+		_, err := svc.UpdateTableWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("UpdateTable", t.TableName, err)
+		return ctxOpErr(ctx, "UpdateTable", t.TableName, err)
+	}
+	t.GlobalIndexes = append(t.GlobalIndexes, idx)
+
+	logger().Info("created global index", slog.String("op", "UpdateTable"), slog.String("table", t.TableName),
+		slog.String("index", idx.IndexName))
+	return nil
+}
+
+// DeleteGlobalIndex removes the named global secondary index from the existing
+// table t and from t.GlobalIndexes.
+func DeleteGlobalIndex(svc dynamodbiface.DynamoDBAPI, t *Table, indexName string) error {
+	return DeleteGlobalIndexWithContext(context.Background(), svc, t, indexName)
+}
+
+// DeleteGlobalIndexWithContext is the same as DeleteGlobalIndex with the addition of the
+// ability to pass a context.
+func DeleteGlobalIndexWithContext(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, indexName string) error {
+	input := deleteIndexInput(t.TableName, indexName)
+	err := withRetry(ctx, DefaultRetryPolicy, "UpdateTable", t.TableName, func() error {
+		_, err := svc.UpdateTableWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("UpdateTable", t.TableName, err)
+		return ctxOpErr(ctx, "UpdateTable", t.TableName, err)
+	}
+	for i, idx := range t.GlobalIndexes {
+		if idx.IndexName == indexName {
+			t.GlobalIndexes = append(t.GlobalIndexes[:i:i], t.GlobalIndexes[i+1:]...)
+			break
+		}
+	}
+
+	logger().Info("deleted global index", slog.String("op", "UpdateTable"), slog.String("table", t.TableName),
+		slog.String("index", indexName))
+	return nil
+}
+
+// createIndexInput returns the UpdateTableInput adding global index idx to the named table.
+func createIndexInput(tableName string, idx *Index) *dynamodb.UpdateTableInput {
+	defs := &attrDefs{}
+	defs.add(idx.PrimaryKeyName, idx.PrimaryKeyType)
+	defs.add(idx.SortKeyName, idx.SortKeyType)
+	return &dynamodb.UpdateTableInput{
+		AttributeDefinitions: defs.list,
+		GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+			{
+				Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+					IndexName:             aws.String(idx.IndexName),
+					KeySchema:             keySchema(idx.PrimaryKeyName, idx.SortKeyName),
+					Projection:            idx.projection(),
+					ProvisionedThroughput: throughput(idx.ReadCapacityUnits, idx.WriteCapacityUnits),
+				},
+			},
+		},
+		TableName: aws.String(tableName),
+	}
+}
+
+// deleteIndexInput returns the UpdateTableInput removing the named global index from the named table.
+func deleteIndexInput(tableName, indexName string) *dynamodb.UpdateTableInput {
+	return &dynamodb.UpdateTableInput{
+		GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+			{Delete: &dynamodb.DeleteGlobalSecondaryIndexAction{IndexName: aws.String(indexName)}},
+		},
+		TableName: aws.String(tableName),
+	}
+}
+
+// indexKeys returns the partition and sort key names of the named index of t.
+// A local index uses the table's partition key.
+// Returns an error if t has no index with that name.
+func (t *Table) indexKeys(name string) (pk, sk string, err error) {
+	for _, idx := range t.GlobalIndexes {
+		if idx.IndexName == name {
+			return idx.PrimaryKeyName, idx.SortKeyName, nil
+		}
+	}
+	for _, idx := range t.LocalIndexes {
+		if idx.IndexName == name {
+			return t.PrimaryKeyName, idx.SortKeyName, nil
+		}
+	}
+	return "", "", fmt.Errorf("table %s has no index %s", t.TableName, name)
+}
+
+// isGlobalIndex reports whether name is a global secondary index of t.
+func (t *Table) isGlobalIndex(name string) bool {
+	for _, idx := range t.GlobalIndexes {
+		if idx.IndexName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// projection returns the Projection of idx, which defaults to ALL.
+func (idx *Index) projection() *dynamodb.Projection {
+	p := &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)}
+	if idx.ProjectionType != "" {
+		p.ProjectionType = aws.String(idx.ProjectionType)
+	}
+	if len(idx.NonKeyAttributes) > 0 {
+		p.NonKeyAttributes = aws.StringSlice(idx.NonKeyAttributes)
+	}
+	return p
+}
+
+// globalIndexes returns the GlobalSecondaryIndexes of a CreateTableInput for t.
+func (t *Table) globalIndexes() []*dynamodb.GlobalSecondaryIndex {
+	var gsis []*dynamodb.GlobalSecondaryIndex
+	for _, idx := range t.GlobalIndexes {
+		gsis = append(gsis, &dynamodb.GlobalSecondaryIndex{
+			IndexName:             aws.String(idx.IndexName),
+			KeySchema:             keySchema(idx.PrimaryKeyName, idx.SortKeyName),
+			Projection:            idx.projection(),
+			ProvisionedThroughput: throughput(idx.ReadCapacityUnits, idx.WriteCapacityUnits),
+		})
+	}
+	return gsis
+}
+
+// localIndexes returns the LocalSecondaryIndexes of a CreateTableInput for t.
+func (t *Table) localIndexes() []*dynamodb.LocalSecondaryIndex {
+	var lsis []*dynamodb.LocalSecondaryIndex
+	for _, idx := range t.LocalIndexes {
+		lsis = append(lsis, &dynamodb.LocalSecondaryIndex{
+			IndexName:  aws.String(idx.IndexName),
+			KeySchema:  keySchema(t.PrimaryKeyName, idx.SortKeyName),
+			Projection: idx.projection(),
+		})
+	}
+	return lsis
+}
+
+// throughput returns the ProvisionedThroughput for the given capacity units,
+// or nil if both are 0, as required in PAY_PER_REQUEST billing mode.
+func throughput(rcu, wcu int64) *dynamodb.ProvisionedThroughput {
+	if rcu == 0 && wcu == 0 {
+		return nil
+	}
+	return &dynamodb.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(rcu), WriteCapacityUnits: aws.Int64(wcu)}
+}
+
+// keySchema returns a key schema with partition key pk and, if set, sort key sk.
+func keySchema(pk, sk string) []*dynamodb.KeySchemaElement {
+	ks := []*dynamodb.KeySchemaElement{
+		{AttributeName: aws.String(pk), KeyType: aws.String(dynamodb.KeyTypeHash)},
+	}
+	if sk != "" {
+		ks = append(ks, &dynamodb.KeySchemaElement{AttributeName: aws.String(sk), KeyType: aws.String(dynamodb.KeyTypeRange)})
+	}
+	return ks
+}
+
+// attrDefs accumulates AttributeDefinitions, defining each attribute once.
+type attrDefs struct {
+	list []*dynamodb.AttributeDefinition
+}
+
+// add defines the attribute name with type typ unless name is "" or already defined.
+func (d *attrDefs) add(name, typ string) {
+	if name == "" {
+		return
+	}
+	for _, def := range d.list {
+		if aws.StringValue(def.AttributeName) == name {
+			return
+		}
+	}
+	d.list = append(d.list, &dynamodb.AttributeDefinition{AttributeName: aws.String(name), AttributeType: aws.String(typ)})
+}
@@ -0,0 +1,73 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestGlobalIndex(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	for _, th := range []thing{{ID: "a", Sort: 1, Title: "x"}, {ID: "b", Sort: 1, Title: "x"}, {ID: "c", Sort: 1, Title: "y"}, {ID: "d", Sort: 1}} {
+		if err := CreateItem(f, th, tb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CreateGlobalIndex(f, tb, &Index{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "BOOL"}); !errors.Is(err, ErrInvalidTable) {
+		t.Errorf("bool key: got %v, want ErrInvalidTable", err)
+	}
+	if err := CreateGlobalIndex(f, tb, &Index{IndexName: "ByID", PrimaryKeyName: "ID", PrimaryKeyType: "N"}); !errors.Is(err, ErrInvalidTable) {
+		t.Errorf("conflicting key type: got %v, want ErrInvalidTable", err)
+	}
+	if n := f.Calls("UpdateTable"); n != 0 || len(tb.GlobalIndexes) != 0 {
+		t.Fatalf("got %d UpdateTable calls and indexes %v after invalid indexes, want none", n, tb.GlobalIndexes)
+	}
+
+	idx := &Index{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S", SortKeyName: "ID", SortKeyType: "S"}
+	if err := CreateGlobalIndex(f, tb, idx); err != nil {
+		t.Fatal(err)
+	}
+	if len(tb.GlobalIndexes) != 1 || tb.GlobalIndexes[0] != idx {
+		t.Errorf("got indexes %v, want ByTitle", tb.GlobalIndexes)
+	}
+	desc, err := DescribeTable(f, "things")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(desc.GlobalIndexes) != 1 || desc.GlobalIndexes[0].PrimaryKeyName != "Title" || desc.GlobalIndexes[0].SortKeyName != "ID" {
+		t.Errorf("described indexes %+v, want ByTitle on Title and ID", desc.GlobalIndexes)
+	}
+
+	// items written before the index was created are found, sorted by the index sort key
+	got, err := QueryItems[thing](ctx, f, tb, &QueryParams{IndexName: "ByTitle", PartitionValue: "x", Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != "b" || got[1].ID != "a" {
+		t.Errorf("got %+v, want b and a", got)
+	}
+	if _, err := QueryItems[thing](ctx, f, tb, &QueryParams{IndexName: "ByTitle", PartitionValue: "x", ConsistentRead: true}); err == nil {
+		t.Error("consistent read of a global index: got no error")
+	}
+
+	if err := DeleteGlobalIndex(f, tb, "ByTitle"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tb.GlobalIndexes) != 0 {
+		t.Errorf("got indexes %v after delete, want none", tb.GlobalIndexes)
+	}
+	if _, err := QueryItems[thing](ctx, f, tb, &QueryParams{IndexName: "ByTitle", PartitionValue: "x"}); err == nil {
+		t.Error("query of a deleted index: got no error")
+	}
+	tb.GlobalIndexes = []*Index{idx}
+	if _, err := QueryItems[thing](ctx, f, tb, &QueryParams{IndexName: "ByTitle", PartitionValue: "x"}); errCode(err) != "ValidationException" {
+		t.Errorf("query of an index the table lacks: got %v, want ValidationException", err)
+	}
+	if err := DeleteGlobalIndex(f, tb, "ByTitle"); errCode(err) != dynamodb.ErrCodeResourceNotFoundException {
+		t.Errorf("delete of a missing index: got %v, want ResourceNotFoundException", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the package logger used to report operations and errors.
+package dynamo
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// discard is the default logger; the package is silent unless SetLogger is called.
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var pkgLogger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the structured logger used by all operations in this package.
+// Records carry the fields "op", "table", and where applicable "code", "attempt"
+// and "unprocessed". Item contents are never logged.
+// Passing nil silences the package again.
+func SetLogger(l *slog.Logger) {
+	pkgLogger.Store(l)
+}
+
+// logger returns the current package logger.
+func logger() *slog.Logger {
+	if l := pkgLogger.Load(); l != nil {
+		return l
+	}
+	return discard
+}
+
+// logErr logs a failed operation at Error level with the AWS error code if err has one.
+func logErr(op, table string, err error, attrs ...slog.Attr) {
+	logFailure(slog.LevelError, op+" failed", op, table, err, attrs...)
+}
+
+// logRetry logs a request that will be retried at Warn level.
+func logRetry(op, table string, attempt int, err error, attrs ...slog.Attr) {
+	logFailure(slog.LevelWarn, "retrying "+op, op, table, err, append([]slog.Attr{slog.Int("attempt", attempt)}, attrs...)...)
+}
+
+// logCall logs a failed low-level API call at Debug level; the calling
+// operation logs the outcome once retries are exhausted.
+func logCall(api, table string, err error, attrs ...slog.Attr) {
+	logFailure(slog.LevelDebug, api+" call failed", api, table, err, attrs...)
+}
+
+func logFailure(level slog.Level, msg, op, table string, err error, attrs ...slog.Attr) {
+	l := logger()
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	attrs = append([]slog.Attr{slog.String("op", op), slog.String("table", table)}, attrs...)
+	if code := errCode(err); code != "" {
+		attrs = append(attrs, slog.String("code", code))
+	}
+	attrs = append(attrs, slog.Any("error", safeErr(err)))
+	l.LogAttrs(context.Background(), level, msg, attrs...)
+}
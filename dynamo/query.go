@@ -0,0 +1,212 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the Query operation and the objects used to build its key conditions.
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// SortCondition restricts the sort key values of the items returned by a query.
+// SortConditions are created with SortEqual, SortLessThan, SortLessThanEqual,
+// SortGreaterThan, SortGreaterThanEqual, SortBetween and SortBeginsWith.
+type SortCondition struct {
+	op     string
+	values []interface{}
+}
+
+// SortEqual matches items whose sort key is equal to v.
+func SortEqual(v interface{}) *SortCondition {
+	return &SortCondition{"=", []interface{}{v}}
+}
+
+// SortLessThan matches items whose sort key is less than v.
+func SortLessThan(v interface{}) *SortCondition {
+	return &SortCondition{"<", []interface{}{v}}
+}
+
+// SortLessThanEqual matches items whose sort key is less than or equal to v.
+func SortLessThanEqual(v interface{}) *SortCondition {
+	return &SortCondition{"<=", []interface{}{v}}
+}
+
+// SortGreaterThan matches items whose sort key is greater than v.
+func SortGreaterThan(v interface{}) *SortCondition {
+	return &SortCondition{">", []interface{}{v}}
+}
+
+// SortGreaterThanEqual matches items whose sort key is greater than or equal to v.
+func SortGreaterThanEqual(v interface{}) *SortCondition {
+	return &SortCondition{">=", []interface{}{v}}
+}
+
+// SortBetween matches items whose sort key is between lo and hi inclusive.
+func SortBetween(lo, hi interface{}) *SortCondition {
+	return &SortCondition{"BETWEEN", []interface{}{lo, hi}}
+}
+
+// SortBeginsWith matches items whose String sort key begins with prefix.
+func SortBeginsWith(prefix string) *SortCondition {
+	return &SortCondition{"begins_with", []interface{}{prefix}}
+}
+
+// keyCondition returns the condition on the sort key named name.
+func (c *SortCondition) keyCondition(name string) expression.KeyConditionBuilder {
+	k := expression.Key(name)
+	switch c.op {
+	case "<":
+		return k.LessThan(expression.Value(c.values[0]))
+	case "<=":
+		return k.LessThanEqual(expression.Value(c.values[0]))
+	case ">":
+		return k.GreaterThan(expression.Value(c.values[0]))
+	case ">=":
+		return k.GreaterThanEqual(expression.Value(c.values[0]))
+	case "BETWEEN":
+		return k.Between(expression.Value(c.values[0]), expression.Value(c.values[1]))
+	case "begins_with":
+		return k.BeginsWith(c.values[0].(string))
+	}
+	return k.Equal(expression.Value(c.values[0]))
+}
+
+// QueryParams holds the parameters of a query on a Table.
+// Only PartitionValue is required; by default every item in the partition is
+// returned in ascending sort key order.
+type QueryParams struct {
+	// PartitionValue is the value of the partition key of the items to return.
+	PartitionValue interface{}
+	// Sort optionally restricts the sort key values of the items to return.
+	Sort *SortCondition
+	// IndexName optionally names a secondary index of the Table to query, in which
+	// case PartitionValue and Sort apply to the index's keys.
+	IndexName string
+	// Filter optionally discards items after they are read. Filtered items still
+	// consume read capacity.
+	Filter *expression.ConditionBuilder
+	// Projection optionally names the attributes to return; by default all are returned.
+	Projection []string
+	// Descending returns items in descending sort key order.
+	Descending bool
+	// Limit is the maximum number of items to return, or 0 for no limit.
+	Limit int64
+	// ConsistentRead requests a strongly consistent read.
+	ConsistentRead bool
+	// Retry decides which failed requests are retried; if nil, DefaultRetryPolicy is used.
+	Retry RetryPolicy
+}
+
+// QueryItems returns the items of table t matching the query p, unmarshaled into T.
+// Pages are requested until the partition is exhausted or p.Limit items have been read.
+//
+// ex: movies, err := QueryItems[Movie](ctx, svc, t, &QueryParams{PartitionValue: 2015, Sort: SortBeginsWith("The")})
+func QueryItems[T any](ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, p *QueryParams) ([]T, error) {
+	input, err := queryInput(t, p)
+	if err != nil {
+		return nil, opErr("Query", t.TableName, err)
+	}
+
+	retry := retryPolicy(p.Retry)
+	items := []T{}
+	for {
+		if p.Limit > 0 {
+			input.Limit = aws.Int64(p.Limit - int64(len(items)))
+		}
+		var result *dynamodb.QueryOutput
+		err := withRetry(ctx, retry, "Query", t.TableName, func() (err error) {
+			result, err = svc.QueryWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			logErr("Query", t.TableName, err)
+			return nil, ctxOpErr(ctx, "Query", t.TableName, err)
+		}
+		page := []T{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			logErr("Query", t.TableName, err)
+			return nil, opErr("Query", t.TableName, fmt.Errorf("failed to unmarshal records: %w", err))
+		}
+		items = append(items, page...)
+
+		if len(result.LastEvaluatedKey) == 0 || (p.Limit > 0 && int64(len(items)) >= p.Limit) {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	logger().Debug("queried items", slog.String("op", "Query"), slog.String("table", t.TableName),
+		slog.Int("count", len(items)))
+	return items, nil
+}
+
+// queryInput builds the QueryInput for p on table t.
+func queryInput(t *Table, p *QueryParams) (*dynamodb.QueryInput, error) {
+	if p == nil || p.PartitionValue == nil {
+		return nil, fmt.Errorf("partition value is required")
+	}
+	pk, sk := t.PrimaryKeyName, t.SortKeyName
+	if p.IndexName != "" {
+		var err error
+		if pk, sk, err = t.indexKeys(p.IndexName); err != nil {
+			return nil, err
+		}
+		if p.ConsistentRead && t.isGlobalIndex(p.IndexName) {
+			return nil, fmt.Errorf("consistent reads are not supported on global index %s", p.IndexName)
+		}
+	}
+	if p.Sort != nil && sk == "" && p.IndexName != "" {
+		return nil, fmt.Errorf("index %s has no sort key", p.IndexName)
+	}
+	if p.Sort != nil && sk == "" {
+		return nil, fmt.Errorf("table %s has no sort key", t.TableName)
+	}
+
+	keyCond := expression.Key(pk).Equal(expression.Value(p.PartitionValue))
+	if p.Sort != nil {
+		keyCond = keyCond.And(p.Sort.keyCondition(sk))
+	}
+	b := expression.NewBuilder().WithKeyCondition(keyCond)
+	if p.Filter != nil {
+		b = b.WithFilter(*p.Filter)
+	}
+	if len(p.Projection) > 0 {
+		b = b.WithProjection(projection(p.Projection))
+	}
+	expr, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		ConsistentRead:            aws.Bool(p.ConsistentRead),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+		ScanIndexForward:          aws.Bool(!p.Descending),
+		TableName:                 aws.String(t.TableName),
+	}
+	if p.IndexName != "" {
+		input.IndexName = aws.String(p.IndexName)
+	}
+	return input, nil
+}
+
+// projection returns a ProjectionBuilder for the attribute names.
+func projection(names []string) expression.ProjectionBuilder {
+	var pb expression.ProjectionBuilder
+	for _, n := range names {
+		pb = pb.AddNames(expression.Name(n))
+	}
+	return pb
+}
@@ -0,0 +1,168 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+func TestQueryScanRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	noRetry := &Backoff{MaxAttempts: 1}
+	tests := []struct {
+		name    string
+		op      string
+		run     func(r *Repository[thing], tb *Table) error
+		retried bool
+	}{
+		{"QueryItems default", "Query", func(r *Repository[thing], tb *Table) error {
+			_, err := QueryItems[thing](ctx, r.svc, tb, &QueryParams{PartitionValue: "a"})
+			return err
+		}, true},
+		{"QueryItems policy", "Query", func(r *Repository[thing], tb *Table) error {
+			_, err := QueryItems[thing](ctx, r.svc, tb, &QueryParams{PartitionValue: "a", Retry: noRetry})
+			return err
+		}, false},
+		{"Repository.Query", "Query", func(r *Repository[thing], tb *Table) error {
+			_, err := r.Query(ctx, "a")
+			return err
+		}, false},
+		{"Repository.QueryWith", "Query", func(r *Repository[thing], tb *Table) error {
+			_, err := r.QueryWith(ctx, &QueryParams{PartitionValue: "a"})
+			return err
+		}, false},
+		{"ScanItems default", "Scan", func(r *Repository[thing], tb *Table) error {
+			for _, err := range ScanItems[thing](ctx, r.svc, tb, nil) {
+				return err
+			}
+			return nil
+		}, true},
+		{"ParallelScan policy", "Scan", func(r *Repository[thing], tb *Table) error {
+			return ParallelScan(ctx, r.svc, tb, &ScanParams{Retry: noRetry}, 1, func(thing) error { return nil })
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newTestTable(t)
+			if err := CreateItem(f, thing{ID: "a", Sort: 1}, tb); err != nil {
+				t.Fatal(err)
+			}
+			r, err := NewRepository[thing](f, tb, noRetry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRetry(t, f, tt.op, dynamodb.ErrCodeInternalServerError, tt.retried, func() error { return tt.run(r, tb) })
+		})
+	}
+}
+
+// newQueryTable returns a Fake holding the table "things" with items a/1 to
+// a/10, titled t01 to t10, and b/1, and the local index ByTitle on Title.
+func newQueryTable(t *testing.T) (*dynamotest.Fake, *Table) {
+	t.Helper()
+	f := dynamotest.New()
+	tb, err := NewTable("things", "ID", "string", "Sort", "int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.LocalIndexes = []*Index{{IndexName: "ByTitle", SortKeyName: "Title", SortKeyType: "S"}}
+	if err := CreateTable(f, tb); err != nil {
+		t.Fatal(err)
+	}
+	items := []interface{}{thing{ID: "b", Sort: 1, Title: "t01"}}
+	for i := 1; i <= 10; i++ {
+		items = append(items, thing{ID: "a", Sort: i, Title: fmt.Sprintf("t%02d", i)})
+	}
+	if _, err := BatchPut(context.Background(), f, tb, items, nil); err != nil {
+		t.Fatal(err)
+	}
+	return f, tb
+}
+
+func TestQueryItems(t *testing.T) {
+	title := expression.Name("Title")
+	only10 := title.Equal(expression.Value("t10"))
+	tests := []struct {
+		name     string
+		p        QueryParams // PartitionValue is "a"
+		pageSize int
+		want     []int // sort key values returned
+		calls    int
+	}{
+		{name: "partition", want: seq(1, 10), calls: 1},
+		{name: "pages", pageSize: 3, want: seq(1, 10), calls: 4},
+		{name: "limit", p: QueryParams{Limit: 4}, want: seq(1, 4), calls: 1},
+		{name: "limit across pages", p: QueryParams{Limit: 5}, pageSize: 3, want: seq(1, 5), calls: 2},
+		{name: "descending", p: QueryParams{Descending: true, Limit: 3}, want: []int{10, 9, 8}, calls: 1},
+		{name: "equal", p: QueryParams{Sort: SortEqual(3)}, want: []int{3}, calls: 1},
+		{name: "less than", p: QueryParams{Sort: SortLessThan(3)}, want: []int{1, 2}, calls: 1},
+		{name: "less than equal", p: QueryParams{Sort: SortLessThanEqual(3)}, want: []int{1, 2, 3}, calls: 1},
+		{name: "greater than", p: QueryParams{Sort: SortGreaterThan(8)}, want: []int{9, 10}, calls: 1},
+		{name: "greater than equal", p: QueryParams{Sort: SortGreaterThanEqual(8)}, want: []int{8, 9, 10}, calls: 1},
+		{name: "between", p: QueryParams{Sort: SortBetween(4, 6)}, want: []int{4, 5, 6}, calls: 1},
+		{name: "begins with", p: QueryParams{IndexName: "ByTitle", Sort: SortBeginsWith("t0")}, pageSize: 4, want: seq(1, 9), calls: 3},
+		{name: "filter", p: QueryParams{Filter: &only10}, want: []int{10}, calls: 1},
+		{name: "filter across pages", p: QueryParams{Filter: &only10}, pageSize: 3, want: []int{10}, calls: 4},
+		{name: "projection", p: QueryParams{Projection: []string{"ID", "Sort"}, Sort: SortLessThan(3)}, want: []int{1, 2}, calls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newQueryTable(t)
+			f.PageSize = tt.pageSize
+			p := tt.p
+			p.PartitionValue = "a"
+			got, err := QueryItems[thing](context.Background(), f, tb, &p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sorts []int
+			for _, th := range got {
+				sorts = append(sorts, th.Sort)
+				wantTitle := fmt.Sprintf("t%02d", th.Sort)
+				if p.Projection != nil {
+					wantTitle = ""
+				}
+				if th.ID != "a" || th.Title != wantTitle {
+					t.Errorf("got item %+v", th)
+				}
+			}
+			if !slices.Equal(sorts, tt.want) {
+				t.Errorf("got sort keys %v, want %v", sorts, tt.want)
+			}
+			if n := f.Calls("Query"); n != tt.calls {
+				t.Errorf("got %d Query calls, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestQueryParamsErrors(t *testing.T) {
+	_, tb := newQueryTable(t)
+	tb.GlobalIndexes = []*Index{{IndexName: "ByTitleOnly", PrimaryKeyName: "Title", PrimaryKeyType: "S"}}
+	for _, p := range []*QueryParams{
+		nil,
+		{},
+		{PartitionValue: "a", IndexName: "Missing"},
+		{PartitionValue: "a", IndexName: "ByTitleOnly", Sort: SortEqual(1)},
+		{PartitionValue: "a", IndexName: "ByTitleOnly", ConsistentRead: true},
+	} {
+		if _, err := queryInput(tb, p); err == nil {
+			t.Errorf("%+v: got no error", p)
+		}
+	}
+}
+
+// seq returns the ints from lo to hi inclusive.
+func seq(lo, hi int) []int {
+	var s []int
+	for i := lo; i <= hi; i++ {
+		s = append(s, i)
+	}
+	return s
+}
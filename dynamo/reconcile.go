@@ -0,0 +1,340 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the Reconcile operation for converging a table to its Table definition.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// ReconcileOptions holds the optional parameters of Reconcile.
+type ReconcileOptions struct {
+	// DryRun returns the planned changes without applying them.
+	DryRun bool
+	// PollInterval is the time between DescribeTable calls while waiting for the
+	// table to become ACTIVE after each change, or 0 for DefaultPollInterval.
+	PollInterval time.Duration
+}
+
+// Change is a single step of the plan made by Reconcile.
+type Change struct {
+	// Op is the DynamoDB operation that makes the change, e.g. "UpdateTable".
+	Op string
+	// Description describes the change, e.g. "create global index ByEmail".
+	Description string
+
+	apply func(ctx context.Context) error
+}
+
+func (c *Change) String() string {
+	return c.Op + ": " + c.Description
+}
+
+// Reconcile converges the table named desired.TableName to the desired definition.
+// It compares desired with the Table returned by DescribeTable and applies the
+// differences one change at a time, waiting for the table to become ACTIVE after
+// each one: global indexes that are missing or whose keys or projection differ are
+// created (after deleting the old index), extra global indexes are deleted, and the
+// billing mode, capacity, table class, deletion protection, stream, time to live and
+// point in time recovery settings are updated. If the table does not exist it is created.
+// Moving time to live to another attribute takes two runs: the first disables it,
+// and a later one enables it on the new attribute once DynamoDB allows it, which
+// may take up to an hour.
+// KMSKeyID and Tags are not reconciled.
+//
+// Reconcile returns the planned changes. With opts.DryRun set, nothing is applied.
+// On error, the changes before the failing one have been applied.
+// Returns an error matching ErrInvalidTable if desired fails Validate, or
+// ErrImmutableChange if the table's key schema or local indexes differ from desired,
+// which requires recreating the table; no change is applied in that case.
+func Reconcile(ctx context.Context, svc dynamodbiface.DynamoDBAPI, desired *Table, opts *ReconcileOptions) ([]*Change, error) {
+	if opts == nil {
+		opts = &ReconcileOptions{}
+	}
+	if err := desired.Validate(); err != nil {
+		return nil, opErr("Reconcile", desired.TableName, err)
+	}
+	// current is nil if the table does not exist
+	current, err := DescribeTableWithContext(ctx, svc, desired.TableName)
+	if err != nil && !errors.Is(err, ErrTableNotFound) {
+		return nil, err
+	}
+
+	p := &planner{svc: svc, name: desired.TableName, poll: opts.PollInterval}
+	if err := p.plan(current, desired); err != nil {
+		logErr("Reconcile", desired.TableName, err)
+		return nil, opErr("Reconcile", desired.TableName, err)
+	}
+	if opts.DryRun {
+		return p.changes, nil
+	}
+
+	for _, c := range p.changes {
+		logger().Info("applying change", slog.String("op", "Reconcile"), slog.String("table", desired.TableName),
+			slog.String("change", c.String()))
+		if err := c.apply(ctx); err != nil {
+			return p.changes, err
+		}
+	}
+	return p.changes, nil
+}
+
+// planner accumulates the changes that converge a table to its desired definition.
+type planner struct {
+	svc     dynamodbiface.DynamoDBAPI
+	name    string
+	poll    time.Duration
+	changes []*Change
+}
+
+// add appends a change made by apply.
+func (p *planner) add(op, desc string, apply func(ctx context.Context) error) {
+	p.changes = append(p.changes, &Change{Op: op, Description: desc, apply: apply})
+}
+
+// update appends a change made by an UpdateTable call with input, after which
+// the table is waited on until it is ACTIVE.
+func (p *planner) update(desc string, input *dynamodb.UpdateTableInput) {
+	input.TableName = aws.String(p.name)
+	p.add("UpdateTable", desc, func(ctx context.Context) error {
+		err := withRetry(ctx, DefaultRetryPolicy, "UpdateTable", p.name, func() error {
+			_, err := p.svc.UpdateTableWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			logErr("UpdateTable", p.name, err)
+			return ctxOpErr(ctx, "UpdateTable", p.name, err)
+		}
+		return WaitUntilActive(ctx, p.svc, &Table{TableName: p.name}, p.poll)
+	})
+}
+
+// plan records the changes from current, which is nil if the table does not exist, to desired.
+func (p *planner) plan(current, desired *Table) error {
+	if current == nil {
+		p.add("CreateTable", "create table "+desired.TableName, func(ctx context.Context) error {
+			return CreateTableAndWait(ctx, p.svc, desired, p.poll)
+		})
+		p.planTTL("", desired.TTLAttributeName)
+		p.planPITR(false, desired.PointInTimeRecovery)
+		return nil
+	}
+
+	if current.PrimaryKeyName != desired.PrimaryKeyName || current.PrimaryKeyType != desired.PrimaryKeyType {
+		return fmt.Errorf("%w: partition key %s (%s) cannot change to %s (%s)", ErrImmutableChange,
+			current.PrimaryKeyName, current.PrimaryKeyType, desired.PrimaryKeyName, desired.PrimaryKeyType)
+	}
+	if current.SortKeyName != desired.SortKeyName || current.SortKeyType != desired.SortKeyType {
+		return fmt.Errorf("%w: sort key %q (%s) cannot change to %q (%s)", ErrImmutableChange,
+			current.SortKeyName, current.SortKeyType, desired.SortKeyName, desired.SortKeyType)
+	}
+	if len(current.LocalIndexes) != len(desired.LocalIndexes) {
+		return fmt.Errorf("%w: local indexes cannot be added or removed", ErrImmutableChange)
+	}
+	for _, idx := range desired.LocalIndexes {
+		cur := findIndex(current.LocalIndexes, idx.IndexName)
+		if cur == nil || !sameIndexSchema(cur, idx, true) {
+			return fmt.Errorf("%w: local index %s cannot be added or changed", ErrImmutableChange, idx.IndexName)
+		}
+	}
+
+	// global indexes whose schema changed are deleted and created again
+	var create []*Index
+	for _, idx := range current.GlobalIndexes {
+		want := findIndex(desired.GlobalIndexes, idx.IndexName)
+		if want != nil && sameIndexSchema(idx, want, false) {
+			continue
+		}
+		desc := "delete global index " + idx.IndexName
+		if want != nil {
+			desc += " to recreate it with new keys or projection"
+		}
+		p.update(desc, deleteIndexInput(p.name, idx.IndexName))
+	}
+	for _, idx := range desired.GlobalIndexes {
+		cur := findIndex(current.GlobalIndexes, idx.IndexName)
+		if cur == nil || !sameIndexSchema(cur, idx, false) {
+			create = append(create, idx)
+		}
+	}
+
+	p.planCapacity(current, desired, create)
+	for _, idx := range create {
+		p.update("create global index "+idx.IndexName, createIndexInput(p.name, idx))
+	}
+
+	if tableClass(current) != tableClass(desired) {
+		p.update(fmt.Sprintf("change table class from %s to %s", tableClass(current), tableClass(desired)),
+			&dynamodb.UpdateTableInput{TableClass: aws.String(tableClass(desired))})
+	}
+	if current.DeletionProtection != desired.DeletionProtection {
+		p.update(fmt.Sprintf("set deletion protection to %t", desired.DeletionProtection),
+			&dynamodb.UpdateTableInput{DeletionProtectionEnabled: aws.Bool(desired.DeletionProtection)})
+	}
+	if current.StreamViewType != desired.StreamViewType {
+		if current.StreamViewType != "" {
+			p.update("disable "+current.StreamViewType+" stream", &dynamodb.UpdateTableInput{
+				StreamSpecification: &dynamodb.StreamSpecification{StreamEnabled: aws.Bool(false)},
+			})
+		}
+		if desired.StreamViewType != "" {
+			p.update("enable "+desired.StreamViewType+" stream", &dynamodb.UpdateTableInput{
+				StreamSpecification: &dynamodb.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: aws.String(desired.StreamViewType),
+				},
+			})
+		}
+	}
+	p.planTTL(current.TTLAttributeName, desired.TTLAttributeName)
+	p.planPITR(current.PointInTimeRecovery, desired.PointInTimeRecovery)
+	return nil
+}
+
+// planCapacity records the change of billing mode and provisioned capacity of the
+// table and of the global indexes that are kept, which excludes those in create.
+func (p *planner) planCapacity(current, desired *Table, create []*Index) {
+	input := &dynamodb.UpdateTableInput{}
+	var desc []string
+	mode := desired.billingMode()
+	if current.billingMode() != mode {
+		input.BillingMode = aws.String(mode)
+		desc = append(desc, "switch to "+mode)
+	}
+	if mode == dynamodb.BillingModeProvisioned {
+		if input.BillingMode != nil || current.ReadCapacityUnits != desired.ReadCapacityUnits || current.WriteCapacityUnits != desired.WriteCapacityUnits {
+			input.ProvisionedThroughput = throughput(desired.ReadCapacityUnits, desired.WriteCapacityUnits)
+			desc = append(desc, fmt.Sprintf("set table capacity to %d/%d", desired.ReadCapacityUnits, desired.WriteCapacityUnits))
+		}
+		for _, idx := range desired.GlobalIndexes {
+			cur := findIndex(current.GlobalIndexes, idx.IndexName)
+			if cur == nil || slices.Contains(create, idx) {
+				continue
+			}
+			if input.BillingMode == nil && cur.ReadCapacityUnits == idx.ReadCapacityUnits && cur.WriteCapacityUnits == idx.WriteCapacityUnits {
+				continue
+			}
+			input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, &dynamodb.GlobalSecondaryIndexUpdate{
+				Update: &dynamodb.UpdateGlobalSecondaryIndexAction{
+					IndexName:             aws.String(idx.IndexName),
+					ProvisionedThroughput: throughput(idx.ReadCapacityUnits, idx.WriteCapacityUnits),
+				},
+			})
+			desc = append(desc, fmt.Sprintf("set capacity of %s to %d/%d", idx.IndexName, idx.ReadCapacityUnits, idx.WriteCapacityUnits))
+		}
+	}
+	if len(desc) == 0 {
+		return
+	}
+	p.update(strings.Join(desc, ", "), input)
+}
+
+// planTTL records the change of time to live attribute from current to desired.
+// DynamoDB only changes the attribute by disabling time to live and enabling it
+// again, and rejects the second update for up to an hour after the first, so a
+// change of attribute only disables time to live; Reconcile enables it on the
+// new attribute when run again once DynamoDB allows it.
+func (p *planner) planTTL(current, desired string) {
+	if current == desired {
+		return
+	}
+	ttl := func(name string, enabled bool) func(ctx context.Context) error {
+		input := &dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(p.name),
+			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String(name),
+				Enabled:       aws.Bool(enabled),
+			},
+		}
+		return func(ctx context.Context) error {
+			err := withRetry(ctx, DefaultRetryPolicy, "UpdateTimeToLive", p.name, func() error {
+				_, err := p.svc.UpdateTimeToLiveWithContext(ctx, input)
+				return err
+			})
+			if err != nil {
+				logErr("UpdateTimeToLive", p.name, err)
+				return ctxOpErr(ctx, "UpdateTimeToLive", p.name, err)
+			}
+			return nil
+		}
+	}
+	if current != "" {
+		desc := "disable time to live on " + current
+		if desired != "" {
+			desc += "; run Reconcile again later to enable it on " + desired
+		}
+		p.add("UpdateTimeToLive", desc, ttl(current, false))
+		return
+	}
+	if desired != "" {
+		p.add("UpdateTimeToLive", "enable time to live on "+desired, ttl(desired, true))
+	}
+}
+
+// planPITR records the change of point in time recovery from current to desired.
+func (p *planner) planPITR(current, desired bool) {
+	if current == desired {
+		return
+	}
+	input := &dynamodb.UpdateContinuousBackupsInput{
+		PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(desired),
+		},
+		TableName: aws.String(p.name),
+	}
+	p.add("UpdateContinuousBackups", fmt.Sprintf("set point in time recovery to %t", desired), func(ctx context.Context) error {
+		err := withRetry(ctx, DefaultRetryPolicy, "UpdateContinuousBackups", p.name, func() error {
+			_, err := p.svc.UpdateContinuousBackupsWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			logErr("UpdateContinuousBackups", p.name, err)
+			return ctxOpErr(ctx, "UpdateContinuousBackups", p.name, err)
+		}
+		return nil
+	})
+}
+
+// findIndex returns the index named name in indexes, or nil.
+func findIndex(indexes []*Index, name string) *Index {
+	for _, idx := range indexes {
+		if idx.IndexName == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// sameIndexSchema reports whether a and b have the same keys and projection.
+// The partition key of local indexes, which is always the table's, is not compared.
+func sameIndexSchema(a, b *Index, local bool) bool {
+	if !local && (a.PrimaryKeyName != b.PrimaryKeyName || a.PrimaryKeyType != b.PrimaryKeyType) {
+		return false
+	}
+	pa, pb := a.projection(), b.projection()
+	na, nb := aws.StringValueSlice(pa.NonKeyAttributes), aws.StringValueSlice(pb.NonKeyAttributes)
+	slices.Sort(na)
+	slices.Sort(nb)
+	return a.SortKeyName == b.SortKeyName && a.SortKeyType == b.SortKeyType &&
+		aws.StringValue(pa.ProjectionType) == aws.StringValue(pb.ProjectionType) &&
+		slices.Equal(na, nb)
+}
+
+// tableClass returns the TableClass of t, which defaults to STANDARD.
+func tableClass(t *Table) string {
+	if t.TableClass == "" {
+		return dynamodb.TableClassStandard
+	}
+	return t.TableClass
+}
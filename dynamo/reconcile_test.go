@@ -0,0 +1,262 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+func TestReconcileTTL(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	opts := &ReconcileOptions{PollInterval: time.Millisecond}
+	tests := []struct {
+		ttl     string
+		changes int
+		want    string // time to live attribute after reconciling
+	}{
+		{"Expires", 1, "Expires"},
+		{"Expires", 0, "Expires"},
+		{"ExpiresAt", 1, ""}, // disabled only
+		{"ExpiresAt", 1, "ExpiresAt"},
+		{"", 1, ""},
+	}
+	for _, tt := range tests {
+		desired := *tb
+		desired.TTLAttributeName = tt.ttl
+		changes, err := Reconcile(ctx, f, &desired, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != tt.changes {
+			t.Errorf("TTL %q: got changes %v, want %d", tt.ttl, changes, tt.changes)
+		}
+		cur, err := DescribeTableWithContext(ctx, f, tb.TableName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cur.TTLAttributeName != tt.want {
+			t.Errorf("TTL %q: got %q after reconciling, want %q", tt.ttl, cur.TTLAttributeName, tt.want)
+		}
+	}
+}
+
+// reconcileBase returns the Table "things" with the global index ByTitle, on
+// demand billing and no optional settings.
+func reconcileBase() *Table {
+	return &Table{
+		TableName: "things", PrimaryKeyName: "ID", PrimaryKeyType: "S", SortKeyName: "Sort", SortKeyType: "N",
+		GlobalIndexes: []*Index{{IndexName: "ByTitle", PrimaryKeyName: "Title", PrimaryKeyType: "S"}},
+	}
+}
+
+// provisioned sets t to PROVISIONED billing with the given capacity for the table and each global index.
+func provisioned(t *Table, table, index int64) {
+	t.BillingMode = dynamodb.BillingModeProvisioned
+	t.ReadCapacityUnits, t.WriteCapacityUnits = table, table
+	for _, idx := range t.GlobalIndexes {
+		idx.ReadCapacityUnits, idx.WriteCapacityUnits = index, index
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    func(t *Table) // changes the existing table; nil if there is none
+		desired func(t *Table) // changes the desired table
+		changes []string
+	}{
+		{
+			name:    "create",
+			desired: func(t *Table) { t.TTLAttributeName, t.PointInTimeRecovery = "Expires", true },
+			changes: []string{
+				"CreateTable: create table things",
+				"UpdateTimeToLive: enable time to live on Expires",
+				"UpdateContinuousBackups: set point in time recovery to true",
+			},
+		},
+		{
+			name:    "unchanged",
+			base:    func(*Table) {},
+			desired: func(*Table) {},
+		},
+		{
+			name: "add global index",
+			base: func(*Table) {},
+			desired: func(t *Table) {
+				t.GlobalIndexes = append(t.GlobalIndexes, &Index{IndexName: "ByOwner", PrimaryKeyName: "Owner", PrimaryKeyType: "S", SortKeyName: "Sort", SortKeyType: "N"})
+			},
+			changes: []string{"UpdateTable: create global index ByOwner"},
+		},
+		{
+			name:    "delete global index",
+			base:    func(*Table) {},
+			desired: func(t *Table) { t.GlobalIndexes = nil },
+			changes: []string{"UpdateTable: delete global index ByTitle"},
+		},
+		{
+			name:    "recreate global index",
+			base:    func(*Table) {},
+			desired: func(t *Table) { t.GlobalIndexes[0].ProjectionType = dynamodb.ProjectionTypeKeysOnly },
+			changes: []string{
+				"UpdateTable: delete global index ByTitle to recreate it with new keys or projection",
+				"UpdateTable: create global index ByTitle",
+			},
+		},
+		{
+			name:    "switch to provisioned",
+			base:    func(*Table) {},
+			desired: func(t *Table) { provisioned(t, 5, 1) },
+			changes: []string{"UpdateTable: switch to PROVISIONED, set table capacity to 5/5, set capacity of ByTitle to 1/1"},
+		},
+		{
+			name:    "change capacity",
+			base:    func(t *Table) { provisioned(t, 5, 5) },
+			desired: func(t *Table) { provisioned(t, 10, 5); t.GlobalIndexes[0].WriteCapacityUnits = 2 },
+			changes: []string{"UpdateTable: set table capacity to 10/10, set capacity of ByTitle to 5/2"},
+		},
+		{
+			name:    "switch to on demand",
+			base:    func(t *Table) { provisioned(t, 5, 5) },
+			desired: func(*Table) {},
+			changes: []string{"UpdateTable: switch to PAY_PER_REQUEST"},
+		},
+		{
+			name: "table settings",
+			base: func(*Table) {},
+			desired: func(t *Table) {
+				t.TableClass = dynamodb.TableClassStandardInfrequentAccess
+				t.DeletionProtection = true
+				t.StreamViewType = dynamodb.StreamViewTypeNewImage
+				t.PointInTimeRecovery = true
+			},
+			changes: []string{
+				"UpdateTable: change table class from STANDARD to STANDARD_INFREQUENT_ACCESS",
+				"UpdateTable: set deletion protection to true",
+				"UpdateTable: enable NEW_IMAGE stream",
+				"UpdateContinuousBackups: set point in time recovery to true",
+			},
+		},
+		{
+			name:    "change stream",
+			base:    func(t *Table) { t.StreamViewType = dynamodb.StreamViewTypeNewImage },
+			desired: func(t *Table) { t.StreamViewType = dynamodb.StreamViewTypeKeysOnly },
+			changes: []string{"UpdateTable: disable NEW_IMAGE stream", "UpdateTable: enable KEYS_ONLY stream"},
+		},
+		{
+			name: "disable settings",
+			base: func(t *Table) {
+				t.DeletionProtection, t.StreamViewType, t.PointInTimeRecovery = true, dynamodb.StreamViewTypeKeysOnly, true
+			},
+			desired: func(*Table) {},
+			changes: []string{
+				"UpdateTable: set deletion protection to false",
+				"UpdateTable: disable KEYS_ONLY stream",
+				"UpdateContinuousBackups: set point in time recovery to false",
+			},
+		},
+	}
+	ctx := context.Background()
+	opts := &ReconcileOptions{PollInterval: time.Millisecond}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := dynamotest.New()
+			if tt.base != nil {
+				base := reconcileBase()
+				tt.base(base)
+				if _, err := Reconcile(ctx, f, base, opts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			desired := reconcileBase()
+			tt.desired(desired)
+
+			changes, err := Reconcile(ctx, f, desired, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.String())
+			}
+			if !slices.Equal(got, tt.changes) {
+				t.Errorf("got changes\n%q\nwant\n%q", got, tt.changes)
+			}
+			// the table now matches desired
+			if changes, err := Reconcile(ctx, f, desired, &ReconcileOptions{DryRun: true}); err != nil || len(changes) != 0 {
+				t.Errorf("after reconciling: got changes %v (%v), want none", changes, err)
+			}
+		})
+	}
+}
+
+func TestReconcileImmutable(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired func(t *Table)
+	}{
+		{"partition key name", func(t *Table) { t.PrimaryKeyName = "Key" }},
+		{"partition key type", func(t *Table) { t.PrimaryKeyType = "N" }},
+		{"sort key", func(t *Table) { t.SortKeyName, t.SortKeyType = "", "" }},
+		{"add local index", func(t *Table) {
+			t.LocalIndexes = []*Index{{IndexName: "ByDate", SortKeyName: "Date", SortKeyType: "S"}}
+		}},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := dynamotest.New()
+			if _, err := Reconcile(ctx, f, reconcileBase(), nil); err != nil {
+				t.Fatal(err)
+			}
+			desired := reconcileBase()
+			desired.GlobalIndexes = nil // would otherwise be deleted
+			tt.desired(desired)
+
+			changes, err := Reconcile(ctx, f, desired, nil)
+			if !errors.Is(err, ErrImmutableChange) || changes != nil {
+				t.Fatalf("got %v, %v, want ErrImmutableChange", changes, err)
+			}
+			if n := f.Calls("UpdateTable"); n != 0 {
+				t.Errorf("got %d UpdateTable calls, want 0", n)
+			}
+		})
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	ctx := context.Background()
+	f := dynamotest.New()
+	base := reconcileBase()
+	if _, err := Reconcile(ctx, f, base, nil); err != nil {
+		t.Fatal(err)
+	}
+	desired := reconcileBase()
+	desired.GlobalIndexes[0].ProjectionType = dynamodb.ProjectionTypeKeysOnly
+	desired.TTLAttributeName = "Expires"
+	desired.PointInTimeRecovery = true
+
+	for i := 0; i < 2; i++ {
+		changes, err := Reconcile(ctx, f, desired, &ReconcileOptions{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 4 {
+			t.Errorf("got changes %v, want 4", changes)
+		}
+	}
+	for _, op := range []string{"UpdateTable", "UpdateTimeToLive", "UpdateContinuousBackups"} {
+		if n := f.Calls(op); n != 0 {
+			t.Errorf("got %d %s calls, want 0", n, op)
+		}
+	}
+	if changes, err := Reconcile(ctx, f, base, &ReconcileOptions{DryRun: true}); err != nil || len(changes) != 0 {
+		t.Errorf("got changes %v (%v) from the unchanged table, want none", changes, err)
+	}
+}
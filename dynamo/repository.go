@@ -0,0 +1,328 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file defines the generic Repository type for typed access to a Table's items.
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Repository provides typed access to the items of a single Table.
+// T must be a struct type with fields for the Table's partition key and, if the
+// Table has one, its sort key. Fields are matched to key names by the attribute
+// name they marshal to: the dynamodbav tag name, else the json tag name, else
+// the field name.
+// A Repository is safe for concurrent use.
+type Repository[T any] struct {
+	svc   dynamodbiface.DynamoDBAPI
+	table *Table
+	retry RetryPolicy
+}
+
+// NewRepository creates a Repository for items of type T stored in table t.
+// retry decides how failed requests are retried; if nil, DefaultRetryPolicy is used.
+// Returns an error if T is not a struct or has no field for one of the Table's keys.
+func NewRepository[T any](svc dynamodbiface.DynamoDBAPI, t *Table, retry RetryPolicy) (*Repository[T], error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("NewRepository failed: %s is not a struct type", typ)
+	}
+	fields := attrFields(typ)
+	for _, k := range []string{t.PrimaryKeyName, t.SortKeyName} {
+		if k == "" {
+			continue
+		}
+		if _, ok := fields[k]; !ok {
+			return nil, fmt.Errorf("NewRepository failed: %s has no field for key attribute %q", typ, k)
+		}
+	}
+	return &Repository[T]{svc: svc, table: t, retry: retryPolicy(retry)}, nil
+}
+
+// Table returns the Table the Repository reads from and writes to.
+func (r *Repository[T]) Table() *Table { return r.table }
+
+// Get returns the item with partition key value pv and sort key value sv.
+// sv is ignored if the Table has no sort key.
+// Returns an error matching ErrNotFound if the item does not exist.
+func (r *Repository[T]) Get(ctx context.Context, pv, sv interface{}) (T, error) {
+	var item T
+	key, err := r.keyFromValues(pv, sv)
+	if err != nil {
+		return item, opErr("GetItem", r.table.TableName, err)
+	}
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(r.table.TableName),
+		Key:       key,
+	}
+	var result *dynamodb.GetItemOutput
+	err = withRetry(ctx, r.retry, "GetItem", r.table.TableName, func() (err error) {
+		result, err = r.svc.GetItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("GetItem", r.table.TableName, err)
+		return item, ctxOpErr(ctx, "GetItem", r.table.TableName, err)
+	}
+	if result.Item == nil {
+		return item, opErr("GetItem", r.table.TableName, ErrNotFound)
+	}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		logErr("GetItem", r.table.TableName, err)
+		return item, opErr("GetItem", r.table.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
+	}
+	return item, nil
+}
+
+// Put creates or replaces *item.
+// If the Table has a VersionAttributeName, *item replaces the stored item only if
+// their versions are equal, and is stored with its version incremented, which is
+// also set in item's version field. Returns an error matching ErrVersionConflict otherwise.
+func (r *Repository[T]) Put(ctx context.Context, item *T) error {
+	if item == nil {
+		return opErr("CreateItem", r.table.TableName, fmt.Errorf("nil item"))
+	}
+	return putItem(ctx, r.svc, r.retry, item, r.table, nil)
+}
+
+// Delete deletes the item with the same primary key as item.
+// Only the key fields of item need to be set.
+func (r *Repository[T]) Delete(ctx context.Context, item T) error {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return opErr("DeleteItem", r.table.TableName, err)
+	}
+	key, err := itemKey(r.table, av)
+	if err != nil {
+		return opErr("DeleteItem", r.table.TableName, err)
+	}
+	input := &dynamodb.DeleteItemInput{
+		Key:       key,
+		TableName: aws.String(r.table.TableName),
+	}
+	err = withRetry(ctx, r.retry, "DeleteItem", r.table.TableName, func() error {
+		_, err := r.svc.DeleteItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("DeleteItem", r.table.TableName, err)
+		return ctxOpErr(ctx, "DeleteItem", r.table.TableName, err)
+	}
+	logger().Debug("deleted item", slog.String("op", "DeleteItem"), slog.String("table", r.table.TableName))
+	return nil
+}
+
+// Update sets the named attributes of the stored item to their values in item,
+// which is located by its primary key. Attributes that marshal to nothing,
+// such as empty omitempty fields, are removed. If no attribute names are given,
+// every non-key attribute of item is set.
+// If the Table has a VersionAttributeName, the update is applied only if the
+// stored version equals item's, and increments it. Returns an error matching
+// ErrVersionConflict otherwise.
+func (r *Repository[T]) Update(ctx context.Context, item T, attrs ...string) error {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return opErr("UpdateItem", r.table.TableName, err)
+	}
+	key, err := itemKey(r.table, av)
+	if err != nil {
+		return opErr("UpdateItem", r.table.TableName, err)
+	}
+	if len(attrs) == 0 {
+		for _, name := range sortedKeys(av) {
+			if name != r.table.PrimaryKeyName && name != r.table.SortKeyName {
+				attrs = append(attrs, name)
+			}
+		}
+	}
+	if len(attrs) == 0 {
+		return opErr("UpdateItem", r.table.TableName, fmt.Errorf("no attributes to update"))
+	}
+
+	u := NewUpdate()
+	for _, name := range attrs {
+		if name == r.table.PrimaryKeyName || name == r.table.SortKeyName {
+			return opErr("UpdateItem", r.table.TableName, fmt.Errorf("cannot update key attribute %q", name))
+		}
+		if name == r.table.VersionAttributeName {
+			continue // incremented by updateInput
+		}
+		if v, ok := av[name]; ok {
+			u.Set(name, v)
+		} else {
+			u.Remove(name)
+		}
+	}
+	var version int64
+	if r.table.VersionAttributeName != "" {
+		if version, err = itemVersion(r.table, av); err != nil {
+			return opErr("UpdateItem", r.table.TableName, err)
+		}
+		u.IfVersion(version)
+	}
+	input, err := updateInput(r.table, key, u)
+	if err != nil {
+		return opErr("UpdateItem", r.table.TableName, err)
+	}
+
+	err = withRetry(ctx, updateRetryPolicy(r.retry, r.table, u), "UpdateItem", r.table.TableName, func() error {
+		_, err := r.svc.UpdateItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("UpdateItem", r.table.TableName, err)
+		err = writeErr(ctx, "UpdateItem", r.table.TableName, err)
+		if r.table.VersionAttributeName != "" {
+			return versionErr(r.table, err, version)
+		}
+		return err
+	}
+	logger().Debug("updated item", slog.String("op", "UpdateItem"), slog.String("table", r.table.TableName),
+		slog.String("field", strings.Join(attrs, ",")))
+	return nil
+}
+
+// BatchGet returns the items with the same primary keys as keys, in the order
+// of keys. Only the key fields of each element of keys need to be set.
+// Items that do not exist are omitted and repeated keys are fetched once.
+// Any number of keys may be given; they are requested 100 at a time.
+func (r *Repository[T]) BatchGet(ctx context.Context, keys []T) ([]T, error) {
+	order := []string{}
+	unique := []map[string]*dynamodb.AttributeValue{}
+	seen := map[string]bool{}
+	for _, k := range keys {
+		av, err := dynamodbattribute.MarshalMap(k)
+		if err != nil {
+			return nil, opErr("BatchGet", r.table.TableName, err)
+		}
+		key, err := itemKey(r.table, av)
+		if err != nil {
+			return nil, opErr("BatchGet", r.table.TableName, err)
+		}
+		ks := keyString(r.table, key)
+		order = append(order, ks)
+		if !seen[ks] {
+			seen[ks] = true
+			unique = append(unique, key)
+		}
+	}
+
+	found := map[string]map[string]*dynamodb.AttributeValue{}
+	for start := 0; start < len(unique); start += maxBatchGetKeys {
+		end := start + maxBatchGetKeys
+		if end > len(unique) {
+			end = len(unique)
+		}
+		avs, err := batchGetAll(ctx, r.svc, r.retry, "BatchGet", r.table, unique[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, av := range avs {
+			found[keyString(r.table, av)] = av
+		}
+	}
+
+	items := []T{}
+	for _, ks := range order {
+		av, ok := found[ks]
+		if !ok {
+			continue
+		}
+		var item T
+		if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+			logErr("BatchGet", r.table.TableName, err)
+			return nil, opErr("BatchGet", r.table.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Query returns every item with partition key value pv, ordered by sort key.
+// Use QueryWith to restrict the sort key, filter or project the results.
+func (r *Repository[T]) Query(ctx context.Context, pv interface{}) ([]T, error) {
+	return QueryItems[T](ctx, r.svc, r.table, &QueryParams{PartitionValue: pv, Retry: r.retry})
+}
+
+// QueryWith returns the items matching the query p. Failed requests are
+// retried with the Repository's RetryPolicy unless p.Retry is set.
+func (r *Repository[T]) QueryWith(ctx context.Context, p *QueryParams) ([]T, error) {
+	if p != nil && p.Retry == nil {
+		q := *p
+		q.Retry = r.retry
+		p = &q
+	}
+	return QueryItems[T](ctx, r.svc, r.table, p)
+}
+
+// keyFromValues builds a primary key from partition and sort key values.
+func (r *Repository[T]) keyFromValues(pv, sv interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	key := map[string]*dynamodb.AttributeValue{}
+	v, err := dynamodbattribute.Marshal(pv)
+	if err != nil {
+		return nil, err
+	}
+	key[r.table.PrimaryKeyName] = v
+	if r.table.SortKeyName == "" {
+		return key, nil
+	}
+	if v, err = dynamodbattribute.Marshal(sv); err != nil {
+		return nil, err
+	}
+	key[r.table.SortKeyName] = v
+	return key, nil
+}
+
+// attrFields returns the exported fields of the struct type typ keyed by the
+// attribute name they marshal to, following the tag conventions of dynamodbattribute.
+// Fields of embedded structs without a tag name are promoted.
+func attrFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, tagged := attrName(f)
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+			for n, ef := range attrFields(ft) {
+				if _, ok := fields[n]; !ok {
+					ef.Index = append([]int{i}, ef.Index...)
+					fields[n] = ef
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// attrName returns the attribute name of f and whether it was set by a tag.
+func attrName(f reflect.StructField) (string, bool) {
+	for _, tag := range []string{"dynamodbav", "json"} {
+		if v, ok := f.Tag.Lookup(tag); ok {
+			if name := strings.Split(v, ",")[0]; name != "" {
+				return name, true
+			}
+		}
+	}
+	return f.Name, false
+}
@@ -0,0 +1,111 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	r, err := NewRepository[thing](f, tb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, th := range []thing{{"a", 1, "one"}, {"a", 2, "two"}, {"b", 1, "three"}} {
+		if err := r.Put(ctx, &th); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := r.Get(ctx, "a", 2); err != nil || got != (thing{"a", 2, "two"}) {
+		t.Errorf("Get: got %+v, %v", got, err)
+	}
+	if _, err := r.Get(ctx, "a", 3); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing: got %v, want ErrNotFound", err)
+	}
+
+	if err := r.Update(ctx, thing{ID: "a", Sort: 1, Title: "uno"}, "Title"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Get(ctx, "a", 1); err != nil || got.Title != "uno" {
+		t.Errorf("Get after Update: got %+v, %v", got, err)
+	}
+
+	got, err := r.BatchGet(ctx, []thing{{ID: "a", Sort: 2}, {ID: "c", Sort: 1}, {ID: "a", Sort: 1}, {ID: "a", Sort: 2}})
+	want := []thing{{"a", 2, "two"}, {"a", 1, "uno"}, {"a", 2, "two"}}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("BatchGet: got %+v, %v, want %+v", got, err, want)
+	}
+
+	if got, err := r.Query(ctx, "a"); err != nil || !slices.Equal(got, []thing{{"a", 1, "uno"}, {"a", 2, "two"}}) {
+		t.Errorf("Query: got %+v, %v", got, err)
+	}
+	got, err = r.QueryWith(ctx, &QueryParams{PartitionValue: "a", Sort: SortGreaterThan(1)})
+	if err != nil || !slices.Equal(got, []thing{{"a", 2, "two"}}) {
+		t.Errorf("QueryWith: got %+v, %v", got, err)
+	}
+
+	if err := r.Delete(ctx, thing{ID: "a", Sort: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get(ctx, "a", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if n := len(f.Items("things")); n != 2 {
+		t.Errorf("got %d items, want 2", n)
+	}
+}
+
+func TestRepositoryUpdateConflict(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	tb.VersionAttributeName = "Ver"
+	r, err := NewRepository[versioned](f, tb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := versioned{ID: "a", Sort: 1, Title: "one"}
+	if err := r.Put(ctx, &item); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := item
+	item.Title = "two"
+	if err := r.Update(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	stale.Title = "lost"
+	err = r.Update(ctx, stale, "Title")
+	var ce *ConditionError
+	if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &ce) {
+		t.Fatalf("got %v, want ErrVersionConflict", err)
+	}
+	var stored versioned
+	if err := ce.UnmarshalItem(&stored); err != nil || stored.Title != "two" || stored.Ver != 2 {
+		t.Errorf("got stored item %+v (%v), want Title two at Ver 2", stored, err)
+	}
+	stored.Title = "three"
+	if err := r.Update(ctx, stored); err != nil {
+		t.Errorf("Update at the stored version: %v", err)
+	}
+}
+
+func TestNewRepositoryErrors(t *testing.T) {
+	_, tb := newTestTable(t)
+	if _, err := NewRepository[string](nil, tb, nil); err == nil {
+		t.Error("string: got no error")
+	}
+	if _, err := NewRepository[struct{ ID string }](nil, tb, nil); err == nil {
+		t.Error("struct without sort key field: got no error")
+	}
+	type tagged struct {
+		Key  string `dynamodbav:"ID"`
+		Rank int    `json:"Sort"`
+	}
+	if _, err := NewRepository[tagged](nil, tb, nil); err != nil {
+		t.Errorf("tagged struct: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the RetryPolicy interface and the Backoff policy.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// RetryPolicy decides which failed requests are retried and how long to wait
+// between attempts. A RetryPolicy holds configuration only and must be safe for
+// concurrent use; the retry state of each operation is kept in the Retrier
+// returned by NewRetrier. *Backoff and *FailConfig implement RetryPolicy.
+type RetryPolicy interface {
+	// Retryable reports whether a request that failed with err may be retried.
+	Retryable(err error) bool
+	// NewRetrier returns the retry state of a new operation.
+	NewRetrier() Retrier
+}
+
+// Retrier holds the retry state of a single operation. It is not safe for concurrent use.
+type Retrier interface {
+	// Attempt returns the number of retries waited for so far.
+	Attempt() int
+	// Wait waits before the next attempt. It returns ErrMaxRetries if no attempts
+	// remain, or ctx.Err() if ctx is done before the wait is over.
+	Wait(ctx context.Context) error
+}
+
+// DefaultRetryPolicy is used by operations given no RetryPolicy, such as the
+// single-item and table operations. It retries with full jitter from a base of
+// 50 milliseconds, waiting at most 5 seconds between attempts and giving up 1
+// minute after the first. It may be replaced before the package is used.
+var DefaultRetryPolicy RetryPolicy = &Backoff{Base: 50 * time.Millisecond, Cap: 5 * time.Second, MaxElapsed: time.Minute}
+
+// Jitter selects how a Backoff randomizes its waits. See
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+type Jitter int
+
+const (
+	// FullJitter waits a random time between 0 and the exponential delay.
+	FullJitter Jitter = iota
+	// EqualJitter waits half the exponential delay plus a random time up to the other half.
+	EqualJitter
+	// DecorrelatedJitter waits a random time between Base and three times the previous wait.
+	DecorrelatedJitter
+)
+
+// Clock provides the current time and waits to a Backoff, so that tests can control them.
+type Clock interface {
+	Now() time.Time
+	// Sleep pauses for d or until ctx is done, in which case it returns ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// systemClock is the Clock of the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error { return sleep(ctx, d) }
+
+// Backoff is a RetryPolicy that retries with capped exponential backoff and jitter.
+// The exponential delay before retry n, counting from 0, is Base * 2^n, capped at Cap.
+// The zero values of MaxAttempts and MaxElapsed mean no limit, so at least one
+// of them should be set.
+//
+// ex: p := &Backoff{Base: 20 * time.Millisecond, Cap: time.Second, Jitter: EqualJitter, MaxAttempts: 8}
+type Backoff struct {
+	// Base is the exponential delay of the first retry.
+	Base time.Duration
+	// Cap is the longest wait between two attempts. Values <= 0 mean no cap.
+	Cap time.Duration
+	// Jitter selects how waits are randomized; FullJitter by default.
+	Jitter Jitter
+	// MaxAttempts is the maximum number of attempts of an operation, the first included.
+	MaxAttempts int
+	// MaxElapsed is the time after the start of an operation from which it is no
+	// longer retried. The last wait is shortened to end at MaxElapsed.
+	MaxElapsed time.Duration
+	// Classify reports whether an error is retryable. If nil, DefaultRetryable is used.
+	Classify func(err error) bool
+	// Clock provides the time and waits. If nil, the system clock is used.
+	Clock Clock
+	// Rand returns a random number in [0, n) and must be safe for concurrent use.
+	// If nil, math/rand is used.
+	Rand func(n int64) int64
+}
+
+// Retryable reports whether err may be retried, as decided by b.Classify.
+func (b *Backoff) Retryable(err error) bool {
+	if b.Classify != nil {
+		return b.Classify(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// NewRetrier returns the retry state of a new operation, which starts now.
+func (b *Backoff) NewRetrier() Retrier {
+	clock := b.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &backoffRetrier{b: b, clock: clock, start: clock.Now()}
+}
+
+// backoffRetrier is the Retrier of a Backoff.
+type backoffRetrier struct {
+	b       *Backoff
+	clock   Clock
+	start   time.Time
+	attempt int
+	prev    time.Duration
+}
+
+func (r *backoffRetrier) Attempt() int { return r.attempt }
+
+func (r *backoffRetrier) Wait(ctx context.Context) error {
+	if r.b.MaxAttempts > 0 && r.attempt+1 >= r.b.MaxAttempts {
+		return ErrMaxRetries
+	}
+	d := r.b.delay(r.attempt, r.prev)
+	if r.b.MaxElapsed > 0 {
+		left := r.b.MaxElapsed - r.clock.Now().Sub(r.start)
+		if left <= 0 {
+			return ErrMaxRetries
+		}
+		if d > left {
+			d = left
+		}
+	}
+	r.attempt++
+	r.prev = d
+	return r.clock.Sleep(ctx, d)
+}
+
+// delay returns the wait before retry n, counting from 0, where prev is the previous wait.
+func (b *Backoff) delay(n int, prev time.Duration) time.Duration {
+	switch b.Jitter {
+	case EqualJitter:
+		d := b.exp(n)
+		return d/2 + b.randn(d-d/2)
+	case DecorrelatedJitter:
+		if prev < b.Base {
+			prev = b.Base
+		}
+		upper := time.Duration(math.MaxInt64)
+		if prev <= upper/3 {
+			upper = prev * 3
+		}
+		return b.capped(b.Base + b.randn(upper-b.Base))
+	}
+	return b.randn(b.exp(n))
+}
+
+// exp returns Base * 2^n capped at Cap, without overflowing.
+func (b *Backoff) exp(n int) time.Duration {
+	max := b.capped(math.MaxInt64)
+	if n >= 63 || b.Base > max>>uint(n) {
+		return max
+	}
+	return b.Base << uint(n)
+}
+
+// capped returns d, or Cap if d exceeds it.
+func (b *Backoff) capped(d time.Duration) time.Duration {
+	if b.Cap > 0 && d > b.Cap {
+		return b.Cap
+	}
+	return d
+}
+
+// randn returns a random duration in [0, n), or 0 if n <= 0.
+func (b *Backoff) randn(n time.Duration) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	if b.Rand != nil {
+		return time.Duration(b.Rand(int64(n)))
+	}
+	return time.Duration(rand.Int63n(int64(n)))
+}
+
+// DefaultRetryable reports whether a request that failed with err may be retried:
+// HTTP 5xx errors, throttling errors (ProvisionedThroughputExceeded,
+// RequestLimitExceeded, ThrottlingException) and network errors are.
+func DefaultRetryable(err error) bool {
+	switch errCode(err) {
+	case dynamodb.ErrCodeInternalServerError, errCodeServiceUnavailable, request.ErrCodeRequestError:
+		return true
+	}
+	return errKind(err) == ErrThrottled
+}
+
+// RetryableCodes returns a classifier for Backoff.Classify that retries errors
+// with one of the given AWS error codes.
+//
+// ex: p := &Backoff{Base: time.Millisecond, MaxAttempts: 5, Classify: RetryableCodes(dynamodb.ErrCodeInternalServerError)}
+func RetryableCodes(codes ...string) func(err error) bool {
+	set := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		set[c] = true
+	}
+	return func(err error) bool {
+		return set[errCode(err)]
+	}
+}
+
+// retryPolicy returns p, or DefaultRetryPolicy if p is nil.
+func retryPolicy(p RetryPolicy) RetryPolicy {
+	switch v := p.(type) {
+	case nil:
+		return DefaultRetryPolicy
+	case *FailConfig:
+		if v == nil {
+			return DefaultRetryPolicy
+		}
+	case *Backoff:
+		if v == nil {
+			return DefaultRetryPolicy
+		}
+	}
+	return p
+}
+
+// onceRetryPolicy is the RetryPolicy of writes that must not be applied twice,
+// such as adding to a counter. Of the errors RetryPolicy retries, only throttling
+// errors are, as DynamoDB rejects throttled requests without applying them; a
+// request that failed with a network or server error may have been applied.
+type onceRetryPolicy struct {
+	RetryPolicy
+}
+
+func (p onceRetryPolicy) Retryable(err error) bool {
+	return errKind(err) == ErrThrottled && p.RetryPolicy.Retryable(err)
+}
+
+// withRetry calls fn until it succeeds, fails with an error p does not retry, or
+// p gives up, and returns fn's last error. op and table are used for logs.
+func withRetry(ctx context.Context, p RetryPolicy, op, table string, fn func() error) error {
+	r := p.NewRetrier()
+	for {
+		err := fn()
+		if err == nil || ctx.Err() != nil || !p.Retryable(err) {
+			return err
+		}
+		logRetry(op, table, r.Attempt()+1, err)
+		if err := retryWait(ctx, r, err); err != nil { // waits
+			return err
+		}
+	}
+}
+
+// retryWait waits with r before retrying a request that failed with err. It
+// returns nil to retry, ctx.Err() if ctx is done, or err wrapped with
+// ErrMaxRetries if no attempts remain.
+func retryWait(ctx context.Context, r Retrier, err error) error {
+	if werr := r.Wait(ctx); werr != nil {
+		if errors.Is(werr, ErrMaxRetries) {
+			return fmt.Errorf("%w: %w", ErrMaxRetries, safeErr(err))
+		}
+		return werr
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+// fakeClock is a Clock whose Sleep advances Now instantly and records the waits.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	return nil
+}
+
+// Rand functions returning the bounds of [0, n).
+func randMin(int64) int64   { return 0 }
+func randMax(n int64) int64 { return n - 1 }
+
+// waitAll calls r.Wait until it fails and returns the number of successful waits.
+func waitAll(t *testing.T, r Retrier) int {
+	t.Helper()
+	for n := 0; n < 10000; n++ {
+		if err := r.Wait(context.Background()); err != nil {
+			if !errors.Is(err, ErrMaxRetries) {
+				t.Fatalf("got %v, want ErrMaxRetries", err)
+			}
+			return n
+		}
+	}
+	t.Fatal("retrier never gave up")
+	return 0
+}
+
+func TestJitterBounds(t *testing.T) {
+	const base, cp = 10 * time.Millisecond, time.Second
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		jitter Jitter
+		bounds func(n int, prev time.Duration) (lo, hi time.Duration) // [lo, hi)
+	}{
+		{FullJitter, func(n int, _ time.Duration) (time.Duration, time.Duration) {
+			return 0, min(base<<n, cp)
+		}},
+		{EqualJitter, func(n int, _ time.Duration) (time.Duration, time.Duration) {
+			d := min(base<<n, cp)
+			return d / 2, d
+		}},
+		{DecorrelatedJitter, func(_ int, prev time.Duration) (time.Duration, time.Duration) {
+			return base, min(3*max(prev, base), cp)
+		}},
+	}
+	for _, tt := range tests {
+		for _, r := range []func(int64) int64{randMin, randMax, rnd.Int63n} {
+			b := &Backoff{Base: base, Cap: cp, Jitter: tt.jitter, Rand: r}
+			var prev time.Duration
+			for n := 0; n < 20; n++ {
+				d := b.delay(n, prev)
+				lo, hi := tt.bounds(n, prev)
+				if d < lo || d >= hi && !(d == cp && hi == cp) {
+					t.Errorf("jitter %d: delay(%d, %v) = %v, want in [%v, %v)", tt.jitter, n, prev, d, lo, hi)
+				}
+				prev = d
+			}
+		}
+	}
+}
+
+func TestExpOverflow(t *testing.T) {
+	tests := []struct {
+		b    *Backoff
+		want time.Duration // exp of large n
+	}{
+		{&Backoff{Base: time.Second}, math.MaxInt64},
+		{&Backoff{Base: 3 * time.Millisecond}, math.MaxInt64},
+		{&Backoff{Base: time.Second, Cap: time.Minute}, time.Minute},
+	}
+	for _, tt := range tests {
+		prev := time.Duration(0)
+		for n := 0; n < 200; n++ {
+			d := tt.b.exp(n)
+			if d < prev || d <= 0 {
+				t.Fatalf("%+v: exp(%d) = %v after %v", tt.b, n, d, prev)
+			}
+			prev = d
+		}
+		if prev != tt.want {
+			t.Errorf("%+v: exp(199) = %v, want %v", tt.b, prev, tt.want)
+		}
+	}
+}
+
+func TestCap(t *testing.T) {
+	for _, jitter := range []Jitter{FullJitter, EqualJitter, DecorrelatedJitter} {
+		clock := &fakeClock{}
+		b := &Backoff{Base: time.Millisecond, Cap: 100 * time.Millisecond, Jitter: jitter, MaxAttempts: 50, Clock: clock, Rand: randMax}
+		if n := waitAll(t, b.NewRetrier()); n != 49 {
+			t.Errorf("jitter %d: got %d waits, want 49", jitter, n)
+		}
+		if m := slices.Max(clock.sleeps); m > b.Cap || m < b.Cap-time.Nanosecond {
+			t.Errorf("jitter %d: longest wait %v, want cap %v", jitter, m, b.Cap)
+		}
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	for _, attempts := range []int{1, 2, 5} {
+		f := dynamotest.New()
+		f.FailNext("ListTables", dynamodb.ErrCodeInternalServerError, 10)
+		clock := &fakeClock{}
+		p := &Backoff{Base: time.Millisecond, MaxAttempts: attempts, Clock: clock}
+
+		err := withRetry(context.Background(), p, "ListTables", "", func() error {
+			_, err := f.ListTables(&dynamodb.ListTablesInput{})
+			return err
+		})
+		if !errors.Is(err, ErrMaxRetries) || errCode(err) != dynamodb.ErrCodeInternalServerError {
+			t.Errorf("MaxAttempts %d: got %v, want ErrMaxRetries and the last failure", attempts, err)
+		}
+		if got := f.Calls("ListTables"); got != attempts {
+			t.Errorf("MaxAttempts %d: got %d attempts", attempts, got)
+		}
+		if len(clock.sleeps) != attempts-1 {
+			t.Errorf("MaxAttempts %d: got %d waits, want %d", attempts, len(clock.sleeps), attempts-1)
+		}
+	}
+}
+
+func TestMaxElapsed(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := &Backoff{Base: time.Second, MaxElapsed: 2500 * time.Millisecond, Clock: clock, Rand: randMax}
+	if n := waitAll(t, b.NewRetrier()); n != 2 {
+		t.Fatalf("got %d waits, want 2", n)
+	}
+	want := []time.Duration{time.Second - 1, 1500*time.Millisecond + 1}
+	if !slices.Equal(clock.sleeps, want) {
+		t.Errorf("got waits %v, want %v", clock.sleeps, want)
+	}
+	if elapsed := clock.now.Sub(time.Unix(0, 0)); elapsed != b.MaxElapsed {
+		t.Errorf("gave up after %v, want %v", elapsed, b.MaxElapsed)
+	}
+}
+
+func TestFailConfigBackoff(t *testing.T) {
+	fc := &FailConfig{Base: 10, Cap: 1000}
+	got, want := fc.backoff(), &Backoff{Base: 10 * time.Millisecond, MaxElapsed: time.Second}
+	for seed := int64(0); seed < 3; seed++ {
+		gotClock, wantClock := &fakeClock{}, &fakeClock{}
+		got.Clock, got.Rand = gotClock, rand.New(rand.NewSource(seed)).Int63n
+		want.Clock, want.Rand = wantClock, rand.New(rand.NewSource(seed)).Int63n
+		waitAll(t, got.NewRetrier())
+		waitAll(t, want.NewRetrier())
+		if !slices.Equal(gotClock.sleeps, wantClock.sleeps) {
+			t.Errorf("got waits %v, want %v", gotClock.sleeps, wantClock.sleeps)
+		}
+	}
+	for _, code := range []string{dynamodb.ErrCodeInternalServerError, dynamodb.ErrCodeConditionalCheckFailedException} {
+		err := dynamotest.NewError(code, "x")
+		if fc.Retryable(err) != DefaultRetryable(err) {
+			t.Errorf("%s: FailConfig.Retryable differs from DefaultRetryable", code)
+		}
+	}
+	if !fc.Retryable(dynamotest.NewError(dynamodb.ErrCodeProvisionedThroughputExceededException, "x")) {
+		t.Error("throttling is not retryable")
+	}
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		op    string // API called
+		retry bool   // whether a network error is retried
+		call  func(f *dynamotest.Fake, tb *Table) error
+	}{
+		{"set", "UpdateItem", true, func(f *dynamotest.Fake, tb *Table) error {
+			return UpdateItemWith(ctx, f, tb, CreateNewQueryObj("a", 1), NewUpdate().Set("Title", "x"), nil)
+		}},
+		{"add", "UpdateItem", false, func(f *dynamotest.Fake, tb *Table) error {
+			return UpdateItemWith(ctx, f, tb, CreateNewQueryObj("a", 1), NewUpdate().Add("Views", 1), nil)
+		}},
+		{"append", "UpdateItem", false, func(f *dynamotest.Fake, tb *Table) error {
+			return UpdateItemWith(ctx, f, tb, CreateNewQueryObj("a", 1), NewUpdate().Append("Tags", []string{"x"}), nil)
+		}},
+		{"version bump", "UpdateItem", false, func(f *dynamotest.Fake, tb *Table) error {
+			tb.VersionAttributeName = "Ver"
+			return UpdateItemWith(ctx, f, tb, CreateNewQueryObj("a", 1), NewUpdate().Set("Title", "x"), nil)
+		}},
+		{"legacy version bump", "UpdateItem", false, func(f *dynamotest.Fake, tb *Table) error {
+			tb.VersionAttributeName = "Ver"
+			q := CreateNewQueryObj("a", 1)
+			q.UpdateCurrent("Title", "x")
+			return UpdateItem(f, q, tb)
+		}},
+		{"put", "PutItem", true, func(f *dynamotest.Fake, tb *Table) error {
+			return CreateItem(f, thing{ID: "a", Sort: 1}, tb)
+		}},
+		{"versioned put", "PutItem", false, func(f *dynamotest.Fake, tb *Table) error {
+			tb.VersionAttributeName = "Ver"
+			return CreateItem(f, versioned{ID: "a", Sort: 1}, tb)
+		}},
+		{"create table", "CreateTable", false, func(f *dynamotest.Fake, _ *Table) error {
+			tb, _ := NewTable("others", "ID", "string", "", "")
+			return CreateTable(f, tb)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, code := range []string{request.ErrCodeRequestError, dynamodb.ErrCodeRequestLimitExceeded} {
+				f, tb := newTestTable(t)
+				retried := tt.retry || code == dynamodb.ErrCodeRequestLimitExceeded
+				checkRetry(t, f, tt.op, code, retried, func() error { return tt.call(f, tb) })
+			}
+		})
+	}
+}
+
+func TestInitSeshDisablesRetries(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	if n := aws.IntValue(InitSesh().Config.MaxRetries); n != 0 {
+		t.Errorf("got MaxRetries %d, want 0", n)
+	}
+}
+
+func TestLegacyRetryPolicy(t *testing.T) {
+	var nilConfig *FailConfig
+	tests := []struct {
+		name    string
+		p       RetryPolicy
+		retried bool
+	}{
+		{"nil", nil, true},
+		{"nil FailConfig", nilConfig, true},
+		{"FailConfig", &FailConfig{Base: 0.001, Cap: 1000}, true},
+		{"Backoff", &Backoff{MaxAttempts: 1}, false},
+		{"DbInfo FailConfig", (&DbInfo{FailConfig: &FailConfig{Base: 0.001, Cap: 1000}}).RetryPolicy(), true},
+		{"DbInfo Retry", (&DbInfo{FailConfig: DefaultFailConfig, Retry: &Backoff{MaxAttempts: 1}}).RetryPolicy(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newTestTable(t)
+			checkRetry(t, f, "BatchWriteItem", dynamodb.ErrCodeInternalServerError, tt.retried, func() error {
+				return BatchWriteCreate(f, tb, tt.p, []interface{}{thing{ID: "a", Sort: 1}})
+			})
+			checkRetry(t, f, "BatchGetItem", dynamodb.ErrCodeInternalServerError, tt.retried, func() error {
+				_, err := BatchGet(f, tb, tt.p, []*Query{CreateNewQueryObj("a", 1)}, []interface{}{&thing{}})
+				return err
+			})
+		})
+	}
+	if p := InitDbInfo().RetryPolicy(); p != nil {
+		t.Errorf("InitDbInfo: got RetryPolicy %v, want nil", p)
+	}
+}
@@ -0,0 +1,205 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the sequential and parallel Scan operations.
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// ScanParams holds the optional parameters of a scan of a Table.
+// The zero value scans every item and attribute.
+type ScanParams struct {
+	// IndexName optionally names a secondary index of the Table to scan instead of the Table.
+	IndexName string
+	// Filter optionally discards items after they are read. Filtered items still
+	// consume read capacity.
+	Filter *expression.ConditionBuilder
+	// Projection optionally names the attributes to return; by default all are returned.
+	Projection []string
+	// PageSize is the maximum number of items read per request, or 0 for the
+	// DynamoDB default of 1 MB of data.
+	PageSize int64
+	// ConsistentRead requests a strongly consistent read.
+	ConsistentRead bool
+	// Retry decides which failed requests are retried; if nil, DefaultRetryPolicy is used.
+	Retry RetryPolicy
+}
+
+// ScanItems returns an iterator over every item of table t matching p, unmarshaled into T.
+// Pages are requested as the iterator advances. Iteration stops after the first
+// error, which is yielded with the zero value of T.
+//
+// ex:
+//
+//	for m, err := range ScanItems[Movie](ctx, svc, t, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func ScanItems[T any](ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, p *ScanParams) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		input, err := scanInput(t, p)
+		if err != nil {
+			var zero T
+			yield(zero, opErr("Scan", t.TableName, err))
+			return
+		}
+		err = scanSegment(ctx, svc, t, p.retryPolicy(), input, func(item T) bool { return yield(item, nil) })
+		if err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// ParallelScan scans table t in the given number of segments concurrently, calling
+// fn for each item matching p. fn is called from one goroutine per segment, so it
+// must be safe for concurrent use. The scan stops at the first error returned by
+// fn or by DynamoDB, and that error is returned.
+func ParallelScan[T any](ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, p *ScanParams, segments int, fn func(T) error) error {
+	if segments < 1 || segments > 1000000 {
+		return opErr("Scan", t.TableName, fmt.Errorf("segments must be between 1 and 1000000, got %d", segments))
+	}
+	if _, err := scanInput(t, p); err != nil {
+		return opErr("Scan", t.TableName, err)
+	}
+	retry := p.retryPolicy()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	for seg := 0; seg < segments; seg++ {
+		input, _ := scanInput(t, p)
+		input.Segment = aws.Int64(int64(seg))
+		input.TotalSegments = aws.Int64(int64(segments))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := scanSegment(ctx, svc, t, retry, input, func(item T) bool {
+				if err := fn(item); err != nil {
+					fail(err)
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// scanSegment reads every page of input, passing each item to yield until it returns false.
+// Failed requests are retried as decided by retry.
+func scanSegment[T any](ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, retry RetryPolicy, input *dynamodb.ScanInput, yield func(T) bool) error {
+	count := 0
+	for {
+		var result *dynamodb.ScanOutput
+		err := withRetry(ctx, retry, "Scan", t.TableName, func() (err error) {
+			result, err = svc.ScanWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			logErr("Scan", t.TableName, err)
+			return ctxOpErr(ctx, "Scan", t.TableName, err)
+		}
+		for _, av := range result.Items {
+			var item T
+			if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+				logErr("Scan", t.TableName, err)
+				return opErr("Scan", t.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
+			}
+			count++
+			if !yield(item) {
+				return nil
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	logger().Debug("scanned items", slog.String("op", "Scan"), slog.String("table", t.TableName),
+		slog.Int64("segment", aws.Int64Value(input.Segment)), slog.Int("count", count))
+	return nil
+}
+
+// retryPolicy returns p.Retry, or DefaultRetryPolicy if p or p.Retry is nil.
+func (p *ScanParams) retryPolicy() RetryPolicy {
+	if p == nil {
+		return DefaultRetryPolicy
+	}
+	return retryPolicy(p.Retry)
+}
+
+// scanInput builds the ScanInput for p on table t.
+func scanInput(t *Table, p *ScanParams) (*dynamodb.ScanInput, error) {
+	if p == nil {
+		p = &ScanParams{}
+	}
+	input := &dynamodb.ScanInput{
+		ConsistentRead: aws.Bool(p.ConsistentRead),
+		TableName:      aws.String(t.TableName),
+	}
+	if p.PageSize > 0 {
+		input.Limit = aws.Int64(p.PageSize)
+	}
+	if p.IndexName != "" {
+		if _, _, err := t.indexKeys(p.IndexName); err != nil {
+			return nil, err
+		}
+		if p.ConsistentRead && t.isGlobalIndex(p.IndexName) {
+			return nil, fmt.Errorf("consistent reads are not supported on global index %s", p.IndexName)
+		}
+		input.IndexName = aws.String(p.IndexName)
+	}
+	if p.Filter == nil && len(p.Projection) == 0 {
+		return input, nil
+	}
+
+	b := expression.NewBuilder()
+	if p.Filter != nil {
+		b = b.WithFilter(*p.Filter)
+	}
+	if len(p.Projection) > 0 {
+		b = b.WithProjection(projection(p.Projection))
+	}
+	expr, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	input.ExpressionAttributeNames = expr.Names()
+	input.ExpressionAttributeValues = expr.Values()
+	input.FilterExpression = expr.Filter()
+	input.ProjectionExpression = expr.Projection()
+	return input, nil
+}
@@ -0,0 +1,115 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+func TestScanItems(t *testing.T) {
+	ctx := context.Background()
+	notB := expression.Name("ID").NotEqual(expression.Value("b"))
+	tests := []struct {
+		name  string
+		p     *ScanParams
+		stop  int // items read before breaking out of the loop, or 0
+		want  int // items read
+		calls int
+	}{
+		{name: "one page", want: 11, calls: 1},
+		{name: "pages", p: &ScanParams{PageSize: 3}, want: 11, calls: 4},
+		{name: "filter across pages", p: &ScanParams{PageSize: 3, Filter: &notB}, want: 10, calls: 4},
+		{name: "break", p: &ScanParams{PageSize: 3}, stop: 4, want: 4, calls: 2},
+		{name: "break at page end", p: &ScanParams{PageSize: 3}, stop: 3, want: 3, calls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newQueryTable(t)
+			seen := map[string]bool{}
+			for th, err := range ScanItems[thing](ctx, f, tb, tt.p) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				key := fmt.Sprint(th.ID, "/", th.Sort)
+				if seen[key] {
+					t.Errorf("item %s read twice", key)
+				}
+				seen[key] = true
+				if len(seen) == tt.stop {
+					break
+				}
+			}
+			if len(seen) != tt.want {
+				t.Errorf("got %d items, want %d", len(seen), tt.want)
+			}
+			if n := f.Calls("Scan"); n != tt.calls {
+				t.Errorf("got %d Scan calls, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestScanItemsError(t *testing.T) {
+	f, tb := newQueryTable(t)
+	f.FailNext("Scan", "ValidationException", 1)
+	var errs, items int
+	for _, err := range ScanItems[thing](context.Background(), f, tb, nil) {
+		if err != nil {
+			errs++
+			continue
+		}
+		items++
+	}
+	if errs != 1 || items != 0 {
+		t.Errorf("got %d errors and %d items, want 1 error", errs, items)
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	var items []interface{}
+	for i := 0; i < 200; i++ {
+		items = append(items, thing{ID: fmt.Sprint("id", i%13), Sort: i})
+	}
+	if _, err := BatchPut(ctx, f, tb, items, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, segments := range []int{1, 4, 7} {
+		var mu sync.Mutex
+		seen := map[int]int{}
+		err := ParallelScan(ctx, f, tb, &ScanParams{PageSize: 10}, segments, func(th thing) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[th.Sort]++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			if seen[i] != 1 {
+				t.Errorf("%d segments: item %d read %d times", segments, i, seen[i])
+			}
+		}
+	}
+
+	stop := errors.New("stop")
+	err := ParallelScan(ctx, f, tb, nil, 4, func(thing) error { return stop })
+	if err != stop {
+		t.Errorf("got %v, want the error returned by fn", err)
+	}
+	f.FailNext("Scan", dynamodb.ErrCodeResourceNotFoundException, 1)
+	if err := ParallelScan(ctx, f, tb, nil, 4, func(thing) error { return nil }); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("got %v, want ErrTableNotFound", err)
+	}
+	if err := ParallelScan(ctx, f, tb, nil, 0, func(thing) error { return nil }); err == nil {
+		t.Error("0 segments: got no error")
+	}
+}
@@ -0,0 +1,198 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains functions for deriving a Table from the dynamo tags of a Go struct.
+package dynamo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// NewTableFromStruct creates a Table named tableName from the dynamo tags of v,
+// which must be a struct or a pointer to one. Attribute names follow the same
+// rules as dynamodbattribute: the dynamodbav tag name, else the json tag name,
+// else the field name. Fields may carry one or more ';' separated roles:
+//
+//	dynamo:"pk"             table partition key
+//	dynamo:"sk"             table sort key
+//	dynamo:"gsi:ByEmail,pk" partition key of global secondary index ByEmail
+//	dynamo:"gsi:ByEmail,sk" sort key of global secondary index ByEmail
+//	dynamo:"lsi:ByDate,sk"  sort key of local secondary index ByDate
+//	dynamo:"ttl"            time to live attribute
+//	dynamo:"version"        optimistic locking version attribute
+//
+// Key attributes must marshal to a String, Number or Binary value and the time to
+// live and version attributes to a Number value. Indexes project ALL attributes;
+// set ProjectionType on the returned Indexes to change that. Returns an error
+// describing the first invalid tag.
+//
+// ex: t, err := NewTableFromStruct("users", User{})
+func NewTableFromStruct(tableName string, v interface{}) (*Table, error) {
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("NewTableFromStruct failed: %v is not a struct type", typ)
+	}
+
+	t := &Table{TableName: tableName}
+	gsis := map[string]*Index{}
+	lsis := map[string]*Index{}
+	fields := attrFields(typ)
+	for _, name := range sortedKeys(fields) {
+		f := fields[name]
+		tag := f.Tag.Get("dynamo")
+		if tag == "" {
+			continue
+		}
+		for _, role := range strings.Split(tag, ";") {
+			if err := t.applyRole(gsis, lsis, name, f, strings.TrimSpace(role)); err != nil {
+				return nil, fmt.Errorf("NewTableFromStruct failed: %s.%s: %w", typ, f.Name, err)
+			}
+		}
+	}
+
+	if t.PrimaryKeyName == "" {
+		return nil, fmt.Errorf("NewTableFromStruct failed: %s has no field tagged dynamo:\"pk\"", typ)
+	}
+	if t.SortKeyName == t.PrimaryKeyName {
+		return nil, fmt.Errorf("NewTableFromStruct failed: %q is both partition and sort key", t.PrimaryKeyName)
+	}
+	for _, name := range sortedKeys(gsis) {
+		idx := gsis[name]
+		if idx.PrimaryKeyName == "" {
+			return nil, fmt.Errorf("NewTableFromStruct failed: global index %s has no partition key", name)
+		}
+		if idx.SortKeyName == idx.PrimaryKeyName {
+			return nil, fmt.Errorf("NewTableFromStruct failed: %q is both partition and sort key of %s", idx.PrimaryKeyName, name)
+		}
+		t.GlobalIndexes = append(t.GlobalIndexes, idx)
+	}
+	for _, name := range sortedKeys(lsis) {
+		if t.SortKeyName == "" {
+			return nil, fmt.Errorf("NewTableFromStruct failed: local index %s requires the table to have a sort key", name)
+		}
+		t.LocalIndexes = append(t.LocalIndexes, lsis[name])
+	}
+	return t, nil
+}
+
+// applyRole records the role given by one element of a dynamo tag for the
+// field f, which marshals to the attribute name.
+func (t *Table) applyRole(gsis, lsis map[string]*Index, name string, f reflect.StructField, role string) error {
+	switch {
+	case role == "pk":
+		return setKey(&t.PrimaryKeyName, &t.PrimaryKeyType, "table partition key", name, f)
+	case role == "sk":
+		return setKey(&t.SortKeyName, &t.SortKeyType, "table sort key", name, f)
+	case role == "ttl":
+		if t.TTLAttributeName != "" {
+			return fmt.Errorf("time to live attribute already set to %q", t.TTLAttributeName)
+		}
+		if typ, _ := attrType(f); typ != "N" {
+			return fmt.Errorf("time to live attribute must be a Number, not %s", f.Type)
+		}
+		t.TTLAttributeName = name
+		return nil
+	case role == "version":
+		if t.VersionAttributeName != "" {
+			return fmt.Errorf("version attribute already set to %q", t.VersionAttributeName)
+		}
+		if typ, _ := attrType(f); typ != "N" {
+			return fmt.Errorf("version attribute must be a Number, not %s", f.Type)
+		}
+		t.VersionAttributeName = name
+		return nil
+	case strings.HasPrefix(role, "gsi:"), strings.HasPrefix(role, "lsi:"):
+		kind, spec, _ := strings.Cut(role, ":")
+		idxName, key, ok := strings.Cut(spec, ",")
+		if !ok || idxName == "" {
+			return fmt.Errorf("invalid tag %q: expected %s:<name>,pk or %s:<name>,sk", role, kind, kind)
+		}
+		indexes := gsis
+		if kind == "lsi" {
+			indexes = lsis
+		}
+		idx, ok := indexes[idxName]
+		if !ok {
+			idx = &Index{IndexName: idxName}
+			indexes[idxName] = idx
+		}
+		switch {
+		case key == "pk" && kind == "gsi":
+			return setKey(&idx.PrimaryKeyName, &idx.PrimaryKeyType, "partition key of "+idxName, name, f)
+		case key == "pk":
+			return fmt.Errorf("invalid tag %q: a local index shares the table partition key", role)
+		case key == "sk":
+			return setKey(&idx.SortKeyName, &idx.SortKeyType, "sort key of "+idxName, name, f)
+		}
+		return fmt.Errorf("invalid tag %q: expected %s:<name>,pk or %s:<name>,sk", role, kind, kind)
+	}
+	return fmt.Errorf("invalid tag %q", role)
+}
+
+// setKey sets a key name and type to the attribute of field f.
+func setKey(keyName, keyType *string, desc, name string, f reflect.StructField) error {
+	if *keyName != "" {
+		return fmt.Errorf("%s already set to %q", desc, *keyName)
+	}
+	typ, err := attrType(f)
+	if err != nil {
+		return err
+	}
+	*keyName, *keyType = name, typ
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	unixTimeType = reflect.TypeOf(dynamodbattribute.UnixTime{})
+)
+
+// attrType returns the scalar attribute type, S, N or B, that the field f marshals to.
+// Returns an error if f does not marshal to a scalar type that can be used as a key.
+func attrType(f reflect.StructField) (string, error) {
+	typ := f.Type
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	opts := strings.Split(f.Tag.Get("dynamodbav"), ",")[1:]
+	hasOpt := func(opt string) bool {
+		for _, o := range opts {
+			if o == opt {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case typ == unixTimeType:
+		return "N", nil
+	case typ == timeType:
+		if hasOpt("unixtime") {
+			return "N", nil
+		}
+		return "S", nil
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return "B", nil
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return "S", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if hasOpt("string") {
+			return "S", nil
+		}
+		return "N", nil
+	}
+	return "", fmt.Errorf("unsupported key type %s: keys must be strings, numbers or []byte", f.Type)
+}
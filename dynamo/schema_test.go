@@ -0,0 +1,130 @@
+package dynamo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestNewTableFromStruct(t *testing.T) {
+	type user struct {
+		ID      string                     `dynamo:"pk"`
+		Created time.Time                  `dynamo:"sk;lsi:ByCreated,sk" dynamodbav:"created"`
+		Email   string                     `dynamo:"gsi:ByEmail,pk" json:"email"`
+		Score   float64                    `dynamo:"gsi:ByEmail,sk;lsi:ByScore,sk"`
+		Code    int                        `dynamo:"gsi:ByCode,pk" dynamodbav:",string"`
+		Avatar  []byte                     `dynamo:"gsi:ByAvatar,pk"`
+		Expires dynamodbattribute.UnixTime `dynamo:"ttl"`
+		Ver     *int64                     `dynamo:"version"`
+		Skipped string                     `dynamo:"pk" dynamodbav:"-"`
+		Name    string
+	}
+	type ttlTime struct {
+		ID      string    `dynamo:"pk"`
+		Expires time.Time `dynamo:"ttl" dynamodbav:",unixtime"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want *Table
+		err  string // substring of the error, if any
+	}{
+		{name: "all roles", v: &user{}, want: &Table{
+			TableName:      "things",
+			PrimaryKeyName: "ID", PrimaryKeyType: "S",
+			SortKeyName: "created", SortKeyType: "S",
+			GlobalIndexes: []*Index{
+				{IndexName: "ByAvatar", PrimaryKeyName: "Avatar", PrimaryKeyType: "B"},
+				{IndexName: "ByCode", PrimaryKeyName: "Code", PrimaryKeyType: "S"},
+				{IndexName: "ByEmail", PrimaryKeyName: "email", PrimaryKeyType: "S", SortKeyName: "Score", SortKeyType: "N"},
+			},
+			LocalIndexes: []*Index{
+				{IndexName: "ByCreated", SortKeyName: "created", SortKeyType: "S"},
+				{IndexName: "ByScore", SortKeyName: "Score", SortKeyType: "N"},
+			},
+			TTLAttributeName:     "Expires",
+			VersionAttributeName: "Ver",
+		}},
+		{name: "unixtime ttl", v: ttlTime{}, want: &Table{
+			TableName:      "things",
+			PrimaryKeyName: "ID", PrimaryKeyType: "S",
+			TTLAttributeName: "Expires",
+		}},
+		{name: "not a struct", v: "x", err: "not a struct"},
+		{name: "nil", v: nil, err: "not a struct"},
+		{name: "no pk", v: struct {
+			ID string `dynamo:"sk"`
+		}{}, err: `no field tagged dynamo:"pk"`},
+		{name: "duplicate pk", v: struct {
+			A string `dynamo:"pk"`
+			B string `dynamo:"pk"`
+		}{}, err: `table partition key already set to "A"`},
+		{name: "pk and sk", v: struct {
+			A string `dynamo:"pk;sk"`
+		}{}, err: "both partition and sort key"},
+		{name: "bool key", v: struct {
+			A bool `dynamo:"pk"`
+		}{}, err: "unsupported key type bool"},
+		{name: "map key", v: struct {
+			A string            `dynamo:"pk"`
+			B map[string]string `dynamo:"gsi:ByB,pk"`
+		}{}, err: "unsupported key type"},
+		{name: "string ttl", v: struct {
+			A string `dynamo:"pk"`
+			B string `dynamo:"ttl"`
+		}{}, err: "time to live attribute must be a Number"},
+		{name: "time version", v: struct {
+			A string    `dynamo:"pk"`
+			B time.Time `dynamo:"version"`
+		}{}, err: "version attribute must be a Number"},
+		{name: "two versions", v: struct {
+			A string `dynamo:"pk"`
+			B int    `dynamo:"version"`
+			C int    `dynamo:"version"`
+		}{}, err: "version attribute already set"},
+		{name: "unknown role", v: struct {
+			A string `dynamo:"pk;hash"`
+		}{}, err: `invalid tag "hash"`},
+		{name: "index without key", v: struct {
+			A string `dynamo:"pk"`
+			B string `dynamo:"gsi:ByB"`
+		}{}, err: "expected gsi:<name>,pk"},
+		{name: "gsi without pk", v: struct {
+			A string `dynamo:"pk"`
+			B string `dynamo:"gsi:ByB,sk"`
+		}{}, err: "global index ByB has no partition key"},
+		{name: "lsi pk", v: struct {
+			A string `dynamo:"pk"`
+			B string `dynamo:"sk"`
+			C string `dynamo:"lsi:ByC,pk"`
+		}{}, err: "shares the table partition key"},
+		{name: "lsi without table sk", v: struct {
+			A string `dynamo:"pk"`
+			C string `dynamo:"lsi:ByC,sk"`
+		}{}, err: "requires the table to have a sort key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTableFromStruct("things", tt.v)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the WriteTx and GetTx objects and the transactional operations.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// maxTxItems is the maximum number of operations in a single transaction.
+const maxTxItems = 100
+
+// WriteTx holds the operations of a TransactWriteItems call, which are applied
+// all together or not at all. The operations may target any Tables of the same
+// account and region, such as those of a DbInfo, but no two may target the same
+// item. WriteTxs are created with NewWriteTx, and each method returns the WriteTx
+// so calls can be chained:
+//
+//	tx := NewWriteTx().
+//		Put(d.Tables["orders"], order, IfNotExists(d.Tables["orders"])).
+//		Update(d.Tables["stock"], q, NewUpdate().Add("Count", -1), If(expression.Name("Count").GreaterThan(expression.Value(0))))
+//	err := TransactWrite(ctx, d.Svc, tx)
+//
+// Puts and Updates of Tables with a VersionAttributeName check and increment the
+// item's version as CreateItem and UpdateItemWith do.
+type WriteTx struct {
+	items []*dynamodb.TransactWriteItem
+	ops   []txOp
+	token string
+	err   error
+}
+
+// txOp describes one operation of a transaction for error reporting.
+type txOp struct {
+	op      string
+	table   *Table
+	version *int64
+}
+
+// NewWriteTx returns an empty WriteTx.
+func NewWriteTx() *WriteTx {
+	return &WriteTx{}
+}
+
+// Put puts item in table t, if c is met when c is not nil.
+func (tx *WriteTx) Put(t *Table, item interface{}, c *Condition) *WriteTx {
+	input, version, err := putInput(t, item, c)
+	if err != nil {
+		return tx.fail("Put", t, err)
+	}
+	return tx.add(txOp{op: "Put", table: t, version: version}, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		ConditionExpression:                 input.ConditionExpression,
+		ExpressionAttributeNames:            input.ExpressionAttributeNames,
+		ExpressionAttributeValues:           input.ExpressionAttributeValues,
+		Item:                                input.Item,
+		ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+		TableName:                           input.TableName,
+	}})
+}
+
+// Update applies the actions of u to the item of table t with the key values in q,
+// if the Condition set with u.If is met. u's Return setting is ignored.
+func (tx *WriteTx) Update(t *Table, q *Query, u *Update) *WriteTx {
+	input, err := updateInput(t, keyMaker(q, t), u)
+	if err != nil {
+		return tx.fail("Update", t, err)
+	}
+	return tx.add(txOp{op: "Update", table: t, version: u.version}, &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+		ConditionExpression:                 input.ConditionExpression,
+		ExpressionAttributeNames:            input.ExpressionAttributeNames,
+		ExpressionAttributeValues:           input.ExpressionAttributeValues,
+		Key:                                 input.Key,
+		ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+		TableName:                           input.TableName,
+		UpdateExpression:                    input.UpdateExpression,
+	}})
+}
+
+// Delete deletes the item of table t with the key values in q, if c is met when
+// c is not nil.
+func (tx *WriteTx) Delete(t *Table, q *Query, c *Condition) *WriteTx {
+	input, err := deleteInput(t, keyMaker(q, t), c)
+	if err != nil {
+		return tx.fail("Delete", t, err)
+	}
+	return tx.add(txOp{op: "Delete", table: t}, &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+		ConditionExpression:                 input.ConditionExpression,
+		ExpressionAttributeNames:            input.ExpressionAttributeNames,
+		ExpressionAttributeValues:           input.ExpressionAttributeValues,
+		Key:                                 input.Key,
+		ReturnValuesOnConditionCheckFailure: input.ReturnValuesOnConditionCheckFailure,
+		TableName:                           input.TableName,
+	}})
+}
+
+// Check requires the item of table t with the key values in q to meet c,
+// without writing it. The transaction is canceled if c is not met.
+func (tx *WriteTx) Check(t *Table, q *Query, c *Condition) *WriteTx {
+	if c == nil {
+		return tx.fail("ConditionCheck", t, fmt.Errorf("no condition"))
+	}
+	expr, err := expression.NewBuilder().WithCondition(c.Expr).Build()
+	if err != nil {
+		return tx.fail("ConditionCheck", t, err)
+	}
+	return tx.add(txOp{op: "ConditionCheck", table: t}, &dynamodb.TransactWriteItem{ConditionCheck: &dynamodb.ConditionCheck{
+		ConditionExpression:                 expr.Condition(),
+		ExpressionAttributeNames:            expr.Names(),
+		ExpressionAttributeValues:           expr.Values(),
+		Key:                                 keyMaker(q, t),
+		ReturnValuesOnConditionCheckFailure: c.returnValues(),
+		TableName:                           aws.String(t.TableName),
+	}})
+}
+
+// Token sets the client request token of the transaction. Calls with the same
+// token within 10 minutes of each other are applied only once, so a transaction
+// that failed with an unknown outcome can be retried safely. If no token is set,
+// the SDK generates one for each call, and TransactWrite only retries the
+// transaction if DynamoDB rejected it before applying it, such as when throttled.
+func (tx *WriteTx) Token(token string) *WriteTx {
+	tx.token = token
+	return tx
+}
+
+// Len returns the number of operations in tx.
+func (tx *WriteTx) Len() int {
+	return len(tx.items)
+}
+
+func (tx *WriteTx) add(op txOp, item *dynamodb.TransactWriteItem) *WriteTx {
+	tx.ops = append(tx.ops, op)
+	tx.items = append(tx.items, item)
+	return tx
+}
+
+// fail records the first error building an operation, which is returned by TransactWrite.
+func (tx *WriteTx) fail(op string, t *Table, err error) *WriteTx {
+	if tx.err == nil {
+		tx.err = opErr("TransactWriteItems", t.TableName, fmt.Errorf("%s %d: %w", op, len(tx.items), err))
+	}
+	return tx
+}
+
+// TransactWrite applies the operations of tx in a single TransactWriteItems call.
+// Returns an error matching ErrTooManyItems if tx holds more than 100 operations.
+// If the transaction is canceled, a *TxError matching ErrTransactionCanceled is
+// returned with the reason each operation failed, if any; for example an
+// operation whose condition was not met has a *ConditionError.
+func TransactWrite(ctx context.Context, svc dynamodbiface.DynamoDBAPI, tx *WriteTx) error {
+	if tx.err != nil {
+		return tx.err
+	}
+	if len(tx.items) == 0 {
+		return opErr("TransactWriteItems", "", fmt.Errorf("no operations"))
+	}
+	if len(tx.items) > maxTxItems {
+		return opErr("TransactWriteItems", "", fmt.Errorf("%w: %d operations, max %d", ErrTooManyItems, len(tx.items), maxTxItems))
+	}
+	input := &dynamodb.TransactWriteItemsInput{TransactItems: tx.items}
+	if tx.token != "" {
+		input.ClientRequestToken = aws.String(tx.token)
+	}
+
+	p := &txRetryPolicy{RetryPolicy: DefaultRetryPolicy, idempotent: tx.token != ""}
+	err := withRetry(ctx, p, "TransactWriteItems", "", func() error {
+		_, err := svc.TransactWriteItemsWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("TransactWriteItems", "", err)
+		return txErr(ctx, "TransactWriteItems", tx.ops, err)
+	}
+
+	logger().Debug("wrote transaction", slog.String("op", "TransactWriteItems"), slog.Int("items", len(tx.items)))
+	return nil
+}
+
+// GetTx holds the reads of a TransactGetItems call, which returns the items
+// as of a single point in time. GetTxs are created with NewGetTx, and Get
+// returns the GetTx so calls can be chained:
+//
+//	tx := NewGetTx().Get(d.Tables["orders"], q1, &order).Get(d.Tables["stock"], q2, &stock)
+//	found, err := TransactGet(ctx, d.Svc, tx)
+type GetTx struct {
+	items []*dynamodb.TransactGetItem
+	ops   []txOp
+	outs  []interface{}
+}
+
+// NewGetTx returns an empty GetTx.
+func NewGetTx() *GetTx {
+	return &GetTx{}
+}
+
+// Get reads the item of table t with the key values in q into out, which must
+// be a non-nil pointer.
+func (tx *GetTx) Get(t *Table, q *Query, out interface{}) *GetTx {
+	tx.items = append(tx.items, &dynamodb.TransactGetItem{Get: &dynamodb.Get{
+		Key:       keyMaker(q, t),
+		TableName: aws.String(t.TableName),
+	}})
+	tx.ops = append(tx.ops, txOp{op: "Get", table: t})
+	tx.outs = append(tx.outs, out)
+	return tx
+}
+
+// Len returns the number of reads in tx.
+func (tx *GetTx) Len() int {
+	return len(tx.items)
+}
+
+// TransactGet reads the items of tx in a single TransactGetItems call and
+// unmarshals each into the out value given to Get. It reports, in the order of
+// the reads, whether each item was found; the out values of missing items are
+// left unchanged. Returns an error matching ErrTooManyItems if tx holds more
+// than 100 reads, and a *TxError if the transaction is canceled.
+func TransactGet(ctx context.Context, svc dynamodbiface.DynamoDBAPI, tx *GetTx) ([]bool, error) {
+	if len(tx.items) == 0 {
+		return nil, opErr("TransactGetItems", "", fmt.Errorf("no operations"))
+	}
+	if len(tx.items) > maxTxItems {
+		return nil, opErr("TransactGetItems", "", fmt.Errorf("%w: %d operations, max %d", ErrTooManyItems, len(tx.items), maxTxItems))
+	}
+
+	input := &dynamodb.TransactGetItemsInput{TransactItems: tx.items}
+	var result *dynamodb.TransactGetItemsOutput
+	err := withRetry(ctx, &txRetryPolicy{RetryPolicy: DefaultRetryPolicy, idempotent: true}, "TransactGetItems", "", func() (err error) {
+		result, err = svc.TransactGetItemsWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("TransactGetItems", "", err)
+		return nil, txErr(ctx, "TransactGetItems", tx.ops, err)
+	}
+
+	found := make([]bool, len(tx.items))
+	for i, r := range result.Responses {
+		if i >= len(found) || r == nil || r.Item == nil {
+			continue
+		}
+		if err := dynamodbattribute.UnmarshalMap(r.Item, tx.outs[i]); err != nil {
+			table := tx.ops[i].table.TableName
+			logErr("TransactGetItems", table, err)
+			return nil, opErr("TransactGetItems", table, fmt.Errorf("failed to unmarshal record: %w", err))
+		}
+		found[i] = true
+	}
+
+	logger().Debug("read transaction", slog.String("op", "TransactGetItems"), slog.Int("items", len(tx.items)))
+	return found, nil
+}
+
+// txRetryPolicy is the RetryPolicy of transactions. A canceled transaction is
+// retried only if every operation that caused the cancellation was throttled.
+// Other errors are retried as decided by RetryPolicy, unless the transaction is
+// not idempotent, in which case only throttled requests, which DynamoDB rejected
+// without applying them, are retried.
+type txRetryPolicy struct {
+	RetryPolicy
+	idempotent bool
+}
+
+func (p *txRetryPolicy) Retryable(err error) bool {
+	var tce *dynamodb.TransactionCanceledException
+	if errors.As(err, &tce) {
+		throttled := false
+		for _, r := range tce.CancellationReasons {
+			switch aws.StringValue(r.Code) {
+			case "", txReasonNone:
+			case txReasonThrottling, txReasonThroughputExceeded:
+				throttled = true
+			default:
+				return false
+			}
+		}
+		return throttled
+	}
+	if !p.idempotent {
+		return onceRetryPolicy{p.RetryPolicy}.Retryable(err)
+	}
+	return p.RetryPolicy.Retryable(err)
+}
+
+// TxError is returned when DynamoDB cancels a transaction.
+// It matches ErrTransactionCanceled, and any error in Errs.
+type TxError struct {
+	Op string
+	// Errs holds one entry per operation of the transaction, in order: nil if
+	// the operation did not cause the cancellation, else the reason it did.
+	// Operations whose condition was not met have a *ConditionError, which
+	// holds the stored item if the Condition set ReturnItem.
+	Errs []error
+	Err  error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error, ErrTransactionCanceled and the non-nil
+// errors of Errs.
+func (e *TxError) Unwrap() []error {
+	errs := unwrap(e.Err)
+	for _, err := range e.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// txErr returns the error for a failed transaction of ops: a *TxError if it was
+// canceled, else the same as ctxOpErr.
+func txErr(ctx context.Context, op string, ops []txOp, err error) error {
+	var tce *dynamodb.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		return ctxOpErr(ctx, op, "", err)
+	}
+	te := &TxError{Op: op, Errs: make([]error, len(ops)), Err: safeErr(err)}
+	for i, r := range tce.CancellationReasons {
+		code := aws.StringValue(r.Code)
+		if i >= len(ops) || code == "" || code == txReasonNone {
+			continue
+		}
+		o := ops[i]
+		rerr := awserr.New(code, strings.TrimSpace(aws.StringValue(r.Message)), nil)
+		if code != txReasonConditionalCheckFailed {
+			te.Errs[i] = opErr(o.op, o.table.TableName, rerr)
+			continue
+		}
+		ce := &ConditionError{Op: o.op, Table: o.table.TableName, Item: r.Item, Err: rerr}
+		te.Errs[i] = ce
+		if o.version != nil {
+			versionErr(o.table, ce, *o.version)
+		}
+	}
+	return te
+}
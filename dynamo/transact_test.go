@@ -0,0 +1,156 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+
+	"github.com/go-dynamo/go-dynamo/dynamo/dynamotest"
+)
+
+func canceled(codes ...string) error {
+	tce := &dynamodb.TransactionCanceledException{Message_: aws.String("Transaction cancelled")}
+	for _, c := range codes {
+		tce.CancellationReasons = append(tce.CancellationReasons, &dynamodb.CancellationReason{Code: aws.String(c)})
+	}
+	return tce
+}
+
+func TestTransactWriteRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		err   error
+		calls int // TransactWriteItems calls made
+	}{
+		{"throttled", "", dynamotest.NewError(dynamodb.ErrCodeRequestLimitExceeded, "slow down"), 2},
+		{"server error", "", dynamotest.NewError(dynamodb.ErrCodeInternalServerError, "oops"), 1},
+		{"server error with token", "tok", dynamotest.NewError(dynamodb.ErrCodeInternalServerError, "oops"), 2},
+		{"canceled by throttling", "", canceled(txReasonNone, txReasonThrottling), 2},
+		{"canceled by condition", "tok", canceled(txReasonThrottling, txReasonConditionalCheckFailed), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newTestTable(t)
+			f.InjectFault(dynamotest.Fault{Op: "TransactWriteItems", Err: tt.err})
+			tx := NewWriteTx().Put(tb, thing{ID: "a", Sort: 1}, nil).Put(tb, thing{ID: "b", Sort: 1}, nil)
+			if tt.token != "" {
+				tx.Token(tt.token)
+			}
+			err := TransactWrite(context.Background(), f, tx)
+			if got := f.Calls("TransactWriteItems"); got != tt.calls {
+				t.Errorf("got %d calls, want %d", got, tt.calls)
+			}
+			if (err == nil) != (tt.calls == 2) {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestTransactGet(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	for _, th := range []thing{{ID: "a", Sort: 1, Title: "first"}, {ID: "b", Sort: 2, Title: "second"}} {
+		if err := CreateItem(f, th, tb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var a, missing, b thing
+	missing.Title = "unchanged"
+	tx := NewGetTx().
+		Get(tb, CreateNewQueryObj("a", 1), &a).
+		Get(tb, CreateNewQueryObj("a", 2), &missing).
+		Get(tb, CreateNewQueryObj("b", 2), &b)
+	found, err := TransactGet(ctx, f, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{true, false, true}; !slices.Equal(found, want) {
+		t.Errorf("got found %v, want %v", found, want)
+	}
+	if a.Title != "first" || b.Title != "second" || missing.Title != "unchanged" {
+		t.Errorf("got %+v, %+v, %+v", a, missing, b)
+	}
+
+	if _, err := TransactGet(ctx, f, NewGetTx()); err == nil {
+		t.Error("empty transaction: got no error")
+	}
+}
+
+func TestTransactWriteReasons(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	if err := CreateItem(f, thing{ID: "a", Sort: 1, Title: "first"}, tb); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewWriteTx().
+		Put(tb, thing{ID: "b", Sort: 1}, nil).
+		Check(tb, CreateNewQueryObj("a", 1), If(expression.Name("Title").Equal(expression.Value("other")))).
+		Delete(tb, CreateNewQueryObj("c", 1), IfExists(tb))
+	err := TransactWrite(ctx, f, tx)
+	if !errors.Is(err, ErrTransactionCanceled) || !errors.Is(err, ErrConditionFailed) {
+		t.Fatalf("got %v, want ErrTransactionCanceled and ErrConditionFailed", err)
+	}
+	var te *TxError
+	if !errors.As(err, &te) || len(te.Errs) != 3 {
+		t.Fatalf("got %v, want a *TxError with 3 reasons", err)
+	}
+	if te.Errs[0] != nil {
+		t.Errorf("put: got reason %v, want nil", te.Errs[0])
+	}
+	for i, op := range []string{"ConditionCheck", "Delete"} {
+		var ce *ConditionError
+		if !errors.As(te.Errs[i+1], &ce) || ce.Op != op || ce.Table != "things" {
+			t.Errorf("%s: got reason %v, want a *ConditionError", op, te.Errs[i+1])
+		}
+	}
+	if n := len(f.Items("things")); n != 1 {
+		t.Errorf("got %d items after the canceled transaction, want 1", n)
+	}
+
+	// reasons other than a failed condition
+	f.InjectFault(dynamotest.Fault{Op: "TransactWriteItems", Err: canceled(txReasonNone, txReasonTransactionConflict)})
+	tx = NewWriteTx().Put(tb, thing{ID: "b", Sort: 1}, nil).Put(tb, thing{ID: "c", Sort: 1}, nil)
+	err = TransactWrite(ctx, f, tx)
+	if !errors.As(err, &te) || te.Errs[0] != nil || !errors.Is(te.Errs[1], ErrTransactionConflict) {
+		t.Fatalf("got %v, want a *TxError with a conflict for the second put", err)
+	}
+	var ce *ConditionError
+	if errors.As(te.Errs[1], &ce) || errors.Is(err, ErrConditionFailed) {
+		t.Errorf("got %v, want no condition failure", err)
+	}
+}
+
+func TestTransactWriteToken(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	q := CreateNewQueryObj("a", 1)
+	counter := func(token string) *WriteTx {
+		return NewWriteTx().Update(tb, q, NewUpdate().Add("Count", 1)).Token(token)
+	}
+
+	// a call repeated with the same token, as after an unknown outcome, is applied once
+	for i := 0; i < 2; i++ {
+		if err := TransactWrite(ctx, f, counter("tok")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := TransactWrite(ctx, f, counter("other")); err != nil {
+		t.Fatal(err)
+	}
+	var got struct{ Count int }
+	if _, err := GetItem(f, q, tb, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 2 {
+		t.Errorf("got Count %d, want 2", got.Count)
+	}
+}
@@ -0,0 +1,322 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the Update builder and the expression-based UpdateItem operation.
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// Update holds the actions of an update expression.
+// Paths are attribute names, or document paths such as "Address.City" or
+// "Tags[0]"; reserved words are escaped automatically. Values are marshaled
+// with dynamodbattribute, or used directly if they are *dynamodb.AttributeValue.
+// Updates are created with NewUpdate, and each method returns the Update so
+// calls can be chained:
+//
+//	u := NewUpdate().Set("Title", "Dune").Add("Views", 1).Remove("Draft")
+type Update struct {
+	ops          []updateOp
+	once         bool // applying the update twice differs from applying it once
+	returnValues string
+	cond         *Condition
+	version      *int64
+}
+
+// updateOp is one action of an Update on the attribute at path.
+// Actions are applied to a new UpdateBuilder each time the Update is used,
+// as UpdateBuilders share their state when copied.
+type updateOp struct {
+	path  string
+	set   interface{} // the value of a Set, else nil
+	apply func(expression.UpdateBuilder) expression.UpdateBuilder
+}
+
+// NewUpdate returns an empty Update.
+func NewUpdate() *Update {
+	return &Update{}
+}
+
+// Set sets the attribute at path to v.
+func (u *Update) Set(path string, v interface{}) *Update {
+	u.set(path, expression.Value(v))
+	u.ops[len(u.ops)-1].set = v
+	return u
+}
+
+// SetIfNotExists sets the attribute at path to v unless it already exists.
+func (u *Update) SetIfNotExists(path string, v interface{}) *Update {
+	return u.set(path, expression.IfNotExists(expression.Name(path), expression.Value(v)))
+}
+
+// Append appends the elements of the list vs to the list at path, which is
+// created if it does not exist.
+func (u *Update) Append(path string, vs interface{}) *Update {
+	u.once = true
+	return u.set(path, expression.ListAppend(emptyListIfNotExists(path), expression.Value(vs)))
+}
+
+// Prepend inserts the elements of the list vs at the start of the list at path,
+// which is created if it does not exist.
+func (u *Update) Prepend(path string, vs interface{}) *Update {
+	u.once = true
+	return u.set(path, expression.ListAppend(expression.Value(vs), emptyListIfNotExists(path)))
+}
+
+// Remove removes the attribute at path, or the list element if path ends in an index.
+func (u *Update) Remove(path string) *Update {
+	return u.op(path, func(b expression.UpdateBuilder) expression.UpdateBuilder {
+		return b.Remove(expression.Name(path))
+	})
+}
+
+// Add adds the number v to the Number at path, or the elements of the set v to
+// the set at path. A missing attribute is treated as 0 or the empty set, so Add
+// can be used for atomic counters. A slice of strings, numbers or []byte is
+// sent as a set.
+func (u *Update) Add(path string, v interface{}) *Update {
+	u.once = true
+	v = setValue(v)
+	return u.op(path, func(b expression.UpdateBuilder) expression.UpdateBuilder {
+		return b.Add(expression.Name(path), expression.Value(v))
+	})
+}
+
+// Delete removes the elements of the set v from the set at path. A slice of
+// strings, numbers or []byte is sent as a set.
+func (u *Update) Delete(path string, v interface{}) *Update {
+	v = setValue(v)
+	return u.op(path, func(b expression.UpdateBuilder) expression.UpdateBuilder {
+		return b.Delete(expression.Name(path), expression.Value(v))
+	})
+}
+
+// Return selects the item attributes returned by UpdateItemWith:
+// "ALL_OLD", "UPDATED_OLD", "ALL_NEW" or "UPDATED_NEW".
+// By default no attributes are returned.
+func (u *Update) Return(returnValues string) *Update {
+	u.returnValues = returnValues
+	return u
+}
+
+// If makes the update conditional on c. UpdateItemWith then returns a
+// *ConditionError matching ErrConditionFailed if c is not met.
+func (u *Update) If(c *Condition) *Update {
+	u.cond = c
+	return u
+}
+
+// IfVersion makes the update conditional on the stored item's version, held in
+// the Table's VersionAttributeName, being expected; 0 matches items without a
+// version. UpdateItemWith then returns an error matching ErrVersionConflict if
+// the stored version differs.
+func (u *Update) IfVersion(expected int64) *Update {
+	u.version = &expected
+	return u
+}
+
+func (u *Update) set(path string, op expression.OperandBuilder) *Update {
+	return u.op(path, func(b expression.UpdateBuilder) expression.UpdateBuilder {
+		return b.Set(expression.Name(path), op)
+	})
+}
+
+func (u *Update) op(path string, apply func(expression.UpdateBuilder) expression.UpdateBuilder) *Update {
+	u.ops = append(u.ops, updateOp{path: path, apply: apply})
+	return u
+}
+
+// setValue returns v as a String, Number or Binary set if it is a non-empty slice
+// of strings, numbers or []byte, which dynamodbattribute marshals as a List.
+// Other values are returned unchanged.
+func setValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return v
+	}
+	av, err := dynamodbattribute.Marshal(v)
+	if err != nil || len(av.L) == 0 {
+		return v
+	}
+	set := &dynamodb.AttributeValue{}
+	for _, e := range av.L {
+		switch {
+		case e.S != nil && set.NS == nil && set.BS == nil:
+			set.SS = append(set.SS, e.S)
+		case e.N != nil && set.SS == nil && set.BS == nil:
+			set.NS = append(set.NS, e.N)
+		case e.B != nil && set.SS == nil && set.NS == nil:
+			set.BS = append(set.BS, e.B)
+		default:
+			return v
+		}
+	}
+	return set
+}
+
+// emptyListIfNotExists returns the list at path, or an empty list if it does not exist.
+func emptyListIfNotExists(path string) expression.SetValueBuilder {
+	empty := (&dynamodb.AttributeValue{}).SetL([]*dynamodb.AttributeValue{})
+	return expression.IfNotExists(expression.Name(path), expression.Value(empty))
+}
+
+// UpdateItemWith applies the actions of u to the item of table t with the key
+// values in q; q's UpdateFieldName and UpdateValue are ignored. The item is created
+// if it does not exist unless u has a Condition set with If. If u selects return values with Return and out is a non-nil
+// pointer, the returned attributes are unmarshaled into out.
+// If t has a VersionAttributeName, the item's version is incremented. If u sets the
+// version attribute to the item's version, or uses IfVersion, the stored version
+// must match, else an error matching ErrVersionConflict is returned; without
+// either, the version is incremented whatever it is.
+//
+// ex: err := UpdateItemWith(ctx, svc, t, CreateNewQueryObj(2015, "Dune"), NewUpdate().Add("Views", 1).Return("UPDATED_NEW"), &movie)
+func UpdateItemWith(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, q *Query, u *Update, out interface{}) error {
+	input, err := updateInput(t, keyMaker(q, t), u)
+	if err != nil {
+		return opErr("UpdateItem", t.TableName, err)
+	}
+
+	var result *dynamodb.UpdateItemOutput
+	err = withRetry(ctx, updateRetryPolicy(DefaultRetryPolicy, t, u), "UpdateItem", t.TableName, func() (err error) {
+		result, err = svc.UpdateItemWithContext(ctx, input)
+		return err
+	})
+	if err != nil {
+		logErr("UpdateItem", t.TableName, err)
+		err = writeErr(ctx, "UpdateItem", t.TableName, err)
+		if v := u.expectedVersion(t); v != nil {
+			return versionErr(t, err, *v)
+		}
+		return err
+	}
+	if out != nil && len(result.Attributes) > 0 {
+		if err := dynamodbattribute.UnmarshalMap(result.Attributes, out); err != nil {
+			logErr("UpdateItem", t.TableName, err)
+			return opErr("UpdateItem", t.TableName, fmt.Errorf("failed to unmarshal record: %w", err))
+		}
+	}
+
+	logger().Debug("updated item", slog.String("op", "UpdateItem"), slog.String("table", t.TableName),
+		slog.Int("actions", len(u.ops)))
+	return nil
+}
+
+// carriedVersion returns the version u sets the version attribute of t to,
+// which is the item's version, or nil if u does not Set it to a Number or uses IfVersion.
+func (u *Update) carriedVersion(t *Table) *int64 {
+	if t.VersionAttributeName == "" || u.version != nil {
+		return nil
+	}
+	for _, op := range u.ops {
+		if op.path != t.VersionAttributeName || op.set == nil {
+			continue
+		}
+		av, ok := op.set.(*dynamodb.AttributeValue)
+		if !ok {
+			var err error
+			if av, err = dynamodbattribute.Marshal(op.set); err != nil {
+				return nil
+			}
+		}
+		v, err := itemVersion(t, map[string]*dynamodb.AttributeValue{t.VersionAttributeName: av})
+		if err != nil {
+			return nil
+		}
+		return &v
+	}
+	return nil
+}
+
+// expectedVersion returns the version the stored item must have for u to be
+// applied to it: the one given to IfVersion, else the one u carries, if any.
+func (u *Update) expectedVersion(t *Table) *int64 {
+	if u.version != nil {
+		return u.version
+	}
+	return u.carriedVersion(t)
+}
+
+// bumpsVersion reports whether applying u to an item of t increments its version:
+// t has a version attribute and u carries the item's version or does not set it.
+func (u *Update) bumpsVersion(t *Table) bool {
+	if t.VersionAttributeName == "" {
+		return false
+	}
+	if u.carriedVersion(t) != nil {
+		return true
+	}
+	for _, op := range u.ops {
+		if op.path == t.VersionAttributeName {
+			return false
+		}
+	}
+	return true
+}
+
+// updateRetryPolicy returns the RetryPolicy of applying u to an item of t: p, or
+// if applying u twice differs from applying it once, p retrying only throttled requests.
+func updateRetryPolicy(p RetryPolicy, t *Table, u *Update) RetryPolicy {
+	if u.once || u.bumpsVersion(t) {
+		return onceRetryPolicy{p}
+	}
+	return p
+}
+
+// updateInput builds the UpdateItemInput applying u to the item with the given key.
+func updateInput(t *Table, key map[string]*dynamodb.AttributeValue, u *Update) (*dynamodb.UpdateItemInput, error) {
+	if u == nil || len(u.ops) == 0 && t.VersionAttributeName == "" {
+		return nil, fmt.Errorf("no attributes to update")
+	}
+	if u.version != nil && t.VersionAttributeName == "" {
+		return nil, fmt.Errorf("table %s has no version attribute", t.TableName)
+	}
+	// a carried version is checked and incremented instead of set
+	carried := u.carriedVersion(t)
+	var ub expression.UpdateBuilder
+	for _, op := range u.ops {
+		if carried != nil && op.path == t.VersionAttributeName {
+			continue
+		}
+		ub = op.apply(ub)
+	}
+	if u.bumpsVersion(t) {
+		ub = ub.Add(expression.Name(t.VersionAttributeName), expression.Value(1))
+	}
+
+	b := expression.NewBuilder().WithUpdate(ub)
+	expected := u.expectedVersion(t)
+	cond, ok := writeCondition(t, u.cond, expected)
+	if ok {
+		b = b.WithCondition(cond)
+	}
+	expr, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression:                 expr.Condition(),
+		ExpressionAttributeNames:            expr.Names(),
+		ExpressionAttributeValues:           expr.Values(),
+		Key:                                 key,
+		ReturnValuesOnConditionCheckFailure: u.cond.returnValues(),
+		TableName:                           aws.String(t.TableName),
+		UpdateExpression:                    expr.Update(),
+	}
+	if expected != nil {
+		input.ReturnValuesOnConditionCheckFailure = aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld)
+	}
+	if u.returnValues != "" {
+		input.ReturnValues = aws.String(u.returnValues)
+	}
+	return input, nil
+}
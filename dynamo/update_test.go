@@ -0,0 +1,141 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type doc struct {
+	ID      string
+	Sort    int
+	Title   string
+	Views   int
+	Created int               `dynamodbav:",omitempty"`
+	Draft   bool              `dynamodbav:",omitempty"`
+	Tags    []string          `dynamodbav:",stringset,omitempty"`
+	List    []int             `dynamodbav:",omitempty"`
+	More    []int             `dynamodbav:",omitempty"`
+	Info    map[string]string `dynamodbav:",omitempty"`
+}
+
+// updateString returns the UpdateExpression of input with attribute names in
+// place of their placeholders.
+func updateString(input *dynamodb.UpdateItemInput) string {
+	var placeholders []string
+	for p := range input.ExpressionAttributeNames {
+		placeholders = append(placeholders, p)
+	}
+	// longest first, so that #1 does not replace the start of #10
+	sort.Slice(placeholders, func(i, j int) bool { return len(placeholders[i]) > len(placeholders[j]) })
+	s := aws.StringValue(input.UpdateExpression)
+	for _, p := range placeholders {
+		s = strings.ReplaceAll(s, p, aws.StringValue(input.ExpressionAttributeNames[p]))
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func TestUpdateItemWith(t *testing.T) {
+	ctx := context.Background()
+	stored := func() doc {
+		return doc{ID: "a", Sort: 1, Title: "old", Views: 2, Draft: true,
+			Tags: []string{"x", "y"}, List: []int{1, 2}, Info: map[string]string{"City": "Rome"}}
+	}
+	tests := []struct {
+		name   string
+		u      *Update
+		expr   string
+		change func(d *doc)
+	}{
+		{"set", NewUpdate().Set("Title", "new"), "SET Title = :0",
+			func(d *doc) { d.Title = "new" }},
+		{"set nested", NewUpdate().Set("Info.City", "Paris"), "SET Info.City = :0",
+			func(d *doc) { d.Info["City"] = "Paris" }},
+		{"set if not exists", NewUpdate().SetIfNotExists("Title", "new").SetIfNotExists("Created", 5),
+			"SET Title = if_not_exists(Title, :0), Created = if_not_exists(Created, :1)",
+			func(d *doc) { d.Created = 5 }},
+		{"add number", NewUpdate().Add("Views", 3).Add("Created", 1), "ADD Views :0, Created :1",
+			func(d *doc) { d.Views, d.Created = 5, 1 }},
+		{"add set", NewUpdate().Add("Tags", []string{"z", "x"}), "ADD Tags :0",
+			func(d *doc) { d.Tags = []string{"x", "y", "z"} }},
+		{"delete set", NewUpdate().Delete("Tags", []string{"x", "w"}), "DELETE Tags :0",
+			func(d *doc) { d.Tags = []string{"y"} }},
+		{"remove", NewUpdate().Remove("Draft").Remove("List[0]"), "REMOVE Draft, List[0]",
+			func(d *doc) { d.Draft, d.List = false, []int{2} }},
+		{"append", NewUpdate().Append("List", []int{3, 4}), "SET List = list_append(if_not_exists(List, :0), :1)",
+			func(d *doc) { d.List = []int{1, 2, 3, 4} }},
+		{"prepend", NewUpdate().Prepend("List", []int{0}), "SET List = list_append(:0, if_not_exists(List, :1))",
+			func(d *doc) { d.List = []int{0, 1, 2} }},
+		{"append to missing list", NewUpdate().Append("More", []int{7}), "SET More = list_append(if_not_exists(More, :0), :1)",
+			func(d *doc) { d.More = []int{7} }},
+		{"combined", NewUpdate().Set("Title", "new").Add("Views", 1).Remove("Draft").Delete("Tags", []string{"y"}),
+			"ADD Views :0 DELETE Tags :1 REMOVE Draft SET Title = :2",
+			func(d *doc) { d.Title, d.Views, d.Draft, d.Tags = "new", 3, false, []string{"x"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, tb := newTestTable(t)
+			if err := CreateItem(f, stored(), tb); err != nil {
+				t.Fatal(err)
+			}
+			q := CreateNewQueryObj("a", 1)
+			input, err := updateInput(tb, keyMaker(q, tb), tt.u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := updateString(input); got != tt.expr {
+				t.Errorf("got expression %q, want %q", got, tt.expr)
+			}
+
+			if err := UpdateItemWith(ctx, f, tb, q, tt.u, nil); err != nil {
+				t.Fatal(err)
+			}
+			var got doc
+			if _, err := GetItem(f, q, tb, &got); err != nil {
+				t.Fatal(err)
+			}
+			want := stored()
+			tt.change(&want)
+			slices.Sort(got.Tags)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateItemWithReturn(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	q := CreateNewQueryObj("a", 1)
+
+	// a missing item is created
+	var got doc
+	if err := UpdateItemWith(ctx, f, tb, q, NewUpdate().Add("Views", 1).Return("ALL_NEW"), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (doc{ID: "a", Sort: 1, Views: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ALL_NEW: got %+v, want %+v", got, want)
+	}
+	var old struct{ Views int }
+	if err := UpdateItemWith(ctx, f, tb, q, NewUpdate().Add("Views", 1).Return("UPDATED_OLD"), &old); err != nil {
+		t.Fatal(err)
+	}
+	if old.Views != 1 {
+		t.Errorf("UPDATED_OLD: got Views %d, want 1", old.Views)
+	}
+
+	if err := UpdateItemWith(ctx, f, tb, q, NewUpdate(), nil); err == nil {
+		t.Error("empty update: got no error")
+	}
+	if err := UpdateItemWith(ctx, f, tb, CreateNewQueryObj("b", 1), NewUpdate().Set("Title", "x").If(IfExists(tb)), nil); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("conditional update of a missing item: got %v, want ErrConditionFailed", err)
+	}
+}
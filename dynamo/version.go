@@ -0,0 +1,81 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains the optimistic locking helpers used by versioned writes.
+package dynamo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// itemVersion returns the version held in the version attribute of the marshaled
+// item av, or 0 if it has none.
+func itemVersion(t *Table, av map[string]*dynamodb.AttributeValue) (int64, error) {
+	v, ok := av[t.VersionAttributeName]
+	if !ok || v.NULL != nil {
+		return 0, nil
+	}
+	if v.N == nil {
+		return 0, fmt.Errorf("version attribute %q is not a Number", t.VersionAttributeName)
+	}
+	return strconv.ParseInt(*v.N, 10, 64)
+}
+
+// versionCondition returns the condition that the stored item's version is expected.
+// An expected version of 0 also matches items without a version, including new items.
+func versionCondition(t *Table, expected int64) expression.ConditionBuilder {
+	name := expression.Name(t.VersionAttributeName)
+	if expected == 0 {
+		return expression.AttributeNotExists(name).Or(name.Equal(expression.Value(0)))
+	}
+	return name.Equal(expression.Value(expected))
+}
+
+// setItemVersion sets the version field of item, which is the field of the
+// attribute named by t's VersionAttributeName, to v. It does nothing unless item
+// is a non-nil pointer to a struct with a numeric version field.
+func setItemVersion(t *Table, item interface{}, v int64) {
+	rv := reflect.ValueOf(item)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return
+	}
+	f, ok := attrFields(rv.Elem().Type())[t.VersionAttributeName]
+	if !ok {
+		return
+	}
+	fv, err := rv.Elem().FieldByIndexErr(f.Index)
+	if err != nil {
+		return // through a nil embedded pointer
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fv.SetUint(uint64(v))
+	case reflect.Float32, reflect.Float64:
+		fv.SetFloat(float64(v))
+	}
+}
+
+// versionErr marks err as a version conflict if it is a *ConditionError and the
+// stored item it holds does not have the expected version.
+func versionErr(t *Table, err error, expected int64) error {
+	var ce *ConditionError
+	if errors.As(err, &ce) {
+		v, verr := itemVersion(t, ce.Item)
+		ce.conflict = verr != nil || v != expected
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type versioned struct {
+	ID    string
+	Sort  int
+	Ver   int64
+	Title string
+}
+
+func TestVersionWrittenBack(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	tb.VersionAttributeName = "Ver"
+
+	item := &versioned{ID: "a", Sort: 1}
+	for want := int64(1); want <= 2; want++ {
+		if err := CreateItem(f, item, tb); err != nil {
+			t.Fatal(err)
+		}
+		if item.Ver != want {
+			t.Errorf("CreateItem: got Ver %d, want %d", item.Ver, want)
+		}
+	}
+
+	r, err := NewRepository[versioned](f, tb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Get(ctx, "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(ctx, &got); err != nil || got.Ver != 3 {
+		t.Errorf("Repository.Put: got Ver %d (%v), want 3", got.Ver, err)
+	}
+	stale := got
+	stale.Ver = 1
+	if err := r.Put(ctx, &stale); !errors.Is(err, ErrVersionConflict) || stale.Ver != 1 {
+		t.Errorf("Repository.Put: got %v and Ver %d, want ErrVersionConflict and Ver unchanged", err, stale.Ver)
+	}
+}
+
+func TestUpdateCarriedVersion(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	tb.VersionAttributeName = "Ver"
+	if err := CreateItem(f, &versioned{ID: "a", Sort: 1}, tb); err != nil {
+		t.Fatal(err)
+	}
+	q := CreateNewQueryObj("a", 1)
+
+	// the update read the item at version 1
+	if err := UpdateItemWith(ctx, f, tb, q, NewUpdate().Set("Title", "x").Set("Ver", 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateItemWith(ctx, f, tb, q, NewUpdate().Set("Title", "y").Set("Ver", 1), nil); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateItemWith: got %v, want ErrVersionConflict", err)
+	}
+	legacy := CreateNewQueryObj("a", 1)
+	legacy.UpdateCurrent("Ver", 1)
+	if err := UpdateItem(f, legacy, tb); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateItem: got %v, want ErrVersionConflict", err)
+	}
+	// without a version, the update increments whatever is stored
+	if err := UpdateItemWith(ctx, f, tb, q, NewUpdate().Set("Title", "z"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got versioned
+	if _, err := GetItem(f, q, tb, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Ver != 3 || got.Title != "z" {
+		t.Errorf("got %+v, want Ver 3 and Title z", got)
+	}
+}
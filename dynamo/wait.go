@@ -0,0 +1,118 @@
+// Package dynamo contains controls and objects for DynamoDB CRUD operations.
+// Operations in this package are abstracted from all other application logic
+// and are designed to be used with any DynamoDB table and any object schema.
+// This file contains functions for waiting on table status changes.
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DefaultPollInterval is the time between DescribeTable calls while waiting on a
+// table if no poll interval is given.
+const DefaultPollInterval = 5 * time.Second
+
+// CreateTableAndWait creates table t and waits until it and all of its global
+// indexes are ACTIVE. See WaitUntilActive.
+func CreateTableAndWait(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, poll time.Duration) error {
+	if err := CreateTableWithContext(ctx, svc, t); err != nil {
+		return err
+	}
+	return WaitUntilActive(ctx, svc, t, poll)
+}
+
+// DeleteTableAndWait deletes table t and waits until it no longer exists.
+// See WaitUntilDeleted.
+func DeleteTableAndWait(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, poll time.Duration) error {
+	if err := DeleteTableWithContext(ctx, svc, t); err != nil {
+		return err
+	}
+	return WaitUntilDeleted(ctx, svc, t, poll)
+}
+
+// WaitUntilActive calls DescribeTable every poll interval until table t and all of
+// its global indexes are ACTIVE. A poll interval <= 0 uses DefaultPollInterval.
+// The wait is bounded by ctx; if ctx is done first, ctx.Err() is returned.
+// Returns an error if the table is being deleted, archived or has lost access to
+// its encryption key, as it will not become ACTIVE.
+func WaitUntilActive(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, poll time.Duration) error {
+	return waitFor(ctx, svc, t, poll, "WaitUntilActive", func(desc *dynamodb.TableDescription) (bool, error) {
+		if desc == nil { // not visible yet
+			return false, nil
+		}
+		switch status := aws.StringValue(desc.TableStatus); status {
+		case dynamodb.TableStatusActive:
+		case dynamodb.TableStatusCreating, dynamodb.TableStatusUpdating:
+			return false, nil
+		default:
+			return false, fmt.Errorf("table %s is %s", t.TableName, status)
+		}
+		for _, g := range desc.GlobalSecondaryIndexes {
+			if aws.StringValue(g.IndexStatus) != dynamodb.IndexStatusActive {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// WaitUntilDeleted calls DescribeTable every poll interval until table t no longer
+// exists. A poll interval <= 0 uses DefaultPollInterval.
+// The wait is bounded by ctx; if ctx is done first, ctx.Err() is returned.
+func WaitUntilDeleted(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, poll time.Duration) error {
+	return waitFor(ctx, svc, t, poll, "WaitUntilDeleted", func(desc *dynamodb.TableDescription) (bool, error) {
+		return desc == nil, nil
+	})
+}
+
+// waitFor polls DescribeTable for table t until done reports true or an error.
+// done is passed a nil description once the table does not exist.
+func waitFor(ctx context.Context, svc dynamodbiface.DynamoDBAPI, t *Table, poll time.Duration, op string, done func(*dynamodb.TableDescription) (bool, error)) error {
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+	input := &dynamodb.DescribeTableInput{TableName: aws.String(t.TableName)}
+	for attempt := 1; ; attempt++ {
+		var desc *dynamodb.TableDescription
+		var result *dynamodb.DescribeTableOutput
+		err := withRetry(ctx, DefaultRetryPolicy, op, t.TableName, func() (err error) {
+			result, err = svc.DescribeTableWithContext(ctx, input)
+			return err
+		})
+		switch {
+		case err == nil:
+			desc = result.Table
+		case errCode(err) != dynamodb.ErrCodeResourceNotFoundException:
+			logErr(op, t.TableName, err)
+			return ctxOpErr(ctx, op, t.TableName, err)
+		}
+
+		ok, err := done(desc)
+		if err != nil {
+			logErr(op, t.TableName, err)
+			return opErr(op, t.TableName, err)
+		}
+		if ok {
+			logger().Info("table ready", slog.String("op", op), slog.String("table", t.TableName),
+				slog.Int("attempt", attempt))
+			return nil
+		}
+
+		status := "NOT_FOUND"
+		if desc != nil {
+			status = aws.StringValue(desc.TableStatus)
+		}
+		logger().Debug("waiting for table", slog.String("op", op), slog.String("table", t.TableName),
+			slog.Int("attempt", attempt), slog.String("status", status))
+		if err := sleep(ctx, poll); err != nil {
+			return err
+		}
+	}
+}
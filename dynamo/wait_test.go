@@ -0,0 +1,86 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	f, tb := newTestTable(t)
+	f.StatusPolls = 3
+
+	// the table created by newTestTable is already ACTIVE
+	if err := WaitUntilActive(ctx, f, tb, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.Calls("DescribeTable"); n != 1 {
+		t.Errorf("WaitUntilActive: got %d DescribeTable calls, want 1", n)
+	}
+
+	others, _ := NewTable("others", "ID", "string", "", "")
+	before := f.Calls("DescribeTable")
+	if err := CreateTableAndWait(ctx, f, others, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.Calls("DescribeTable") - before; n != 4 {
+		t.Errorf("CreateTableAndWait: got %d DescribeTable calls, want 3 CREATING and 1 ACTIVE", n)
+	}
+
+	before = f.Calls("DescribeTable")
+	if err := DeleteTableAndWait(ctx, f, others, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.Calls("DescribeTable") - before; n != 4 {
+		t.Errorf("DeleteTableAndWait: got %d DescribeTable calls, want 3 DELETING and 1 not found", n)
+	}
+	if err := WaitUntilDeleted(ctx, f, others, time.Millisecond); err != nil {
+		t.Errorf("WaitUntilDeleted of a missing table: %v", err)
+	}
+
+	if err := DeleteTable(f, tb); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitUntilActive(ctx, f, tb, time.Millisecond); err == nil || !strings.Contains(err.Error(), "is DELETING") {
+		t.Errorf("WaitUntilActive of a deleting table: got %v, want an error", err)
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	f, tb := newTestTable(t)
+	f.StatusPolls = 1 << 20
+	if err := DeleteTable(f, tb); err != nil {
+		t.Fatal(err)
+	}
+	others, _ := NewTable("others", "ID", "string", "", "")
+	tests := []struct {
+		name string
+		wait func(ctx context.Context) error
+	}{
+		{"WaitUntilActive", func(ctx context.Context) error { return WaitUntilActive(ctx, f, others, time.Millisecond) }},
+		{"WaitUntilDeleted", func(ctx context.Context) error { return WaitUntilDeleted(ctx, f, tb, time.Millisecond) }},
+		{"CreateTableAndWait", func(ctx context.Context) error { return CreateTableAndWait(ctx, f, others, time.Millisecond) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			before := f.Calls("DescribeTable")
+			if err := tt.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v, want context.DeadlineExceeded", err)
+			}
+			if n := f.Calls("DescribeTable") - before; n < 2 {
+				t.Errorf("got %d DescribeTable calls, want the table polled until the deadline", n)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WaitUntilDeleted(ctx, f, tb, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: got %v, want context.Canceled", err)
+	}
+}